@@ -15,187 +15,403 @@
 package twodee
 
 import (
-	"container/heap"
+	"context"
 	"fmt"
+	"math"
 )
 
-type step struct {
-	x        int32
-	y        int32
-	g        int32
-	parent   *step
-	priority int32 // The priority of the item in the queue.
-	// The index is needed by update and is maintained by the heap.Interface methods.
-	index int // The index of the item in the heap.
+// Per-cell bookkeeping for a search.  Nodes are only valid when stamp
+// matches the owning pathSearch, which lets searches reuse the same buffers
+// without clearing them.
+type pathNode struct {
+	g      float32
+	f      float32
+	parent int32
+	open   int32 // Position in the open heap, or -1 once closed.
+	stamp  uint32
 }
 
-type pathSet map[int32]*step
+// Scratch state for searching a grid.  The open list is a binary heap of
+// grid indices, and each node records its own heap position so that open
+// nodes can be found and updated without scanning.
+type pathSearch struct {
+	nodes []pathNode
+	heap  []int32
+	stamp uint32
+}
+
+func newPathSearch(size int32) *pathSearch {
+	return &pathSearch{
+		nodes: make([]pathNode, size),
+		heap:  make([]int32, 0, 64),
+	}
+}
 
-type pathQueue []*step
+// Forgets the previous search.
+func (s *pathSearch) reset() {
+	s.stamp++
+	if s.stamp == 0 {
+		// Stamps wrapped around, so old nodes could look current.
+		for i := range s.nodes {
+			s.nodes[i].stamp = 0
+		}
+		s.stamp = 1
+	}
+	s.heap = s.heap[:0]
+}
+
+func (s *pathSearch) seen(i int32) bool {
+	return s.nodes[i].stamp == s.stamp
+}
+
+func (s *pathSearch) Len() int {
+	return len(s.heap)
+}
+
+// Records a path to i costing g with priority f.  Returns false if i was
+// already reached more cheaply.  Closed nodes which improve are reopened.
+func (s *pathSearch) relax(i int32, g, f float32, parent int32) bool {
+	var n = &s.nodes[i]
+	if n.stamp == s.stamp {
+		if g >= n.g {
+			return false
+		}
+		n.g = g
+		n.f = f
+		n.parent = parent
+		if n.open >= 0 {
+			s.up(n.open)
+		} else {
+			s.push(i)
+		}
+		return true
+	}
+	*n = pathNode{
+		g:      g,
+		f:      f,
+		parent: parent,
+		open:   -1,
+		stamp:  s.stamp,
+	}
+	s.push(i)
+	return true
+}
 
-func (q pathQueue) Len() int { return len(q) }
+// Removes and returns the open node with the lowest priority.
+func (s *pathSearch) pop() (i int32) {
+	var last = int32(len(s.heap) - 1)
+	i = s.heap[0]
+	s.swap(0, last)
+	s.heap = s.heap[:last]
+	s.nodes[i].open = -1
+	if last > 0 {
+		s.down(0)
+	}
+	return
+}
 
-func (q pathQueue) Less(i, j int) bool {
-	return q[i].priority < q[j].priority
+func (s *pathSearch) push(i int32) {
+	s.nodes[i].open = int32(len(s.heap))
+	s.heap = append(s.heap, i)
+	s.up(int32(len(s.heap) - 1))
 }
 
-func (q pathQueue) Swap(i, j int) {
-	q[i], q[j] = q[j], q[i]
-	q[i].index = i
-	q[j].index = j
+func (s *pathSearch) less(a, b int32) bool {
+	var (
+		na = &s.nodes[s.heap[a]]
+		nb = &s.nodes[s.heap[b]]
+	)
+	if na.f == nb.f {
+		// Prefer nodes further from the start, which are usually closer
+		// to the goal.
+		return na.g > nb.g
+	}
+	return na.f < nb.f
 }
 
-func (q *pathQueue) Push(x interface{}) {
-	n := len(*q)
-	item := x.(*step)
-	item.index = n
-	*q = append(*q, item)
+func (s *pathSearch) swap(a, b int32) {
+	s.heap[a], s.heap[b] = s.heap[b], s.heap[a]
+	s.nodes[s.heap[a]].open = a
+	s.nodes[s.heap[b]].open = b
 }
 
-func (q *pathQueue) Pop() interface{} {
-	old := *q
-	n := len(old)
-	item := old[n-1]
-	item.index = -1 // for safety
-	*q = old[0 : n-1]
-	return item
+func (s *pathSearch) up(j int32) {
+	for j > 0 {
+		i := (j - 1) / 2
+		if !s.less(j, i) {
+			break
+		}
+		s.swap(i, j)
+		j = i
+	}
 }
 
-func (q pathQueue) Find(x, y int32) *step {
-	for i := 0; i < len(q); i++ {
-		if q[i].x == x && q[i].y == y {
-			return q[i]
+func (s *pathSearch) down(i int32) {
+	var n = int32(len(s.heap))
+	for {
+		j := 2*i + 1
+		if j >= n {
+			break
+		}
+		if r := j + 1; r < n && s.less(r, j) {
+			j = r
 		}
+		if !s.less(j, i) {
+			break
+		}
+		s.swap(i, j)
+		i = j
+	}
+}
+
+// Follows parent links back from the node at index to the start.
+func (s *pathSearch) points(g *Grid, index int32) (out []GridPoint) {
+	var (
+		count = 0
+		i     int32
+	)
+	for i = index; i != -1; i = s.nodes[i].parent {
+		count++
+	}
+	out = make([]GridPoint, count)
+	for i = index; i != -1; i = s.nodes[i].parent {
+		count--
+		out[count].X, out[count].Y = g.Coords(i)
+	}
+	return
+}
+
+// Returns scratch search state sized for the grid.  Searches should be
+// handed back with putPathSearch when done so later queries can reuse them.
+func (g *Grid) getPathSearch() (s *pathSearch) {
+	var ok bool
+	if s, ok = g.pathPool.Get().(*pathSearch); !ok || len(s.nodes) != len(g.points) {
+		s = newPathSearch(int32(len(g.points)))
+	}
+	s.reset()
+	return
+}
+
+func (g *Grid) putPathSearch(s *pathSearch) {
+	g.pathPool.Put(s)
+}
+
+// Controls whether the pathfinder may move diagonally between cells.
+type DiagonalMode int
+
+const (
+	// Only the four cardinal neighbours are considered.
+	DiagonalNever DiagonalMode = iota
+	// Diagonal moves are allowed even when both adjacent cardinal cells
+	// are blocked, so paths may squeeze between two touching corners.
+	DiagonalAlways
+	// Diagonal moves are allowed if at least one of the adjacent cardinal
+	// cells is open.
+	DiagonalOneObstacle
+	// Diagonal moves are only allowed if both adjacent cardinal cells are
+	// open, so paths never clip the corner of a blocked cell.
+	DiagonalNoObstacles
+)
+
+// Estimates the remaining cost of a path given the absolute x and y
+// distances to the goal.
+type PathHeuristic func(dx, dy int32) float32
+
+func ManhattanHeuristic(dx, dy int32) float32 {
+	return float32(dx + dy)
+}
+
+func OctileHeuristic(dx, dy int32) float32 {
+	if dx < dy {
+		dx, dy = dy, dx
+	}
+	return float32(dx-dy) + math.Sqrt2*float32(dy)
+}
+
+func EuclideanHeuristic(dx, dy int32) float32 {
+	return float32(math.Sqrt(float64(dx*dx + dy*dy)))
+}
+
+// Heuristics only stay admissible if no cell costs less than 1 to enter,
+// so maps using cheaper items (roads) should scale their costs accordingly.
+type PathOptions struct {
+	Algorithm PathAlgorithm
+	Diagonals DiagonalMode
+	// Defaults to ManhattanHeuristic without diagonals and
+	// OctileHeuristic with them.
+	Heuristic PathHeuristic
+	// If set, searches between cells it reports as unconnected fail
+	// without exploring.  It should allow at least the same diagonal
+	// moves as Diagonals.
+	Connectivity *GridConnectivity
+}
+
+func (o PathOptions) heuristic() PathHeuristic {
+	switch {
+	case o.Heuristic != nil:
+		return o.Heuristic
+	case o.Diagonals == DiagonalNever:
+		return ManhattanHeuristic
+	default:
+		return OctileHeuristic
+	}
+}
+
+var (
+	cardinalXs = []int32{0, 1, 0, -1}
+	cardinalYs = []int32{1, 0, -1, 0}
+	diagonalXs = []int32{1, 1, -1, -1}
+	diagonalYs = []int32{1, -1, -1, 1}
+)
+
+// Returns true if the pathfinder may enter the cell at x, y.  As with
+// FixMove, items reporting Passable() block movement.
+func (g *Grid) walkable(x, y int32) bool {
+	if !g.InBounds(x, y) {
+		return false
+	}
+	item := g.Get(x, y)
+	return item == nil || !item.Passable()
+}
+
+// Returns the cost of entering the cell at x, y.
+func (g *Grid) movementCost(x, y int32) float32 {
+	if item, ok := g.Get(x, y).(WeightedGridItem); ok {
+		return item.MovementCost()
 	}
-	return nil
+	return 1
 }
 
-func newStep(x, y, g, p int32, parent *step) *step {
-	return &step{
-		x:        x,
-		y:        y,
-		g:        g,
-		parent:   parent,
-		priority: p,
+// Returns true if a diagonal step of dx, dy from x, y is allowed by mode.
+// The destination cell itself is assumed to be walkable.
+func (g *Grid) canCutCorner(x, y, dx, dy int32, mode DiagonalMode) bool {
+	var (
+		openX = g.walkable(x+dx, y)
+		openY = g.walkable(x, y+dy)
+	)
+	switch mode {
+	case DiagonalAlways:
+		return true
+	case DiagonalOneObstacle:
+		return openX || openY
+	case DiagonalNoObstacles:
+		return openX && openY
 	}
+	return false
 }
 
+// Calls visit for every cell which may be reached in one step from x, y,
+// passing the length of the step.
+func (g *Grid) eachNeighbor(x, y int32, mode DiagonalMode, visit func(nx, ny int32, dist float32)) {
+	var (
+		i      int
+		nx, ny int32
+	)
+	for i = 0; i < len(cardinalXs); i++ {
+		nx = x + cardinalXs[i]
+		ny = y + cardinalYs[i]
+		if g.walkable(nx, ny) {
+			visit(nx, ny, 1)
+		}
+	}
+	if mode == DiagonalNever {
+		return
+	}
+	for i = 0; i < len(diagonalXs); i++ {
+		nx = x + diagonalXs[i]
+		ny = y + diagonalYs[i]
+		if g.walkable(nx, ny) && g.canCutCorner(x, y, diagonalXs[i], diagonalYs[i], mode) {
+			visit(nx, ny, math.Sqrt2)
+		}
+	}
+}
+
+func (g *Grid) GetPath(x1, y1, x2, y2 int32) (out []GridPoint, err error) {
+	return g.GetPathWithOptions(x1, y1, x2, y2, PathOptions{})
+}
+
+func (g *Grid) GetPathWithOptions(x1, y1, x2, y2 int32, opts PathOptions) (out []GridPoint, err error) {
+	return g.GetPathContext(context.Background(), x1, y1, x2, y2, opts)
+}
+
+// How many nodes searches expand between checks for cancellation.
+const pathCancelInterval = 256
+
 // Pretty much a direct A* implementation from
 // http://theory.stanford.edu/~amitp/GameProgramming/ImplementationNotes.html
-func (g *Grid) GetPath(x1, y1, x2, y2 int32) (out []GridPoint, err error) {
+//
+// Gives up and returns ctx.Err() if ctx is cancelled during the search.
+func (g *Grid) GetPathContext(ctx context.Context, x1, y1, x2, y2 int32, opts PathOptions) (out []GridPoint, err error) {
 	var (
-		open     = &pathQueue{}
-		closed   = pathSet{}
-		current  *step
-		xs       = []int32{0, 1, 0, -1}
-		ys       = []int32{1, 0, -1, 0}
-		cost     int32
-		neighbor *step
+		search    *pathSearch
+		heuristic = opts.heuristic()
+		start     = g.Index(x1, y1)
+		goal      = g.Index(x2, y2)
+		current   int32
+		cx, cy    int32
+		expanded  int
 	)
-	// CLOSED = empty set
+	if start == -1 || goal == -1 {
+		err = fmt.Errorf("No path found")
+		return
+	}
+	if opts.Connectivity != nil && g.walkable(x1, y1) && !opts.Connectivity.Connected(x1, y1, x2, y2) {
+		err = fmt.Errorf("No path found")
+		return
+	}
+	if opts.Algorithm != AStar {
+		if opts.Diagonals != DiagonalNoObstacles {
+			err = fmt.Errorf("Jump point search needs DiagonalNoObstacles")
+			return
+		}
+		return g.getJumpPointPath(ctx, x1, y1, x2, y2, opts.Algorithm == JumpPointSearchPlus)
+	}
+	search = g.getPathSearch()
+	defer g.putPathSearch(search)
 	// OPEN = priority queue containing START
-	heap.Init(open)
-	heap.Push(open, newStep(x1, y1, 0, 0, nil))
+	search.relax(start, 0, 0, -1)
 
 	// While lowest rank in OPEN is not the GOAL:
-	for open.Len() > 0 {
-		// Set current = remove lowest rank item from OPEN
-		current = heap.Pop(open).(*step)
-		if current.x == x2 && current.y == y2 {
+	for search.Len() > 0 {
+		// Set current = remove lowest rank item from OPEN, which also
+		// moves it to CLOSED
+		current = search.pop()
+		if expanded++; expanded%pathCancelInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				return
+			}
+		}
+		if current == goal {
 			// Reconstruct reverse path from goal to start
 			// by following parent pointers
-			return getPoints(current), nil
+			return search.points(g, goal), nil
 		}
-		// Add current to CLOSED
-		closed[g.Index(current.x, current.y)] = current
+		cx, cy = g.Coords(current)
 
 		// For neighbors of current:
-		for _, xm := range xs {
-			for _, ym := range ys {
+		g.eachNeighbor(cx, cy, opts.Diagonals, func(nx, ny int32, dist float32) {
+			var (
 				// Set cost = g(current) + movementcost(current, neighbor)
-				cost = current.g + 1
-				var inopen, inclosed bool
-				var nx, ny int32
-				nx = current.x + xm
-				ny = current.y + ym
-				if g.Get(nx, ny).Passable() == true {
-					// Spot is occupied
-					continue
-				}
-				// If neighbor in OPEN and cost less than g(neighbor):
-				// remove neighbor from OPEN, because new path is better
-				if neighbor = open.Find(nx, ny); neighbor != nil {
-					if cost < neighbor.g {
-						heap.Remove(open, neighbor.index)
-						inopen = false
-					} else {
-						inopen = true
-					}
-				} else {
-					inopen = false
-				}
-				// If neighbor in CLOSED and cost less than g(neighbor):
-				// remove neighbor from CLOSED
-				if neighbor, inclosed = closed[g.Index(nx, ny)]; inclosed == true {
-					if cost < neighbor.g {
-						delete(closed, g.Index(nx, ny))
-						inclosed = false
-					}
-				} else {
-					inclosed = false
-				}
-				// If neighbor not in OPEN and neighbor not in CLOSED:
-				if !inopen && !inclosed {
-					var h = heuristic(nx, ny, x2, y2)
-					// Set g(neighbor) to cost
-					// Set priority queue rank to g(neighbor) + h(neighbor)
-					// Set neighbor's parent to current
-					neighbor = newStep(nx, ny, cost, cost+h, current)
-					// Add neighbor to OPEN
-					heap.Push(open, neighbor)
-				}
-			}
-		}
+				cost = search.nodes[current].g + dist*g.movementCost(nx, ny)
+				h    = heuristic(absInt32(x2-nx), absInt32(y2-ny))
+			)
+			// If neighbor is new, or was reached more expensively
+			// before, set its rank to g(neighbor) + h(neighbor) and
+			// (re)open it with current as its parent
+			search.relax(g.Index(nx, ny), cost, cost+h, current)
+		})
 	}
 	err = fmt.Errorf("No path found")
 	return
 }
 
-func heuristic(x1, y1, x2, y2 int32) int32 {
-	var (
-		dx   = x2 - x1
-		dy   = y2 - y1
-		negx = dx < 0
-		negy = dy < 0
-	)
-	if negx == true {
-		dx *= -1
-	}
-	if negy == true {
-		dy *= -1
+func absInt32(v int32) int32 {
+	if v < 0 {
+		return -v
 	}
-	return dx + dy
+	return v
 }
 
 type GridPoint struct {
 	X, Y int32
 }
-
-func getPoints(dest *step) []GridPoint {
-	var (
-		count  = 1
-		marker = dest
-		out    []GridPoint
-	)
-	for marker.parent != nil {
-		count += 1
-		marker = marker.parent
-	}
-	out = make([]GridPoint, count)
-	marker = dest
-	for i := count - 1; i > -1; i-- {
-		out[i] = GridPoint{marker.x, marker.y}
-		marker = marker.parent
-	}
-	return out
-}
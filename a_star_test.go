@@ -0,0 +1,402 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"container/heap"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+type testGridItem struct {
+	blocked bool
+	cost    float32
+}
+
+func (i testGridItem) Passable() bool {
+	return i.blocked
+}
+
+func (i testGridItem) Opaque() bool {
+	return i.blocked
+}
+
+func (i testGridItem) MovementCost() float32 {
+	if i.cost == 0 {
+		return 1
+	}
+	return i.cost
+}
+
+// Builds a grid from rows of text, top row first.  '#' is a wall, digits
+// are open cells with that movement cost and anything else is open.
+func newTestGrid(rows ...string) *Grid {
+	var (
+		h = int32(len(rows))
+		w = int32(len(rows[0]))
+		g = NewGrid(w, h, 1)
+	)
+	for row, line := range rows {
+		for x, c := range line {
+			var item = testGridItem{}
+			switch {
+			case c == '#':
+				item.blocked = true
+			case c >= '1' && c <= '9':
+				item.cost = float32(c - '0')
+			}
+			g.Set(int32(x), h-int32(row)-1, item)
+		}
+	}
+	return g
+}
+
+func pathCost(g *Grid, path []GridPoint) (cost float32) {
+	for i := 1; i < len(path); i++ {
+		var (
+			dx   = absInt32(path[i].X - path[i-1].X)
+			dy   = absInt32(path[i].Y - path[i-1].Y)
+			step = g.movementCost(path[i].X, path[i].Y)
+		)
+		if dx+dy == 2 {
+			step *= 1.41421356
+		}
+		cost += step
+	}
+	return
+}
+
+func TestGetPathCardinal(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"....",
+			".##.",
+			"....",
+		)
+		path []GridPoint
+		err  error
+	)
+	if path, err = g.GetPath(0, 1, 3, 1); err != nil {
+		t.Fatalf("Expected path, got error: %v", err)
+	}
+	if len(path) != 6 {
+		t.Fatalf("Expected 6 steps, got %v", path)
+	}
+	for i := 1; i < len(path); i++ {
+		if absInt32(path[i].X-path[i-1].X)+absInt32(path[i].Y-path[i-1].Y) != 1 {
+			t.Fatalf("Non-cardinal step in path %v", path)
+		}
+	}
+}
+
+func TestGetPathNoPath(t *testing.T) {
+	var g = newTestGrid(
+		".#.",
+		".#.",
+		".#.",
+	)
+	if _, err := g.GetPath(0, 0, 2, 2); err == nil {
+		t.Fatalf("Expected error for unreachable goal")
+	}
+}
+
+func TestGetPathDiagonal(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"....",
+			"....",
+			"....",
+			"....",
+		)
+		opts = PathOptions{Diagonals: DiagonalAlways}
+		path []GridPoint
+		err  error
+	)
+	if path, err = g.GetPathWithOptions(0, 0, 3, 3, opts); err != nil {
+		t.Fatalf("Expected path, got error: %v", err)
+	}
+	if len(path) != 4 {
+		t.Fatalf("Expected straight diagonal path, got %v", path)
+	}
+}
+
+func TestGetPathCornerCutting(t *testing.T) {
+	var (
+		g = newTestGrid(
+			".#",
+			"#.",
+		)
+		path []GridPoint
+		err  error
+	)
+	opts := PathOptions{Diagonals: DiagonalAlways}
+	if path, err = g.GetPathWithOptions(0, 1, 1, 0, opts); err != nil || len(path) != 2 {
+		t.Fatalf("Expected squeeze between corners, got %v %v", path, err)
+	}
+	opts.Diagonals = DiagonalOneObstacle
+	if _, err = g.GetPathWithOptions(0, 1, 1, 0, opts); err == nil {
+		t.Fatalf("DiagonalOneObstacle should not pass between two walls")
+	}
+	g = newTestGrid(
+		"..",
+		"#.",
+	)
+	if path, err = g.GetPathWithOptions(0, 1, 1, 0, opts); err != nil || len(path) != 2 {
+		t.Fatalf("DiagonalOneObstacle should cut one corner, got %v %v", path, err)
+	}
+	opts.Diagonals = DiagonalNoObstacles
+	if path, err = g.GetPathWithOptions(0, 1, 1, 0, opts); err != nil || len(path) != 3 {
+		t.Fatalf("DiagonalNoObstacles should go around corner, got %v %v", path, err)
+	}
+}
+
+func TestGetPathWeighted(t *testing.T) {
+	var (
+		g = newTestGrid(
+			".....",
+			".999.",
+			".....",
+		)
+		path []GridPoint
+		err  error
+	)
+	if path, err = g.GetPath(0, 1, 4, 1); err != nil {
+		t.Fatalf("Expected path, got error: %v", err)
+	}
+	for _, pt := range path {
+		if pt.Y == 1 && pt.X > 0 && pt.X < 4 {
+			t.Fatalf("Path went through expensive cells: %v", path)
+		}
+	}
+	if cost := pathCost(g, path); cost != 6 {
+		t.Fatalf("Expected cost 6, got %v", cost)
+	}
+}
+
+func TestGetPathHeuristics(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"......",
+			".####.",
+			"...1..",
+			"......",
+		)
+		heuristics = []PathHeuristic{OctileHeuristic, EuclideanHeuristic}
+		expected   float32
+	)
+	for i, h := range heuristics {
+		opts := PathOptions{Diagonals: DiagonalNoObstacles, Heuristic: h}
+		path, err := g.GetPathWithOptions(0, 0, 5, 3, opts)
+		if err != nil {
+			t.Fatalf("Expected path, got error: %v", err)
+		}
+		cost := pathCost(g, path)
+		if i == 0 {
+			expected = cost
+		} else if cost-expected > 0.001 || expected-cost > 0.001 {
+			t.Fatalf("Heuristic %v found cost %v, expected %v", i, cost, expected)
+		}
+	}
+}
+
+// The original A* implementation, which scans its open list linearly and
+// allocates a step per visited node.  Kept as a reference to check the costs
+// found by GetPath and to benchmark against.
+type legacyStep struct {
+	x        int32
+	y        int32
+	g        float32
+	parent   *legacyStep
+	priority float32
+	index    int
+}
+
+type legacyQueue []*legacyStep
+
+func (q legacyQueue) Len() int { return len(q) }
+
+func (q legacyQueue) Less(i, j int) bool {
+	return q[i].priority < q[j].priority
+}
+
+func (q legacyQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *legacyQueue) Push(x interface{}) {
+	item := x.(*legacyStep)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *legacyQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	item.index = -1
+	*q = old[0 : n-1]
+	return item
+}
+
+func (q legacyQueue) Find(x, y int32) *legacyStep {
+	for i := 0; i < len(q); i++ {
+		if q[i].x == x && q[i].y == y {
+			return q[i]
+		}
+	}
+	return nil
+}
+
+func legacyGetPath(g *Grid, x1, y1, x2, y2 int32, opts PathOptions) (out []GridPoint, err error) {
+	var (
+		open      = &legacyQueue{}
+		closed    = map[int32]*legacyStep{}
+		current   *legacyStep
+		heuristic = opts.heuristic()
+	)
+	heap.Push(open, &legacyStep{x: x1, y: y1})
+	for open.Len() > 0 {
+		current = heap.Pop(open).(*legacyStep)
+		if current.x == x2 && current.y == y2 {
+			for marker := current; marker != nil; marker = marker.parent {
+				out = append([]GridPoint{{marker.x, marker.y}}, out...)
+			}
+			return
+		}
+		closed[g.Index(current.x, current.y)] = current
+		g.eachNeighbor(current.x, current.y, opts.Diagonals, func(nx, ny int32, dist float32) {
+			var (
+				cost     = current.g + dist*g.movementCost(nx, ny)
+				neighbor *legacyStep
+				inopen   bool
+				inclosed bool
+			)
+			if neighbor = open.Find(nx, ny); neighbor != nil {
+				if cost < neighbor.g {
+					heap.Remove(open, neighbor.index)
+				} else {
+					inopen = true
+				}
+			}
+			if neighbor, inclosed = closed[g.Index(nx, ny)]; inclosed {
+				if cost < neighbor.g {
+					delete(closed, g.Index(nx, ny))
+					inclosed = false
+				}
+			}
+			if !inopen && !inclosed {
+				h := heuristic(absInt32(x2-nx), absInt32(y2-ny))
+				heap.Push(open, &legacyStep{
+					x:        nx,
+					y:        ny,
+					g:        cost,
+					parent:   current,
+					priority: cost + h,
+				})
+			}
+		})
+	}
+	err = fmt.Errorf("No path found")
+	return
+}
+
+// Builds a size x size grid with roughly density walls and random costs,
+// keeping the corners open.
+func newRandomGrid(seed int64, size int32, density float64) *Grid {
+	var (
+		r = rand.New(rand.NewSource(seed))
+		g = NewGrid(size, size, 1)
+	)
+	for x := int32(0); x < size; x++ {
+		for y := int32(0); y < size; y++ {
+			g.Set(x, y, testGridItem{
+				blocked: r.Float64() < density,
+				cost:    float32(1 + r.Intn(3)),
+			})
+		}
+	}
+	g.Set(0, 0, testGridItem{})
+	g.Set(size-1, size-1, testGridItem{})
+	return g
+}
+
+func TestGetPathMatchesLegacy(t *testing.T) {
+	var modes = []DiagonalMode{DiagonalNever, DiagonalNoObstacles}
+	for seed := int64(0); seed < 20; seed++ {
+		var g = newRandomGrid(seed, 24, 0.3)
+		for _, mode := range modes {
+			var (
+				opts         = PathOptions{Diagonals: mode}
+				path, err    = g.GetPathWithOptions(0, 0, 23, 23, opts)
+				legacy, lerr = legacyGetPath(g, 0, 0, 23, 23, opts)
+				cost, lcost  = pathCost(g, path), pathCost(g, legacy)
+			)
+			if (err == nil) != (lerr == nil) {
+				t.Fatalf("Seed %v: got error %v, legacy error %v", seed, err, lerr)
+			}
+			if cost-lcost > 0.001 || lcost-cost > 0.001 {
+				t.Fatalf("Seed %v: got cost %v, legacy cost %v", seed, cost, lcost)
+			}
+		}
+	}
+}
+
+func TestGetPathReusesSearch(t *testing.T) {
+	var g = newTestGrid(
+		"...",
+		".#.",
+		"...",
+	)
+	for i := 0; i < 3; i++ {
+		if path, err := g.GetPath(0, 0, 2, 2); err != nil || len(path) != 5 {
+			t.Fatalf("Run %v: expected 5 step path, got %v %v", i, path, err)
+		}
+	}
+}
+
+func benchmarkGetPath(b *testing.B, size int32, legacy bool) {
+	var (
+		g    = newRandomGrid(1, size, 0.2)
+		opts = PathOptions{Diagonals: DiagonalNoObstacles}
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if legacy {
+			legacyGetPath(g, 0, 0, size-1, size-1, opts)
+		} else {
+			g.GetPathWithOptions(0, 0, size-1, size-1, opts)
+		}
+	}
+}
+
+func BenchmarkGetPath64(b *testing.B) {
+	benchmarkGetPath(b, 64, false)
+}
+
+func BenchmarkLegacyGetPath64(b *testing.B) {
+	benchmarkGetPath(b, 64, true)
+}
+
+func BenchmarkGetPath256(b *testing.B) {
+	benchmarkGetPath(b, 256, false)
+}
+
+func BenchmarkLegacyGetPath256(b *testing.B) {
+	benchmarkGetPath(b, 256, true)
+}
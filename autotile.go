@@ -0,0 +1,271 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"sort"
+)
+
+// Bits of a neighbour mask, set when the neighbour in that direction
+// matches.  The four edges come first so that a 4-bit mask is the low
+// nibble of an 8-bit one.
+const (
+	AutotileNorth uint8 = 1 << iota
+	AutotileEast
+	AutotileSouth
+	AutotileWest
+	AutotileNorthEast
+	AutotileSouthEast
+	AutotileSouthWest
+	AutotileNorthWest
+)
+
+type AutotileMode int
+
+const (
+	// Only the four edge neighbours count, giving 16 masks.
+	Autotile4 AutotileMode = iota
+	// Corner neighbours count too, but only when both edges next to them
+	// match, giving the 47 masks of a blob tileset.
+	Autotile8
+)
+
+// Maps neighbour masks to frames of a tileset.
+type AutotileRules map[uint8]int
+
+// Returns rules which map each 4-bit mask to first plus the mask, for
+// tilesets which lay out the 16 tiles in mask order.
+func Autotile4Rules(first int) (rules AutotileRules) {
+	rules = AutotileRules{}
+	for mask := 0; mask < 16; mask++ {
+		rules[uint8(mask)] = first + mask
+	}
+	return
+}
+
+// Returns rules which map the 47 blob masks, in increasing order, to
+// consecutive frames from first.
+func AutotileBlobRules(first int) (rules AutotileRules) {
+	rules = AutotileRules{}
+	for i, mask := range AutotileBlobMasks() {
+		rules[mask] = first + i
+	}
+	return
+}
+
+// Returns the 47 distinct 8-bit masks in increasing order.
+func AutotileBlobMasks() (masks []uint8) {
+	for mask := 0; mask < 256; mask++ {
+		if reduceBlobMask(uint8(mask)) == uint8(mask) {
+			masks = append(masks, uint8(mask))
+		}
+	}
+	return
+}
+
+// Clears corner bits unless both edges beside the corner are set.
+func reduceBlobMask(mask uint8) uint8 {
+	var corners = []struct{ corner, a, b uint8 }{
+		{AutotileNorthEast, AutotileNorth, AutotileEast},
+		{AutotileSouthEast, AutotileSouth, AutotileEast},
+		{AutotileSouthWest, AutotileSouth, AutotileWest},
+		{AutotileNorthWest, AutotileNorth, AutotileWest},
+	}
+	for _, c := range corners {
+		if mask&c.a == 0 || mask&c.b == 0 {
+			mask &^= c.corner
+		}
+	}
+	return mask
+}
+
+// Picks tileset frames for the cells of a Grid which match a predicate from
+// which of their neighbours also match, so walls and terrain join up
+// without placing each corner and edge by hand.
+//
+// Tiles are kept for every cell and updated as the grid changes; call
+// Update to apply changes and find which tiles need redrawing.
+type Autotiler struct {
+	Grid     *Grid
+	Mode     AutotileMode
+	Rules    AutotileRules
+	Default  int // Frame for masks missing from Rules.
+	Metadata TileMetadata
+	// Returns true for cells which get tiles.  Defaults to items which
+	// block movement.
+	Match func(item GridItem) bool
+	// Whether cells beyond the edge of the grid count as matching.
+	MatchOutside bool
+	tiles        []TexturedTile
+	dirty        map[int32]bool
+	observerId   int
+}
+
+func NewAutotiler(g *Grid, mode AutotileMode, rules AutotileRules, metadata TileMetadata) (a *Autotiler) {
+	a = &Autotiler{
+		Grid:     g,
+		Mode:     mode,
+		Rules:    rules,
+		Metadata: metadata,
+		tiles:    make([]TexturedTile, len(g.points)),
+		dirty:    map[int32]bool{},
+	}
+	a.observerId = g.AddChangeObserver(a.onChange)
+	return
+}
+
+// Stops listening for changes to the grid.
+func (a *Autotiler) Delete() {
+	a.Grid.RemoveChangeObserver(a.observerId)
+}
+
+func (a *Autotiler) onChange(x, y int32, old, val GridItem) {
+	a.dirty[a.Grid.Index(x, y)] = true
+}
+
+func (a *Autotiler) matches(x, y int32) bool {
+	if !a.Grid.InBounds(x, y) {
+		return a.MatchOutside
+	}
+	var item = a.Grid.Get(x, y)
+	if a.Match == nil {
+		return item != nil && item.Passable()
+	}
+	return a.Match(item)
+}
+
+// Returns the neighbour mask of the cell at x, y for the tiler's mode.
+func (a *Autotiler) Mask(x, y int32) (mask uint8) {
+	var neighbours = []struct {
+		dx, dy int32
+		bit    uint8
+	}{
+		{0, 1, AutotileNorth},
+		{1, 0, AutotileEast},
+		{0, -1, AutotileSouth},
+		{-1, 0, AutotileWest},
+		{1, 1, AutotileNorthEast},
+		{1, -1, AutotileSouthEast},
+		{-1, -1, AutotileSouthWest},
+		{-1, 1, AutotileNorthWest},
+	}
+	if a.Mode == Autotile4 {
+		neighbours = neighbours[:4]
+	}
+	for _, n := range neighbours {
+		if a.matches(x+n.dx, y+n.dy) {
+			mask |= n.bit
+		}
+	}
+	if a.Mode == Autotile8 {
+		mask = reduceBlobMask(mask)
+	}
+	return
+}
+
+// Returns the frame for the cell at x, y, and false if the cell does not
+// match.
+func (a *Autotiler) Frame(x, y int32) (frame int, ok bool) {
+	if !a.Grid.InBounds(x, y) || !a.matches(x, y) {
+		return
+	}
+	if frame, ok = a.Rules[a.Mask(x, y)]; !ok {
+		frame = a.Default
+	}
+	return frame, true
+}
+
+func (a *Autotiler) tile(x, y int32, frame int) TileQuad {
+	var (
+		w    = a.Metadata.TileWidth
+		h    = a.Metadata.TileHeight
+		wide = a.Metadata.FramesWide
+	)
+	if wide < 1 {
+		wide = 1
+	}
+	return TileQuad{
+		X:        float32(x) * float32(w),
+		Y:        float32(y) * float32(h),
+		Width:    float32(w),
+		Height:   float32(h),
+		TextureX: float32(frame % wide * w),
+		TextureY: float32(frame / wide * h),
+	}
+}
+
+// Recomputes the tiles of the cells from x1, y1 to x2, y2 inclusive, and
+// returns the indices of those whose tile changed.  Cells next to a changed
+// cell may change too, so callers should include them.
+func (a *Autotiler) Retile(x1, y1, x2, y2 int32) (changed []int32) {
+	var g = a.Grid
+	x1, y1 = maxInt32(x1, 0), maxInt32(y1, 0)
+	x2, y2 = minInt32(x2, g.Width-1), minInt32(y2, g.Height-1)
+	for y := y1; y <= y2; y++ {
+		for x := x1; x <= x2; x++ {
+			var (
+				index     = g.Index(x, y)
+				frame, ok = a.Frame(x, y)
+				tile      TexturedTile
+			)
+			if ok {
+				tile = a.tile(x, y, frame)
+			}
+			if tile == a.tiles[index] {
+				continue
+			}
+			a.tiles[index] = tile
+			changed = append(changed, index)
+		}
+	}
+	return
+}
+
+// Applies changes made to the grid since the last call, retiling each
+// changed cell and its neighbours, and returns the indices of the tiles
+// which changed.
+func (a *Autotiler) Update() (changed []int32) {
+	for index := range a.dirty {
+		var x, y = a.Grid.Coords(index)
+		changed = append(changed, a.Retile(x-1, y-1, x+1, y+1)...)
+	}
+	a.dirty = map[int32]bool{}
+	sort.Slice(changed, func(i, j int) bool { return changed[i] < changed[j] })
+	return
+}
+
+// Retiles the whole grid and returns a tile for each cell, in grid index
+// order, which is nil for cells which do not match.  The slice is ready for
+// LoadBatch and is updated in place by Retile and Update.
+func (a *Autotiler) Tiles() []TexturedTile {
+	a.Retile(0, 0, a.Grid.Width-1, a.Grid.Height-1)
+	a.dirty = map[int32]bool{}
+	return a.tiles
+}
+
+// Returns the tile of the cell at index from the last retile, or nil.
+func (a *Autotiler) Tile(index int32) TexturedTile {
+	if index < 0 || int(index) >= len(a.tiles) {
+		return nil
+	}
+	return a.tiles[index]
+}
+
+func maxInt32(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
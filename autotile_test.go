@@ -0,0 +1,102 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"testing"
+)
+
+var testAutotileMetadata = TileMetadata{
+	PxPerUnit:  16,
+	TileWidth:  16,
+	TileHeight: 16,
+	FramesWide: 8,
+	FramesHigh: 6,
+}
+
+func TestAutotileBlobMasks(t *testing.T) {
+	var masks = AutotileBlobMasks()
+	if len(masks) != 47 {
+		t.Fatalf("Expected 47 blob masks, got %v", len(masks))
+	}
+	if masks[0] != 0 || masks[46] != 255 {
+		t.Fatalf("Expected masks from 0 to 255, got %v", masks)
+	}
+}
+
+func TestAutotileMasks(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"##.",
+			"##.",
+			"...",
+		)
+		a = NewAutotiler(g, Autotile4, Autotile4Rules(0), testAutotileMetadata)
+	)
+	defer a.Delete()
+	if mask := a.Mask(0, 2); mask != AutotileEast|AutotileSouth {
+		t.Fatalf("Unexpected 4-bit mask %v", mask)
+	}
+	a.Mode = Autotile8
+	if mask := a.Mask(0, 2); mask != AutotileEast|AutotileSouth|AutotileSouthEast {
+		t.Fatalf("Unexpected 8-bit mask %v", mask)
+	}
+	// The north east corner does not count without both edges.
+	if mask := a.Mask(0, 1); mask != AutotileNorth|AutotileEast|AutotileNorthEast {
+		t.Fatalf("Unexpected 8-bit mask %v", mask)
+	}
+	a.MatchOutside = true
+	if mask := a.Mask(0, 2); mask != 255 {
+		t.Fatalf("Expected cells outside to match, got %v", mask)
+	}
+	if _, ok := a.Frame(2, 2); ok {
+		t.Fatalf("Expected no frame for unmatched cell")
+	}
+}
+
+func TestAutotileTiles(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"...",
+			".#.",
+			"...",
+		)
+		a     = NewAutotiler(g, Autotile4, Autotile4Rules(0), testAutotileMetadata)
+		tiles = a.Tiles()
+	)
+	defer a.Delete()
+	if tiles[0] != nil || tiles[g.Index(1, 1)] == nil {
+		t.Fatalf("Expected a single tile, got %v", tiles)
+	}
+	if x, y, w, h := tiles[g.Index(1, 1)].ScaledBounds(16); x != 1 || y != 1 || w != 1 || h != 1 {
+		t.Fatalf("Unexpected bounds %v %v %v %v", x, y, w, h)
+	}
+	g.Set(2, 1, testGridItem{blocked: true})
+	changed := a.Update()
+	if len(changed) != 2 || changed[0] != g.Index(1, 1) || changed[1] != g.Index(2, 1) {
+		t.Fatalf("Expected both cells to change, got %v", changed)
+	}
+	// Frame 2 is the mask with only the east edge set.
+	if x, y, _, _ := tiles[g.Index(1, 1)].ScaledTextureBounds(128, 96); x != 32.0/128 || y != 80.0/96 {
+		t.Fatalf("Unexpected texture bounds %v %v", x, y)
+	}
+	if frame, _ := a.Frame(2, 1); frame != int(AutotileWest) {
+		t.Fatalf("Expected west frame, got %v", frame)
+	}
+	g.Set(0, 0, nil)
+	if changed = a.Update(); len(changed) != 0 {
+		t.Fatalf("Expected no changes, got %v", changed)
+	}
+}
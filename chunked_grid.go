@@ -0,0 +1,262 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// Position of a chunk, counted in chunks from the one at the origin.
+type ChunkKey struct {
+	X, Y int32
+}
+
+// Fills a newly created chunk, whose cell 0, 0 is at the bottom left of the
+// chunk.
+type ChunkGenerator func(key ChunkKey, chunk *Grid)
+
+// Stores chunks which are evicted so that they can be restored later.
+type ChunkLoader interface {
+	// Fills chunk with the stored cells for key.  Returns false if nothing
+	// was stored, in which case the chunk is generated instead.
+	LoadChunk(key ChunkKey, chunk *Grid) (ok bool, err error)
+	SaveChunk(key ChunkKey, chunk *Grid) error
+}
+
+// A grid without bounds, in either direction, made of square chunks which
+// are created as cells are first used and may be evicted once far from the
+// player.
+//
+// Searches and moves run on a window copied out of the chunks they cover,
+// so their cost depends on the distance covered rather than the size of
+// the world.
+type ChunkedGrid struct {
+	ChunkSize int32
+	BlockSize float32
+	Generator ChunkGenerator // Fills new chunks.  Chunks are left empty if nil.
+	Loader    ChunkLoader    // Restores and stores evicted chunks.  Optional.
+	// Number of calls to Evict which a chunk must be out of range for
+	// before it is evicted, so that chunks at the edge of the range are not
+	// thrashed.
+	EvictDelay int
+	// Extra cells around the start and goal searched by GetPath.
+	PathMargin int32
+	chunks     map[ChunkKey]*gridChunk
+}
+
+type gridChunk struct {
+	grid *Grid
+	away int // Calls to Evict since the chunk was last in range.
+}
+
+func NewChunkedGrid(chunkSize, blockSize int32) (c *ChunkedGrid, err error) {
+	if chunkSize <= 0 {
+		err = fmt.Errorf("Chunk size must be positive, got %v", chunkSize)
+		return
+	}
+	c = &ChunkedGrid{
+		ChunkSize:  chunkSize,
+		BlockSize:  float32(blockSize),
+		PathMargin: chunkSize,
+		chunks:     map[ChunkKey]*gridChunk{},
+	}
+	return
+}
+
+// Returns the chunk holding x, y and the position of the cell within it.
+// Cells left of and below the origin are in negative chunks.
+func (c *ChunkedGrid) Locate(x, y int32) (key ChunkKey, cx, cy int32) {
+	key = ChunkKey{floorDiv(x, c.ChunkSize), floorDiv(y, c.ChunkSize)}
+	cx = x - key.X*c.ChunkSize
+	cy = y - key.Y*c.ChunkSize
+	return
+}
+
+// Returns true if the chunk at key is in memory.
+func (c *ChunkedGrid) Loaded(key ChunkKey) bool {
+	_, ok := c.chunks[key]
+	return ok
+}
+
+// Returns the number of chunks in memory.
+func (c *ChunkedGrid) LoadedCount() int {
+	return len(c.chunks)
+}
+
+// Returns the chunk at key, loading or generating it first if needed.
+func (c *ChunkedGrid) Chunk(key ChunkKey) (g *Grid, err error) {
+	var (
+		chunk, ok = c.chunks[key]
+		loaded    bool
+	)
+	if ok {
+		chunk.away = 0
+		return chunk.grid, nil
+	}
+	g = NewGrid(c.ChunkSize, c.ChunkSize, 0)
+	g.BlockSize = c.BlockSize
+	if c.Loader != nil {
+		if loaded, err = c.Loader.LoadChunk(key, g); err != nil {
+			return nil, err
+		}
+	}
+	if !loaded && c.Generator != nil {
+		c.Generator(key, g)
+	}
+	c.chunks[key] = &gridChunk{grid: g}
+	return
+}
+
+// Returns the item at x, y, creating its chunk if needed.  Returns nil if
+// the chunk could not be loaded; call Chunk ahead of time to see errors.
+func (c *ChunkedGrid) Get(x, y int32) GridItem {
+	var key, cx, cy = c.Locate(x, y)
+	if g, err := c.Chunk(key); err == nil {
+		return g.Get(cx, cy)
+	}
+	return nil
+}
+
+// Sets the item at x, y, creating its chunk if needed.  Does nothing if
+// the chunk could not be loaded.
+func (c *ChunkedGrid) Set(x, y int32, val GridItem) {
+	var key, cx, cy = c.Locate(x, y)
+	if g, err := c.Chunk(key); err == nil {
+		g.Set(cx, cy, val)
+	}
+}
+
+// Saves and drops chunks further than radius chunks from the chunk holding
+// the cell x, y, once they have been out of range for EvictDelay calls.
+// Returns how many chunks were evicted.
+func (c *ChunkedGrid) Evict(x, y, radius int32) (evicted int, err error) {
+	var focus, _, _ = c.Locate(x, y)
+	for key, chunk := range c.chunks {
+		var (
+			dx = key.X - focus.X
+			dy = key.Y - focus.Y
+		)
+		if dx >= -radius && dx <= radius && dy >= -radius && dy <= radius {
+			chunk.away = 0
+			continue
+		}
+		if chunk.away++; chunk.away <= c.EvictDelay {
+			continue
+		}
+		if c.Loader != nil {
+			if err = c.Loader.SaveChunk(key, chunk.grid); err != nil {
+				return
+			}
+		}
+		delete(c.chunks, key)
+		evicted++
+	}
+	return
+}
+
+// Returns a Grid holding copies of the cells from x, y to x+w-1, y+h-1,
+// creating chunks as needed.  Changes to the window are not written back.
+func (c *ChunkedGrid) Window(x, y, w, h int32) (out *Grid, err error) {
+	out = NewGrid(w, h, 0)
+	out.BlockSize = c.BlockSize
+	for ky := floorDiv(y, c.ChunkSize); ky <= floorDiv(y+h-1, c.ChunkSize); ky++ {
+		for kx := floorDiv(x, c.ChunkSize); kx <= floorDiv(x+w-1, c.ChunkSize); kx++ {
+			var chunk *Grid
+			if chunk, err = c.Chunk(ChunkKey{kx, ky}); err != nil {
+				return nil, err
+			}
+			var (
+				ox = kx * c.ChunkSize
+				oy = ky * c.ChunkSize
+				x1 = maxInt32(x, ox)
+				y1 = maxInt32(y, oy)
+				x2 = minInt32(x+w, ox+c.ChunkSize)
+				y2 = minInt32(y+h, oy+c.ChunkSize)
+			)
+			for cy := y1; cy < y2; cy++ {
+				for cx := x1; cx < x2; cx++ {
+					out.Set(cx-x, cy-y, chunk.Get(cx-ox, cy-oy))
+				}
+			}
+		}
+	}
+	return
+}
+
+func (c *ChunkedGrid) GetPath(x1, y1, x2, y2 int32) (out []GridPoint, err error) {
+	return c.GetPathWithOptions(x1, y1, x2, y2, PathOptions{})
+}
+
+// Searches a window around x1, y1 and x2, y2, extended by PathMargin
+// cells on each side, so paths which would need to leave that window are
+// not found.
+func (c *ChunkedGrid) GetPathWithOptions(x1, y1, x2, y2 int32, opts PathOptions) (out []GridPoint, err error) {
+	var (
+		minX   = minInt32(x1, x2) - c.PathMargin
+		minY   = minInt32(y1, y2) - c.PathMargin
+		maxX   = maxInt32(x1, x2) + c.PathMargin
+		maxY   = maxInt32(y1, y2) + c.PathMargin
+		window *Grid
+	)
+	if int64(maxX-minX+1)*int64(maxY-minY+1) > math.MaxInt32 {
+		err = fmt.Errorf("No path found")
+		return
+	}
+	if window, err = c.Window(minX, minY, maxX-minX+1, maxY-minY+1); err != nil {
+		return
+	}
+	// Connectivity belongs to a particular grid, so cannot be used here.
+	opts.Connectivity = nil
+	if out, err = window.GetPathWithOptions(x1-minX, y1-minY, x2-minX, y2-minY, opts); err != nil {
+		return
+	}
+	for i := range out {
+		out[i].X += minX
+		out[i].Y += minY
+	}
+	return
+}
+
+// Moves bounds along move as Grid.SweepMove does.  Contacts are reported in
+// world cells.  If the cells around the move cannot be loaded, bounds does
+// not move at all.
+func (c *ChunkedGrid) SweepMove(bounds Rectangle, move mgl32.Vec2) (res SweepResult) {
+	var (
+		area   = sweptBounds(bounds, move)
+		minX   = int32(math.Floor(float64(area.Min.X()/c.BlockSize))) - 1
+		minY   = int32(math.Floor(float64(area.Min.Y()/c.BlockSize))) - 1
+		maxX   = int32(math.Floor(float64(area.Max.X()/c.BlockSize))) + 1
+		maxY   = int32(math.Floor(float64(area.Max.Y()/c.BlockSize))) + 1
+		offset = mgl32.Vec2{float32(minX) * c.BlockSize, float32(minY) * c.BlockSize}
+		window *Grid
+		err    error
+	)
+	if window, err = c.Window(minX, minY, maxX-minX+1, maxY-minY+1); err != nil {
+		return
+	}
+	res = window.SweepMove(bounds.Translate(Point{offset.Mul(-1)}), move)
+	for i := range res.Contacts {
+		res.Contacts[i].Cell.X += minX
+		res.Contacts[i].Cell.Y += minY
+	}
+	return
+}
+
+// Bounds are {minx, miny, maxx, maxy}.  See SweepMove.
+func (c *ChunkedGrid) FixMove(bounds mgl32.Vec4, move mgl32.Vec2) (out mgl32.Vec2) {
+	return c.SweepMove(Rect(bounds[0], bounds[1], bounds[2], bounds[3]), move).Move
+}
@@ -0,0 +1,138 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"testing"
+)
+
+type testChunkLoader struct {
+	saved map[ChunkKey]*Grid
+}
+
+func (l *testChunkLoader) LoadChunk(key ChunkKey, chunk *Grid) (bool, error) {
+	var saved, ok = l.saved[key]
+	if ok {
+		copy(chunk.points, saved.points)
+	}
+	return ok, nil
+}
+
+func (l *testChunkLoader) SaveChunk(key ChunkKey, chunk *Grid) error {
+	l.saved[key] = chunk
+	return nil
+}
+
+type failingChunkLoader struct{}
+
+func (l failingChunkLoader) LoadChunk(key ChunkKey, chunk *Grid) (bool, error) {
+	return false, fmt.Errorf("Chunk %v is missing", key)
+}
+
+func (l failingChunkLoader) SaveChunk(key ChunkKey, chunk *Grid) error {
+	return nil
+}
+
+func TestChunkedGridGetSet(t *testing.T) {
+	var (
+		c, _      = NewChunkedGrid(4, 1)
+		generated = 0
+	)
+	c.Generator = func(key ChunkKey, chunk *Grid) {
+		generated++
+		if key.X < 0 {
+			chunk.Set(0, 0, testGridItem{blocked: true})
+		}
+	}
+	if key, x, y := c.Locate(-1, -5); key != (ChunkKey{-1, -2}) || x != 3 || y != 3 {
+		t.Fatalf("Unexpected location %v %v %v", key, x, y)
+	}
+	if c.Get(-4, 0) == nil || c.Get(0, 0) != nil {
+		t.Fatalf("Expected generated wall left of the origin only")
+	}
+	c.Set(-100, 100, testGridItem{cost: 2})
+	if item := c.Get(-100, 100); item != (testGridItem{cost: 2}) {
+		t.Fatalf("Expected item to be stored far away, got %v", item)
+	}
+	if generated != 3 || c.LoadedCount() != 3 {
+		t.Fatalf("Expected three chunks, got %v generated and %v loaded", generated, c.LoadedCount())
+	}
+}
+
+func TestChunkedGridEvict(t *testing.T) {
+	var (
+		c, _   = NewChunkedGrid(4, 1)
+		loader = &testChunkLoader{saved: map[ChunkKey]*Grid{}}
+	)
+	c.Loader = loader
+	c.EvictDelay = 1
+	c.Set(20, 20, testGridItem{blocked: true})
+	c.Get(0, 0)
+	if n, _ := c.Evict(0, 0, 1); n != 0 {
+		t.Fatalf("Expected eviction to wait, evicted %v", n)
+	}
+	if n, _ := c.Evict(0, 0, 1); n != 1 || c.Loaded(ChunkKey{5, 5}) || !c.Loaded(ChunkKey{0, 0}) {
+		t.Fatalf("Expected the far chunk to be evicted, evicted %v", n)
+	}
+	if c.Get(20, 20) == nil {
+		t.Fatalf("Expected evicted chunk to be loaded again")
+	}
+}
+
+func TestChunkedGridGetPath(t *testing.T) {
+	var c, _ = NewChunkedGrid(4, 1)
+	// A wall along x = 0 with a gap at y = -1.
+	for y := int32(-10); y <= 10; y++ {
+		if y != -1 {
+			c.Set(0, y, testGridItem{blocked: true})
+		}
+	}
+	path, err := c.GetPath(-3, 2, 3, 2)
+	if err != nil {
+		t.Fatalf("Expected path through the gap: %v", err)
+	}
+	if path[0] != (GridPoint{-3, 2}) || path[len(path)-1] != (GridPoint{3, 2}) || len(path) != 13 {
+		t.Fatalf("Unexpected path %v", path)
+	}
+	c.PathMargin = 2
+	if _, err = c.GetPath(-3, 2, 3, 2); err == nil {
+		t.Fatalf("Expected no path inside a small margin")
+	}
+}
+
+func TestChunkedGridFixMove(t *testing.T) {
+	var c, _ = NewChunkedGrid(4, 1)
+	c.Set(-6, -3, testGridItem{blocked: true})
+	res := c.SweepMove(Rect(-8, -3, -7, -2), mgl32.Vec2{3, 0})
+	if res.Move[0] != 1 || len(res.Contacts) == 0 || res.Contacts[0].Cell != (GridPoint{-6, -3}) {
+		t.Fatalf("Expected to stop at the wall, got %+v", res)
+	}
+	if move := c.FixMove(mgl32.Vec4{-8, -2, -7, -1}, mgl32.Vec2{3, 0}); move[0] != 3 {
+		t.Fatalf("Expected free move above the wall, got %v", move)
+	}
+}
+
+func TestChunkedGridLoadFailure(t *testing.T) {
+	var c, _ = NewChunkedGrid(4, 1)
+	c.Loader = failingChunkLoader{}
+	if res := c.SweepMove(Rect(0, 0, 1, 1), mgl32.Vec2{3, 0}); res.Move != (mgl32.Vec2{}) || res.Time != 0 {
+		t.Fatalf("Expected not to move through unloaded cells, got %+v", res)
+	}
+	if _, err := NewChunkedGrid(0, 1); err == nil {
+		t.Fatalf("Expected error for a chunk size of 0")
+	}
+}
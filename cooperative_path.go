@@ -0,0 +1,386 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Cooperative A* and its windowed variant from "Cooperative Pathfinding",
+// Silver, 2005.
+
+package twodee
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+)
+
+type spaceTimeKey struct {
+	index int32
+	time  int32
+}
+
+type restingAgent struct {
+	agent int
+	time  int32 // First step the agent is resting.
+}
+
+type dijkstraMapKey struct {
+	goal      int32
+	diagonals DiagonalMode
+}
+
+// Records which agent occupies each cell at each step, so that agents
+// planning later can route around those planned earlier.  Agents which
+// reach the end of a reserved path rest there and keep the cell.
+//
+// Paths returned by GetPath hold one cell per step, starting at the time
+// given, with waits shown as repeated cells.  With a Window, reservations
+// are only respected and made for that many steps, and the rest of the path
+// ignores other agents; agents should plan again before reaching the end of
+// the window, typically halfway through it.
+type ReservationTable struct {
+	Grid     *Grid
+	Window   int32   // Steps to plan around other agents.  0 plans the whole path.
+	WaitCost float32 // Cost of waiting a step.  Defaults to 1.
+	// Nodes a search may expand before it fails.  Defaults to 64 per cell
+	// of the grid.  0 removes the limit.
+	MaxNodes   int
+	cells      map[spaceTimeKey]int
+	resting    map[int32]restingAgent
+	byAgent    map[int][]spaceTimeKey
+	restingAt  map[int]int32
+	horizon    int32 // Latest step with a reservation.
+	maps       map[dijkstraMapKey]*DijkstraMap
+	observerId int
+}
+
+func NewReservationTable(g *Grid, window int32) (r *ReservationTable) {
+	r = &ReservationTable{
+		Grid:     g,
+		Window:   window,
+		WaitCost: 1,
+		MaxNodes: 64 * len(g.points),
+		maps:     map[dijkstraMapKey]*DijkstraMap{},
+	}
+	r.Clear()
+	r.observerId = g.AddChangeObserver(func(x, y int32, old, val GridItem) {
+		r.maps = map[dijkstraMapKey]*DijkstraMap{}
+	})
+	return
+}
+
+// Stops listening for changes to the grid.
+func (r *ReservationTable) Delete() {
+	r.Grid.RemoveChangeObserver(r.observerId)
+}
+
+// Drops every reservation.
+func (r *ReservationTable) Clear() {
+	r.cells = map[spaceTimeKey]int{}
+	r.resting = map[int32]restingAgent{}
+	r.byAgent = map[int][]spaceTimeKey{}
+	r.restingAt = map[int]int32{}
+	r.horizon = 0
+}
+
+// Drops the reservations held by agent.
+func (r *ReservationTable) Release(agent int) {
+	for _, key := range r.byAgent[agent] {
+		delete(r.cells, key)
+	}
+	delete(r.byAgent, agent)
+	if index, ok := r.restingAt[agent]; ok {
+		delete(r.resting, index)
+		delete(r.restingAt, agent)
+	}
+}
+
+// Reserves each cell of path for agent at successive steps from time.  If
+// rest is set the agent keeps the last cell afterwards.  Any reservations
+// agent already held are released first.
+func (r *ReservationTable) Reserve(agent int, path []GridPoint, time int32, rest bool) {
+	r.Release(agent)
+	for i, pt := range path {
+		var key = spaceTimeKey{r.Grid.Index(pt.X, pt.Y), time + int32(i)}
+		r.cells[key] = agent
+		r.byAgent[agent] = append(r.byAgent[agent], key)
+		if key.time > r.horizon {
+			r.horizon = key.time
+		}
+	}
+	if rest && len(path) > 0 {
+		var (
+			last  = path[len(path)-1]
+			index = r.Grid.Index(last.X, last.Y)
+		)
+		r.resting[index] = restingAgent{agent, time + int32(len(path)) - 1}
+		r.restingAt[agent] = index
+	}
+}
+
+// Returns the agent holding the cell at x, y at time.
+func (r *ReservationTable) ReservedBy(x, y, time int32) (agent int, ok bool) {
+	return r.reservedBy(r.Grid.Index(x, y), time)
+}
+
+func (r *ReservationTable) reservedBy(index, time int32) (agent int, ok bool) {
+	if agent, ok = r.cells[spaceTimeKey{index, time}]; ok {
+		return
+	}
+	if rest, found := r.resting[index]; found && time >= rest.time {
+		return rest.agent, true
+	}
+	return
+}
+
+// Returns true if another agent holds index at time.
+func (r *ReservationTable) blocked(agent int, index, time int32) bool {
+	other, ok := r.reservedBy(index, time)
+	return ok && other != agent
+}
+
+// Returns true if moving from a to b between time and time+1 would pass
+// through another agent moving the opposite way.
+func (r *ReservationTable) swaps(agent int, a, b, time int32) bool {
+	other, ok := r.reservedBy(b, time)
+	if !ok || other == agent {
+		return false
+	}
+	next, ok := r.reservedBy(a, time+1)
+	return ok && next == other
+}
+
+// Returns true if agent may stay at index from time until the end of the
+// reservations, or of the window.
+func (r *ReservationTable) canRest(agent int, index, time, until int32) bool {
+	if rest, ok := r.resting[index]; ok && rest.agent != agent {
+		return false
+	}
+	for t := time; t <= until; t++ {
+		if r.blocked(agent, index, t) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *ReservationTable) getDijkstraMap(goal GridPoint, opts PathOptions) (m *DijkstraMap) {
+	var (
+		key = dijkstraMapKey{r.Grid.Index(goal.X, goal.Y), opts.Diagonals}
+		ok  bool
+	)
+	if m, ok = r.maps[key]; !ok {
+		m = r.Grid.GetDijkstraMap([]GridPoint{goal}, opts)
+		r.maps[key] = m
+	}
+	return
+}
+
+type spaceTimeNode struct {
+	spaceTimeKey
+	g      float32
+	f      float32
+	parent *spaceTimeNode
+	open   int
+}
+
+type spaceTimeQueue []*spaceTimeNode
+
+func (q spaceTimeQueue) Len() int {
+	return len(q)
+}
+
+func (q spaceTimeQueue) Less(i, j int) bool {
+	if q[i].f == q[j].f {
+		return q[i].g > q[j].g
+	}
+	return q[i].f < q[j].f
+}
+
+func (q spaceTimeQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].open = i
+	q[j].open = j
+}
+
+func (q *spaceTimeQueue) Push(x interface{}) {
+	var n = x.(*spaceTimeNode)
+	n.open = len(*q)
+	*q = append(*q, n)
+}
+
+func (q *spaceTimeQueue) Pop() interface{} {
+	var (
+		old = *q
+		n   = old[len(old)-1]
+	)
+	*q = old[:len(old)-1]
+	n.open = -1
+	return n
+}
+
+// Plans a path for agent from x1, y1 at time to x2, y2 which avoids the
+// cells reserved by other agents, and reserves it.  True distances to the
+// goal, cached until the grid changes, guide the search.  opts.Algorithm is
+// ignored.
+func (r *ReservationTable) GetPath(agent int, x1, y1, x2, y2, time int32, opts PathOptions) (out []GridPoint, err error) {
+	var (
+		g        = r.Grid
+		start    = g.Index(x1, y1)
+		goal     = g.Index(x2, y2)
+		distance *DijkstraMap
+		nodes    = map[spaceTimeKey]*spaceTimeNode{}
+		queue    = &spaceTimeQueue{}
+		limit    int32
+		until    int32
+		current  *spaceTimeNode
+	)
+	if start == -1 || goal == -1 || !g.walkable(x1, y1) {
+		err = fmt.Errorf("No path found")
+		return
+	}
+	distance = r.getDijkstraMap(GridPoint{x2, y2}, opts)
+	if !distance.Reachable(x1, y1) {
+		err = fmt.Errorf("No path found")
+		return
+	}
+	if rest, ok := r.resting[goal]; ok && rest.agent != agent && r.Window == 0 {
+		// Another agent keeps the goal forever, so no arrival could rest.
+		err = fmt.Errorf("No path found")
+		return
+	}
+	if r.Window > 0 {
+		limit = r.Window
+		until = time + r.Window
+	} else {
+		// Long enough to wait out every reservation and then walk anywhere.
+		limit = r.horizon - time + int32(len(g.points))
+		until = r.horizon
+	}
+	current = &spaceTimeNode{
+		spaceTimeKey: spaceTimeKey{start, time},
+		f:            distance.Distances[start],
+	}
+	nodes[current.spaceTimeKey] = current
+	heap.Push(queue, current)
+	for expanded := 0; queue.Len() > 0; expanded++ {
+		if r.MaxNodes > 0 && expanded >= r.MaxNodes {
+			break
+		}
+		current = heap.Pop(queue).(*spaceTimeNode)
+		var depth = current.time - time
+		if current.index == goal && r.canRest(agent, goal, current.time, until) {
+			out = current.points(g)
+			r.Reserve(agent, out, time, true)
+			return
+		}
+		if r.Window > 0 && depth >= r.Window {
+			out = current.points(g)
+			r.Reserve(agent, out, time, false)
+			return append(out, r.descend(distance, current.index, opts)...), nil
+		}
+		if depth >= limit {
+			continue
+		}
+		var (
+			cx, cy = g.Coords(current.index)
+			from   = current
+			next   = current.time + 1
+		)
+		var visit = func(index int32, cost float32) {
+			if r.blocked(agent, index, next) || r.swaps(agent, from.index, index, from.time) {
+				return
+			}
+			var (
+				key   = spaceTimeKey{index, next}
+				n     = nodes[key]
+				total = from.g + cost
+			)
+			if n == nil {
+				n = &spaceTimeNode{spaceTimeKey: key, open: -1}
+				nodes[key] = n
+			} else if total >= n.g {
+				return
+			}
+			n.g = total
+			n.f = total + distance.Distances[index]
+			n.parent = from
+			if n.open >= 0 {
+				heap.Fix(queue, n.open)
+			} else {
+				heap.Push(queue, n)
+			}
+		}
+		visit(current.index, r.WaitCost)
+		g.eachNeighbor(cx, cy, opts.Diagonals, func(nx, ny int32, dist float32) {
+			visit(g.Index(nx, ny), dist*g.movementCost(nx, ny))
+		})
+	}
+	err = fmt.Errorf("No path found")
+	return
+}
+
+// Plans and reserves paths for each request in turn, using the request ID
+// as the agent.  Earlier requests get priority, so callers may want to vary
+// the order between calls.  Stops at the first request which fails.
+func (r *ReservationTable) PlanPaths(requests []PathRequest, time int32) (paths [][]GridPoint, err error) {
+	paths = make([][]GridPoint, len(requests))
+	for _, req := range requests {
+		r.Release(req.ID)
+	}
+	for i, req := range requests {
+		if paths[i], err = r.GetPath(req.ID, req.From.X, req.From.Y, req.To.X, req.To.Y, time, req.Options); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Follows the map downhill from index to its goal, not including index.
+func (r *ReservationTable) descend(m *DijkstraMap, index int32, opts PathOptions) (out []GridPoint) {
+	var g = r.Grid
+	for m.Distances[index] > 0 {
+		var (
+			x, y = g.Coords(index)
+			best = float32(math.Inf(1))
+			next = int32(-1)
+		)
+		g.eachNeighbor(x, y, opts.Diagonals, func(nx, ny int32, dist float32) {
+			var n = g.Index(nx, ny)
+			if d := dist*g.movementCost(nx, ny) + m.Distances[n]; d < best {
+				best = d
+				next = n
+			}
+		})
+		if next == -1 || m.Distances[next] >= m.Distances[index] {
+			return
+		}
+		index = next
+		out = append(out, GridPoint{})
+		out[len(out)-1].X, out[len(out)-1].Y = g.Coords(index)
+	}
+	return
+}
+
+// Follows parent links back to the first node.
+func (n *spaceTimeNode) points(g *Grid) (out []GridPoint) {
+	var count = 0
+	for p := n; p != nil; p = p.parent {
+		count++
+	}
+	out = make([]GridPoint, count)
+	for p := n; p != nil; p = p.parent {
+		count--
+		out[count].X, out[count].Y = g.Coords(p.index)
+	}
+	return
+}
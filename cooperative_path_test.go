@@ -0,0 +1,142 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"testing"
+)
+
+// Checks that no two agents share a cell or swap cells at any step.  Agents
+// stay on their last cell once their path ends.
+func checkNoConflicts(t *testing.T, paths [][]GridPoint) {
+	var (
+		steps = 0
+		at    = func(path []GridPoint, step int) GridPoint {
+			if step >= len(path) {
+				return path[len(path)-1]
+			}
+			return path[step]
+		}
+	)
+	for _, path := range paths {
+		if len(path) > steps {
+			steps = len(path)
+		}
+	}
+	for step := 0; step < steps; step++ {
+		for i := range paths {
+			for j := i + 1; j < len(paths); j++ {
+				if at(paths[i], step) == at(paths[j], step) {
+					t.Fatalf("Agents %v and %v both at %v at step %v", i, j, at(paths[i], step), step)
+				}
+				if step > 0 && at(paths[i], step) == at(paths[j], step-1) && at(paths[j], step) == at(paths[i], step-1) {
+					t.Fatalf("Agents %v and %v swap at step %v", i, j, step)
+				}
+			}
+		}
+	}
+}
+
+func TestCooperativePathWaits(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"#.#",
+			"...",
+			"#.#",
+		)
+		r = NewReservationTable(g, 0)
+	)
+	defer r.Delete()
+	paths, err := r.PlanPaths([]PathRequest{
+		{ID: 1, From: GridPoint{0, 1}, To: GridPoint{2, 1}},
+		{ID: 2, From: GridPoint{1, 2}, To: GridPoint{1, 0}},
+	}, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkNoConflicts(t, paths)
+	if len(paths[1]) != 4 || paths[1][0] != paths[1][1] {
+		t.Fatalf("Expected second agent to wait a step, got %v", paths[1])
+	}
+}
+
+func TestCooperativePathUsesAlcove(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"#.####",
+			"......",
+		)
+		r = NewReservationTable(g, 0)
+	)
+	defer r.Delete()
+	paths, err := r.PlanPaths([]PathRequest{
+		{ID: 1, From: GridPoint{4, 0}, To: GridPoint{0, 0}},
+		{ID: 2, From: GridPoint{0, 0}, To: GridPoint{5, 0}},
+	}, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkNoConflicts(t, paths)
+	for _, pt := range paths[1] {
+		if pt == (GridPoint{1, 1}) {
+			return
+		}
+	}
+	t.Fatalf("Expected second agent to step into the alcove, got %v", paths[1])
+}
+
+func TestCooperativePathWindow(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"..........",
+			"..........",
+		)
+		r = NewReservationTable(g, 3)
+	)
+	defer r.Delete()
+	path, err := r.GetPath(1, 0, 0, 9, 0, 10, PathOptions{})
+	if err != nil || len(path) != 10 || path[9] != (GridPoint{9, 0}) {
+		t.Fatalf("Expected full path past the window, got %v %v", path, err)
+	}
+	if agent, ok := r.ReservedBy(3, 0, 13); !ok || agent != 1 {
+		t.Fatalf("Expected reservation at end of window")
+	}
+	if _, ok := r.ReservedBy(4, 0, 14); ok {
+		t.Fatalf("Expected no reservation past the window")
+	}
+	r.Release(1)
+	if _, ok := r.ReservedBy(3, 0, 13); ok {
+		t.Fatalf("Expected release to drop reservations")
+	}
+}
+
+func TestCooperativePathGoalTaken(t *testing.T) {
+	var (
+		g = NewGrid(48, 48, 1)
+		r = NewReservationTable(g, 0)
+	)
+	defer r.Delete()
+	if _, err := r.GetPath(1, 0, 0, 47, 47, 0, PathOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := r.GetPath(2, 47, 0, 47, 47, 0, PathOptions{}); err == nil {
+		t.Fatalf("Expected no path to a goal another agent rests on")
+	}
+	// Resting elsewhere, the goal is only held for a while.
+	r.MaxNodes = 10
+	if _, err := r.GetPath(3, 0, 47, 47, 0, 0, PathOptions{}); err == nil {
+		t.Fatalf("Expected search to stop at MaxNodes")
+	}
+}
@@ -63,3 +63,11 @@ type TexturedTile interface {
 	ScaledBounds(ratio float32) (x, y, w, h float32)
 	ScaledTextureBounds(rx float32, ry float32) (x, y, w, h float32)
 }
+
+// TexturedTiles may also implement TransposedTile to swap the x and y axes
+// of their texture, which along with negative texture widths and heights
+// allows tiles to be drawn rotated by 90 degree steps.
+type TransposedTile interface {
+	TexturedTile
+	Transposed() bool
+}
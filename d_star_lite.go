@@ -0,0 +1,340 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The optimized version of D* Lite from "D* Lite", Koenig & Likhachev, 2002.
+
+package twodee
+
+import (
+	"fmt"
+	"math"
+)
+
+// Slack allowed for rounding when comparing keys against the start.
+const dstarTolerance = 0.001
+
+type dstarKey [2]float32
+
+func (a dstarKey) less(b dstarKey) bool {
+	return a[0] < b[0] || (a[0] == b[0] && a[1] < b[1])
+}
+
+// Indexed binary heap of grid indices ordered by key.
+type dstarQueue struct {
+	heap []int32
+	pos  []int32 // Position of each cell in heap, or -1.
+	keys []dstarKey
+}
+
+func newDStarQueue(size int32) (q *dstarQueue) {
+	q = &dstarQueue{
+		pos:  make([]int32, size),
+		keys: make([]dstarKey, size),
+	}
+	for i := range q.pos {
+		q.pos[i] = -1
+	}
+	return
+}
+
+func (q *dstarQueue) Len() int {
+	return len(q.heap)
+}
+
+func (q *dstarQueue) top() (i int32, key dstarKey) {
+	i = q.heap[0]
+	return i, q.keys[i]
+}
+
+// Inserts i, or moves it if it is already queued.
+func (q *dstarQueue) set(i int32, key dstarKey) {
+	var p = q.pos[i]
+	q.keys[i] = key
+	if p == -1 {
+		p = int32(len(q.heap))
+		q.pos[i] = p
+		q.heap = append(q.heap, i)
+	}
+	q.up(p)
+	q.down(q.pos[i])
+}
+
+func (q *dstarQueue) remove(i int32) {
+	var (
+		p    = q.pos[i]
+		last = int32(len(q.heap) - 1)
+	)
+	if p == -1 {
+		return
+	}
+	q.swap(p, last)
+	q.heap = q.heap[:last]
+	q.pos[i] = -1
+	if p < last {
+		q.up(p)
+		q.down(p)
+	}
+}
+
+func (q *dstarQueue) less(a, b int32) bool {
+	return q.keys[q.heap[a]].less(q.keys[q.heap[b]])
+}
+
+func (q *dstarQueue) swap(a, b int32) {
+	q.heap[a], q.heap[b] = q.heap[b], q.heap[a]
+	q.pos[q.heap[a]] = a
+	q.pos[q.heap[b]] = b
+}
+
+func (q *dstarQueue) up(j int32) {
+	for j > 0 {
+		i := (j - 1) / 2
+		if !q.less(j, i) {
+			break
+		}
+		q.swap(i, j)
+		j = i
+	}
+}
+
+func (q *dstarQueue) down(i int32) {
+	var n = int32(len(q.heap))
+	for {
+		j := 2*i + 1
+		if j >= n {
+			break
+		}
+		if r := j + 1; r < n && q.less(r, j) {
+			j = r
+		}
+		if !q.less(j, i) {
+			break
+		}
+		q.swap(i, j)
+		i = j
+	}
+}
+
+// Plans a path to a fixed goal which is repaired, rather than searched again
+// from scratch, as the agent moves and the grid changes.  Changes made with
+// Grid.Set are picked up automatically.  Costs are the same as for
+// GetPathWithOptions; opts.Algorithm is ignored.
+type DynamicPathfinder struct {
+	Grid       *Grid
+	Options    PathOptions
+	heuristic  PathHeuristic
+	start      int32
+	goal       int32
+	last       int32 // Start when keys were last adjusted.
+	km         float32
+	g          []float32
+	rhs        []float32
+	queue      *dstarQueue
+	changed    []int32
+	observerId int
+}
+
+func NewDynamicPathfinder(g *Grid, x1, y1, x2, y2 int32, opts PathOptions) (d *DynamicPathfinder) {
+	d = &DynamicPathfinder{
+		Grid:      g,
+		Options:   opts,
+		heuristic: opts.heuristic(),
+	}
+	d.reset(g.Index(x1, y1), g.Index(x2, y2))
+	d.observerId = g.AddChangeObserver(d.onChange)
+	return
+}
+
+// Stops listening for changes to the grid.
+func (d *DynamicPathfinder) Delete() {
+	d.Grid.RemoveChangeObserver(d.observerId)
+}
+
+func (d *DynamicPathfinder) reset(start, goal int32) {
+	var (
+		size = int32(len(d.Grid.points))
+		inf  = float32(math.Inf(1))
+	)
+	d.start = start
+	d.goal = goal
+	d.last = start
+	d.km = 0
+	d.g = make([]float32, size)
+	d.rhs = make([]float32, size)
+	d.queue = newDStarQueue(size)
+	d.changed = d.changed[:0]
+	for i := range d.g {
+		d.g[i] = inf
+		d.rhs[i] = inf
+	}
+	if start != -1 && goal != -1 {
+		d.rhs[goal] = 0
+		d.queue.set(goal, d.key(goal))
+	}
+}
+
+// Moves the start of the path, as when the agent takes a step.
+func (d *DynamicPathfinder) Move(x, y int32) {
+	d.start = d.Grid.Index(x, y)
+}
+
+// Plans towards a new goal.  This discards all previous work.
+func (d *DynamicPathfinder) SetGoal(x, y int32) {
+	d.reset(d.start, d.Grid.Index(x, y))
+}
+
+func (d *DynamicPathfinder) onChange(x, y int32, old, val GridItem) {
+	d.changed = append(d.changed, d.Grid.Index(x, y))
+}
+
+func (d *DynamicPathfinder) h(i int32) float32 {
+	var (
+		sx, sy = d.Grid.Coords(d.start)
+		x, y   = d.Grid.Coords(i)
+	)
+	return d.heuristic(absInt32(sx-x), absInt32(sy-y))
+}
+
+func (d *DynamicPathfinder) key(i int32) dstarKey {
+	var m = d.g[i]
+	if d.rhs[i] < m {
+		m = d.rhs[i]
+	}
+	return dstarKey{m + d.h(i) + d.km, m}
+}
+
+// Recomputes the cost of reaching the goal from i via its neighbours and
+// queues i if that differs from its current cost.
+func (d *DynamicPathfinder) updateVertex(i int32) {
+	var (
+		grid = d.Grid
+		x, y = grid.Coords(i)
+	)
+	if i != d.goal {
+		d.rhs[i] = float32(math.Inf(1))
+		if grid.walkable(x, y) {
+			grid.eachNeighbor(x, y, d.Options.Diagonals, func(nx, ny int32, dist float32) {
+				var n = grid.Index(nx, ny)
+				if cost := dist*grid.movementCost(nx, ny) + d.g[n]; cost < d.rhs[i] {
+					d.rhs[i] = cost
+				}
+			})
+		}
+	}
+	if d.g[i] != d.rhs[i] {
+		d.queue.set(i, d.key(i))
+	} else {
+		d.queue.remove(i)
+	}
+}
+
+func (d *DynamicPathfinder) updateNeighbors(i int32) {
+	var (
+		grid = d.Grid
+		x, y = grid.Coords(i)
+	)
+	grid.eachNeighbor(x, y, d.Options.Diagonals, func(nx, ny int32, dist float32) {
+		d.updateVertex(grid.Index(nx, ny))
+	})
+}
+
+// Applies changes to the grid since the last call.  A changed cell affects
+// the steps into and out of it, and through corner cutting, the diagonal
+// steps between its neighbours, so it and all of its neighbours are updated.
+func (d *DynamicPathfinder) applyChanges() {
+	var grid = d.Grid
+	if d.start != d.last {
+		d.km += d.h(d.last)
+		d.last = d.start
+	}
+	for _, i := range d.changed {
+		var x, y = grid.Coords(i)
+		d.updateVertex(i)
+		for dir := 0; dir < 8; dir++ {
+			if n := grid.Index(x+jumpXs[dir], y+jumpYs[dir]); n != -1 {
+				d.updateVertex(n)
+			}
+		}
+	}
+	d.changed = d.changed[:0]
+}
+
+func (d *DynamicPathfinder) computeShortestPath() {
+	for d.queue.Len() > 0 {
+		var u, old = d.queue.top()
+		// Cells tied with the start may be on its path, and rounding can
+		// put them just above it, so keep going until they are handled.
+		if old[0] > d.key(d.start)[0]+dstarTolerance && d.rhs[d.start] == d.g[d.start] {
+			return
+		}
+		switch key := d.key(u); {
+		case old.less(key):
+			d.queue.set(u, key)
+		case d.g[u] > d.rhs[u]:
+			d.g[u] = d.rhs[u]
+			d.queue.remove(u)
+			d.updateNeighbors(u)
+		default:
+			d.g[u] = float32(math.Inf(1))
+			d.updateVertex(u)
+			d.updateNeighbors(u)
+		}
+	}
+}
+
+// Returns the cheapest path from the current start to the goal, repairing
+// the plan for any changes since the last call.
+func (d *DynamicPathfinder) GetPath() (out []GridPoint, err error) {
+	var (
+		grid    = d.Grid
+		current = d.start
+	)
+	if d.start == -1 || d.goal == -1 {
+		err = fmt.Errorf("No path found")
+		return
+	}
+	d.applyChanges()
+	d.computeShortestPath()
+	if math.IsInf(float64(d.g[d.start]), 1) {
+		err = fmt.Errorf("No path found")
+		return
+	}
+	for {
+		var (
+			x, y = grid.Coords(current)
+			best = float32(math.Inf(1))
+			next = int32(-1)
+		)
+		out = append(out, GridPoint{x, y})
+		if current == d.goal {
+			return
+		}
+		if len(out) > len(grid.points) {
+			err = fmt.Errorf("No path found")
+			return nil, err
+		}
+		grid.eachNeighbor(x, y, d.Options.Diagonals, func(nx, ny int32, dist float32) {
+			var n = grid.Index(nx, ny)
+			if cost := dist*grid.movementCost(nx, ny) + d.g[n]; cost < best {
+				best = cost
+				next = n
+			}
+		})
+		if next == -1 {
+			err = fmt.Errorf("No path found")
+			return nil, err
+		}
+		current = next
+	}
+}
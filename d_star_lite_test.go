@@ -0,0 +1,91 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestDynamicPathMatchesAStar(t *testing.T) {
+	var modes = []DiagonalMode{DiagonalNever, DiagonalAlways, DiagonalNoObstacles}
+	for seed := int64(0); seed < 10; seed++ {
+		for _, mode := range modes {
+			var (
+				g     = newRandomGrid(seed, 24, 0.25)
+				r     = rand.New(rand.NewSource(seed))
+				opts  = PathOptions{Diagonals: mode}
+				start = GridPoint{0, 0}
+				goal  = GridPoint{23, 23}
+				d     = NewDynamicPathfinder(g, start.X, start.Y, goal.X, goal.Y, opts)
+			)
+			for step := 0; step < 20; step++ {
+				expected, experr := g.GetPathWithOptions(start.X, start.Y, goal.X, goal.Y, opts)
+				path, err := d.GetPath()
+				if (err == nil) != (experr == nil) {
+					t.Fatalf("Seed %v mode %v step %v: got error %v, A* got %v (g %v rhs %v)", seed, mode, step, err, experr, d.g[d.start], d.rhs[d.start])
+				}
+				if err == nil {
+					if path[0] != start || path[len(path)-1] != goal {
+						t.Fatalf("Path %v does not join %v and %v", path, start, goal)
+					}
+					if cost, want := pathCost(g, path), pathCost(g, expected); cost-want > 0.001 || want-cost > 0.001 {
+						t.Fatalf("Seed %v step %v: found cost %v, A* found %v", seed, step, cost, want)
+					}
+					if len(path) > 1 {
+						start = path[1]
+						d.Move(start.X, start.Y)
+					}
+				}
+				// Toggle a few cells away from the agent and goal.
+				for i := 0; i < 5; i++ {
+					var x, y = r.Int31n(24), r.Int31n(24)
+					if (GridPoint{x, y}) == start || (GridPoint{x, y}) == goal {
+						continue
+					}
+					if g.walkable(x, y) {
+						g.Set(x, y, testGridItem{blocked: true})
+					} else {
+						g.Set(x, y, testGridItem{cost: float32(1 + r.Intn(3))})
+					}
+				}
+			}
+			d.Delete()
+		}
+	}
+}
+
+func BenchmarkDynamicPathRepair256(b *testing.B) {
+	var (
+		g    = newRandomGrid(1, 256, 0.1)
+		opts = PathOptions{Diagonals: DiagonalNoObstacles}
+		d    = NewDynamicPathfinder(g, 0, 0, 255, 255, opts)
+	)
+	defer d.Delete()
+	if _, err := d.GetPath(); err != nil {
+		b.Fatalf("Expected path: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Open and close a door in the middle of the map.
+		if i%2 == 0 {
+			g.Set(128, 128, testGridItem{blocked: true})
+		} else {
+			g.Set(128, 128, nil)
+		}
+		d.GetPath()
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// Holds the cost of the cheapest path from every cell of a grid to the
+// nearest goal.  Unreachable cells hold +Inf.
+type DijkstraMap struct {
+	Grid      *Grid
+	Diagonals DiagonalMode
+	Distances []float32 // Stored in Grid.Index order.
+}
+
+// Builds a map of distances to the closest of goals.  Only the Diagonals
+// setting of opts is used.  Goals which are blocked are ignored.
+func (g *Grid) GetDijkstraMap(goals []GridPoint, opts PathOptions) *DijkstraMap {
+	var (
+		seeds  = make([]int32, 0, len(goals))
+		values = make([]float32, 0, len(goals))
+	)
+	for _, goal := range goals {
+		if g.walkable(goal.X, goal.Y) {
+			seeds = append(seeds, g.Index(goal.X, goal.Y))
+			values = append(values, 0)
+		}
+	}
+	return &DijkstraMap{
+		Grid:      g,
+		Diagonals: opts.Diagonals,
+		Distances: g.dijkstra(seeds, values, opts.Diagonals),
+	}
+}
+
+// Runs Dijkstra's algorithm outwards from seeds, each starting with the
+// matching entry of values.  Costs are those of moving from a cell towards
+// the seeds, so entering the cell closer to a seed is what gets charged.
+func (g *Grid) dijkstra(seeds []int32, values []float32, mode DiagonalMode) (out []float32) {
+	var (
+		search  = g.getPathSearch()
+		current int32
+		cx, cy  int32
+		cost    float32
+		i       int32
+	)
+	defer g.putPathSearch(search)
+	for j, seed := range seeds {
+		search.relax(seed, values[j], values[j], -1)
+	}
+	for search.Len() > 0 {
+		current = search.pop()
+		cx, cy = g.Coords(current)
+		cost = g.movementCost(cx, cy)
+		g.eachNeighbor(cx, cy, mode, func(nx, ny int32, dist float32) {
+			var d = search.nodes[current].g + dist*cost
+			search.relax(g.Index(nx, ny), d, d, current)
+		})
+	}
+	out = make([]float32, len(search.nodes))
+	for i = 0; i < int32(len(out)); i++ {
+		if search.seen(i) {
+			out[i] = search.nodes[i].g
+		} else {
+			out[i] = float32(math.Inf(1))
+		}
+	}
+	return
+}
+
+func (m *DijkstraMap) Distance(x, y int32) float32 {
+	var index = m.Grid.Index(x, y)
+	if index == -1 {
+		return float32(math.Inf(1))
+	}
+	return m.Distances[index]
+}
+
+func (m *DijkstraMap) Reachable(x, y int32) bool {
+	return !math.IsInf(float64(m.Distance(x, y)), 1)
+}
+
+// Builds a map for fleeing from the goals of m.  Distances are scaled by
+// -coefficient and then smoothed so that following the returned map downhill
+// leads away from the goals, but around dead ends rather than into them.
+// Values a little over 1 (1.2 is common) work well.
+func (m *DijkstraMap) FleeMap(coefficient float32) *DijkstraMap {
+	var (
+		seeds  = make([]int32, 0, len(m.Distances))
+		values = make([]float32, 0, len(m.Distances))
+	)
+	for i, d := range m.Distances {
+		if !math.IsInf(float64(d), 1) {
+			seeds = append(seeds, int32(i))
+			values = append(values, -coefficient*d)
+		}
+	}
+	return &DijkstraMap{
+		Grid:      m.Grid,
+		Diagonals: m.Diagonals,
+		Distances: m.Grid.dijkstra(seeds, values, m.Diagonals),
+	}
+}
+
+type flowStep struct {
+	dx int8
+	dy int8
+}
+
+// Stores, for every cell of a grid, the direction of the neighbouring cell
+// which leads most quickly downhill on a DijkstraMap.
+type FlowField struct {
+	Grid  *Grid
+	steps []flowStep
+}
+
+// Builds a flow field leading down the map.  Goals, unreachable cells and
+// local minima have no direction.  To walk up the gradient instead, build
+// the flow field from FleeMap.
+func (m *DijkstraMap) FlowField() *FlowField {
+	var (
+		g     = m.Grid
+		steps = make([]flowStep, len(m.Distances))
+		i     int32
+	)
+	for i = 0; i < int32(len(steps)); i++ {
+		var (
+			here   = m.Distances[i]
+			best   = float32(math.Inf(1))
+			x, y   = g.Coords(i)
+			bestDx int32
+			bestDy int32
+		)
+		if math.IsInf(float64(here), 1) {
+			continue
+		}
+		// Of the neighbours further down the map, picks the one which is
+		// cheapest to reach the goal through, counting the step into it.
+		g.eachNeighbor(x, y, m.Diagonals, func(nx, ny int32, dist float32) {
+			var d = m.Distances[g.Index(nx, ny)]
+			if d >= here {
+				return
+			}
+			if total := dist*g.movementCost(nx, ny) + d; total < best {
+				best = total
+				bestDx = nx - x
+				bestDy = ny - y
+			}
+		})
+		steps[i] = flowStep{int8(bestDx), int8(bestDy)}
+	}
+	return &FlowField{
+		Grid:  g,
+		steps: steps,
+	}
+}
+
+// Returns the offset of the next cell to move to from x, y.  Returns false
+// if there is no better cell to move to.
+func (f *FlowField) Direction(x, y int32) (dx, dy int32, ok bool) {
+	var index = f.Grid.Index(x, y)
+	if index == -1 {
+		return
+	}
+	dx = int32(f.steps[index].dx)
+	dy = int32(f.steps[index].dy)
+	ok = dx != 0 || dy != 0
+	return
+}
+
+// Returns a unit vector in world space pointing along the flow field at pos,
+// or a zero vector if there is nowhere to go.
+func (f *FlowField) WorldDirection(pos mgl32.Vec2) mgl32.Vec2 {
+	var (
+		x          = f.Grid.GridPosition(pos[0])
+		y          = f.Grid.GridPosition(pos[1])
+		dx, dy, ok = f.Direction(x, y)
+	)
+	if !ok {
+		return mgl32.Vec2{}
+	}
+	return mgl32.Vec2{float32(dx), float32(dy)}.Normalize()
+}
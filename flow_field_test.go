@@ -0,0 +1,125 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"testing"
+)
+
+func TestDijkstraMapDistances(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"...#.",
+			".#.#.",
+			".1...",
+		)
+		m = g.GetDijkstraMap([]GridPoint{{0, 0}}, PathOptions{})
+	)
+	if d := m.Distance(0, 0); d != 0 {
+		t.Fatalf("Expected goal distance 0, got %v", d)
+	}
+	if d := m.Distance(2, 0); d != 2 {
+		t.Fatalf("Expected distance 2 through cost 1 cell, got %v", d)
+	}
+	if d := m.Distance(4, 2); d != 6 {
+		t.Fatalf("Expected distance 6, got %v", d)
+	}
+	if m.Reachable(3, 2) {
+		t.Fatalf("Wall should not be reachable")
+	}
+	if d := m.Distance(2, 2); d != 4 {
+		t.Fatalf("Expected distance 4 via either route, got %v", d)
+	}
+}
+
+func TestDijkstraMapMultipleGoals(t *testing.T) {
+	var (
+		g = newTestGrid(".......")
+		m = g.GetDijkstraMap([]GridPoint{{0, 0}, {6, 0}}, PathOptions{})
+	)
+	if d := m.Distance(5, 0); d != 1 {
+		t.Fatalf("Expected distance to nearest goal of 1, got %v", d)
+	}
+}
+
+func TestFlowFieldFollowsPath(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"....",
+			".##.",
+			"....",
+		)
+		m      = g.GetDijkstraMap([]GridPoint{{3, 1}}, PathOptions{})
+		f      = m.FlowField()
+		x, y   = int32(0), int32(1)
+		steps  = 0
+		dx, dy int32
+		ok     bool
+	)
+	for {
+		if dx, dy, ok = f.Direction(x, y); !ok {
+			break
+		}
+		x, y = x+dx, y+dy
+		if steps++; steps > 10 {
+			t.Fatalf("Flow field did not converge")
+		}
+	}
+	if x != 3 || y != 1 || steps != 5 {
+		t.Fatalf("Expected to reach goal in 5 steps, got %v,%v in %v", x, y, steps)
+	}
+	if v := f.WorldDirection(mgl32.Vec2{3.5, 2.5}); v[0] != 0 || v[1] != -1 {
+		t.Fatalf("Expected world direction down, got %v", v)
+	}
+}
+
+func TestFlowFieldAvoidsExpensiveCell(t *testing.T) {
+	// The cell beside the goal is closest to it, but costs 9 to enter,
+	// while the way round the top costs 4.
+	var (
+		g = newTestGrid(
+			"...",
+			".9.",
+		)
+		m = g.GetDijkstraMap([]GridPoint{{2, 0}}, PathOptions{})
+		f = m.FlowField()
+	)
+	if d := m.Distance(0, 0); d != 4 {
+		t.Fatalf("Expected distance 4 around the expensive cell, got %v", d)
+	}
+	if dx, dy, ok := f.Direction(0, 0); !ok || dx != 0 || dy != 1 {
+		t.Fatalf("Expected to step up around the expensive cell, got %v,%v", dx, dy)
+	}
+}
+
+func TestFleeMapLeadsAway(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"......",
+			"......",
+		)
+		m    = g.GetDijkstraMap([]GridPoint{{1, 0}}, PathOptions{})
+		f    = m.FleeMap(1.2).FlowField()
+		x, y = int32(2), int32(0)
+	)
+	for i := 0; i < 3; i++ {
+		var dx, dy, ok = f.Direction(x, y)
+		if !ok || m.Distance(x+dx, y+dy) <= m.Distance(x, y) {
+			t.Fatalf("Step %v from %v,%v did not lead away from goal", i, x, y)
+		}
+		x, y = x+dx, y+dy
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Shadowcasting ported from
+//   https://www.albertford.com/shadowcasting/
+
+package twodee
+
+import (
+	"image"
+	"image/color"
+)
+
+type FOVMode int
+
+const (
+	// Open cells are visible only if their centre can be seen, which makes
+	// visibility symmetric: if a can see b then b can see a.  Opaque cells
+	// are visible if any part of them can be seen.
+	FOVSymmetric FOVMode = iota
+	// Walls cast the same shadows as in FOVSymmetric, but every cell which
+	// any line of sight from the origin's centre passes through is visible,
+	// including open cells whose centre is hidden.
+	FOVPermissive
+)
+
+// A visibility bitmap over a grid.
+type FieldOfView struct {
+	Grid    *Grid
+	Visible []bool // Stored in Grid.Index order.
+}
+
+func NewFieldOfView(g *Grid) *FieldOfView {
+	return &FieldOfView{
+		Grid:    g,
+		Visible: make([]bool, g.Width*g.Height),
+	}
+}
+
+// Returns every cell visible from x, y within radius cells.  Cells holding
+// items which are Opaque() block sight; cells outside the grid are treated
+// as opaque.
+func (g *Grid) GetFieldOfView(x, y, radius int32, mode FOVMode) (f *FieldOfView) {
+	f = NewFieldOfView(g)
+	f.Update(x, y, radius, mode)
+	return
+}
+
+// Recomputes the visible cells in place, so that callers updating every
+// frame don't need to allocate a new bitmap.
+func (f *FieldOfView) Update(x, y, radius int32, mode FOVMode) {
+	var i int
+	for i = range f.Visible {
+		f.Visible[i] = false
+	}
+	if !f.Grid.InBounds(x, y) {
+		return
+	}
+	f.reveal(x, y)
+	for i = 0; i < 4; i++ {
+		s := &shadowcaster{
+			fov:    f,
+			mode:   mode,
+			radius: radius,
+			ox:     x,
+			oy:     y,
+			dir:    i,
+		}
+		s.scan(1, fovSlope{-1, 1}, fovSlope{1, 1})
+	}
+}
+
+func (f *FieldOfView) IsVisible(x, y int32) bool {
+	var index = f.Grid.Index(x, y)
+	return index != -1 && f.Visible[index]
+}
+
+func (f *FieldOfView) reveal(x, y int32) {
+	if index := f.Grid.Index(x, y); index != -1 {
+		f.Visible[index] = true
+	}
+}
+
+// Returns an image of the bitmap laid out like Grid.GetImage, which may be
+// uploaded as a texture for fog of war.
+func (f *FieldOfView) GetImage(visible, hidden color.Color) *image.NRGBA {
+	var (
+		img = image.NewNRGBA(image.Rect(0, 0, int(f.Grid.Width), int(f.Grid.Height)))
+	)
+	for x := 0; x < int(f.Grid.Width); x++ {
+		for y := 0; y < int(f.Grid.Height); y++ {
+			if f.IsVisible(int32(x), int32(y)) {
+				img.Set(x, y, visible)
+			} else {
+				img.Set(x, y, hidden)
+			}
+		}
+	}
+	return img
+}
+
+// An exact rational slope n/d, with d > 0.
+type fovSlope struct {
+	n int32
+	d int32
+}
+
+func floorDiv(a, b int32) int32 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+// Scans one quadrant, in coordinates where depth increases away from the
+// origin and col runs across it.
+type shadowcaster struct {
+	fov    *FieldOfView
+	mode   FOVMode
+	radius int32
+	ox     int32
+	oy     int32
+	dir    int
+}
+
+func (s *shadowcaster) transform(depth, col int32) (x, y int32) {
+	switch s.dir {
+	case 0: // North
+		return s.ox + col, s.oy + depth
+	case 1: // East
+		return s.ox + depth, s.oy + col
+	case 2: // South
+		return s.ox + col, s.oy - depth
+	default: // West
+		return s.ox - depth, s.oy + col
+	}
+}
+
+func (s *shadowcaster) opaque(depth, col int32) bool {
+	var (
+		x, y = s.transform(depth, col)
+		g    = s.fov.Grid
+	)
+	if !g.InBounds(x, y) {
+		return true
+	}
+	item := g.Get(x, y)
+	return item != nil && item.Opaque()
+}
+
+func (s *shadowcaster) scan(depth int32, start, end fovSlope) {
+	var (
+		// Round depth*start up on ties and depth*end down on ties.
+		minCol  = floorDiv(2*depth*start.n+start.d, 2*start.d)
+		maxCol  = -floorDiv(-(2*depth*end.n - end.d), 2*end.d)
+		col     int32
+		wall    bool
+		prevSet bool
+		prev    bool
+	)
+	if depth > s.radius {
+		return
+	}
+	if s.mode == FOVPermissive {
+		// Lines within the sector cross at most half a tile further
+		// either way than they do through the row's centre.
+		for col = minCol - 1; col <= maxCol+1; col++ {
+			if s.partial(depth, col, start, end) && depth*depth+col*col <= s.radius*s.radius {
+				s.fov.reveal(s.transform(depth, col))
+			}
+		}
+	}
+	for col = minCol; col <= maxCol; col++ {
+		wall = s.opaque(depth, col)
+		if wall || s.symmetric(depth, col, start, end) {
+			if depth*depth+col*col <= s.radius*s.radius {
+				s.fov.reveal(s.transform(depth, col))
+			}
+		}
+		if prevSet && prev && !wall {
+			// Leaving a wall; the visible sector starts at this tile.
+			start = fovSlope{2*col - 1, 2 * depth}
+		}
+		if prevSet && !prev && wall {
+			// Entering a wall; scan the visible sector up to here.
+			s.scan(depth+1, start, fovSlope{2*col - 1, 2 * depth})
+		}
+		prev = wall
+		prevSet = true
+	}
+	if prevSet && !prev {
+		s.scan(depth+1, start, end)
+	}
+}
+
+// Returns true if the centre of the tile lies within the sector.
+func (s *shadowcaster) symmetric(depth, col int32, start, end fovSlope) bool {
+	return col*start.d >= depth*start.n && col*end.d <= depth*end.n
+}
+
+// Returns true if a line from the origin's centre within the sector, other
+// than one only touching a corner, passes through the tile.
+func (s *shadowcaster) partial(depth, col int32, start, end fovSlope) bool {
+	var lo, hi fovSlope
+	if 2*col-1 >= 0 {
+		lo = fovSlope{2*col - 1, 2*depth + 1}
+	} else {
+		lo = fovSlope{2*col - 1, 2*depth - 1}
+	}
+	if 2*col+1 >= 0 {
+		hi = fovSlope{2*col + 1, 2*depth - 1}
+	} else {
+		hi = fovSlope{2*col + 1, 2*depth + 1}
+	}
+	return lo.n*end.d < end.n*lo.d && hi.n*start.d > start.n*hi.d
+}
@@ -0,0 +1,115 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"testing"
+)
+
+func TestFieldOfViewOpenRoom(t *testing.T) {
+	var (
+		g = newTestGrid(
+			".......",
+			".......",
+			".......",
+			".......",
+			".......",
+		)
+		f = g.GetFieldOfView(3, 2, 10, FOVSymmetric)
+	)
+	for i, v := range f.Visible {
+		if !v {
+			x, y := g.Coords(int32(i))
+			t.Fatalf("Expected %v,%v to be visible", x, y)
+		}
+	}
+	f.Update(3, 2, 1, FOVSymmetric)
+	if !f.IsVisible(4, 2) || f.IsVisible(5, 2) || f.IsVisible(4, 3) {
+		t.Fatalf("Radius not respected")
+	}
+}
+
+func TestFieldOfViewWallBlocks(t *testing.T) {
+	var (
+		g = newTestGrid(
+			".......",
+			"...#...",
+			".......",
+		)
+		f = g.GetFieldOfView(3, 0, 10, FOVSymmetric)
+	)
+	if !f.IsVisible(3, 1) {
+		t.Fatalf("Expected wall to be visible")
+	}
+	if f.IsVisible(3, 2) {
+		t.Fatalf("Expected cell behind wall to be hidden")
+	}
+	if !f.IsVisible(0, 2) || !f.IsVisible(6, 2) {
+		t.Fatalf("Expected cells around wall to be visible")
+	}
+}
+
+func TestFieldOfViewSymmetric(t *testing.T) {
+	for seed := int64(0); seed < 5; seed++ {
+		var (
+			g  = newRandomGrid(seed, 12, 0.25)
+			fa = NewFieldOfView(g)
+			fb = NewFieldOfView(g)
+		)
+		for a := int32(0); a < 144; a++ {
+			ax, ay := g.Coords(a)
+			if g.Get(ax, ay).Opaque() {
+				continue
+			}
+			fa.Update(ax, ay, 20, FOVSymmetric)
+			for b := int32(0); b < 144; b++ {
+				bx, by := g.Coords(b)
+				if !fa.Visible[b] || g.Get(bx, by).Opaque() {
+					continue
+				}
+				if fb.Update(bx, by, 20, FOVSymmetric); !fb.Visible[a] {
+					t.Fatalf("Seed %v: %v,%v sees %v,%v but not vice versa", seed, ax, ay, bx, by)
+				}
+			}
+		}
+	}
+}
+
+func TestFieldOfViewPermissive(t *testing.T) {
+	var (
+		g = newRandomGrid(3, 16, 0.3)
+		s = g.GetFieldOfView(8, 8, 8, FOVSymmetric)
+		p = g.GetFieldOfView(8, 8, 8, FOVPermissive)
+	)
+	for i := range s.Visible {
+		if s.Visible[i] && !p.Visible[i] {
+			t.Fatalf("Permissive view should include every symmetric cell")
+		}
+	}
+	// The wall hides the centre of 3,3 but not its lower left corner.
+	g = newTestGrid(
+		".....",
+		".....",
+		".....",
+		"..#..",
+		".....",
+	)
+	if g.GetFieldOfView(2, 0, 8, FOVSymmetric).IsVisible(3, 3) {
+		t.Fatalf("Expected symmetric view to hide 3,3")
+	}
+	if !g.GetFieldOfView(2, 0, 8, FOVPermissive).IsVisible(3, 3) {
+		t.Fatalf("Expected permissive view to show 3,3")
+	}
+}
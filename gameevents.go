@@ -77,6 +77,17 @@ func (h *GameEventHandler) Enqueue(e GETyper) {
 	}
 }
 
+// Adds e to the queue, waiting while the queue is full.  Returns false
+// without adding e if done is closed first.
+func (h *GameEventHandler) EnqueueWait(e GETyper, done <-chan struct{}) bool {
+	select {
+	case h.gameEvents <- e:
+		return true
+	case <-done:
+		return false
+	}
+}
+
 func (h *GameEventHandler) AddObserver(t GameEventType, c GameEventCallback) (id int) {
 	if h.eventObservers[t] == nil {
 		h.eventObservers[t] = make(GameEventTypeObservers)
@@ -0,0 +1,371 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Procedural map generators.  Each takes a seed and produces the same map
+// for the same seed and grid size, and writes every cell of the grid
+// through a GridItemFactory.
+
+package twodee
+
+import (
+	"math/rand"
+)
+
+// Returns the item to store at x, y.  wall is set for cells which should
+// block movement.
+type GridItemFactory func(x, y int32, wall bool) GridItem
+
+// Holds a map while it is generated, indexed as the Grid it is for.
+type generatedMap struct {
+	grid  *Grid
+	walls []bool
+	rand  *rand.Rand
+}
+
+func newGeneratedMap(g *Grid, seed int64, wall bool) (m *generatedMap) {
+	m = &generatedMap{
+		grid:  g,
+		walls: make([]bool, len(g.points)),
+		rand:  rand.New(rand.NewSource(seed)),
+	}
+	for i := range m.walls {
+		m.walls[i] = wall
+	}
+	return
+}
+
+func (m *generatedMap) wall(x, y int32) bool {
+	if !m.grid.InBounds(x, y) {
+		return true
+	}
+	return m.walls[m.grid.Index(x, y)]
+}
+
+func (m *generatedMap) set(x, y int32, wall bool) {
+	if index := m.grid.Index(x, y); index != -1 {
+		m.walls[index] = wall
+	}
+}
+
+// Returns true for cells on the edge of the map, which are kept as walls.
+func (m *generatedMap) border(x, y int32) bool {
+	return x <= 0 || y <= 0 || x >= m.grid.Width-1 || y >= m.grid.Height-1
+}
+
+func (m *generatedMap) write(item GridItemFactory) {
+	for i, wall := range m.walls {
+		var x, y = m.grid.Coords(int32(i))
+		m.grid.SetIndex(int32(i), item(x, y, wall))
+	}
+}
+
+// Opens an L shaped corridor from x1, y1 to x2, y2.
+func (m *generatedMap) corridor(x1, y1, x2, y2 int32) {
+	var step = func(a, b int32) int32 {
+		if a < b {
+			return 1
+		}
+		return -1
+	}
+	if m.rand.Intn(2) == 0 {
+		for ; x1 != x2; x1 += step(x1, x2) {
+			m.set(x1, y1, false)
+		}
+	}
+	for ; y1 != y2; y1 += step(y1, y2) {
+		m.set(x1, y1, false)
+	}
+	for ; x1 != x2; x1 += step(x1, x2) {
+		m.set(x1, y1, false)
+	}
+	m.set(x2, y2, false)
+}
+
+type BSPOptions struct {
+	MinLeaf int32 // Smallest side of a partition.  Defaults to 8.
+	MinRoom int32 // Smallest side of a room.  Defaults to 3.
+}
+
+// Splits the map into partitions at random until they reach
+// opts.MinLeaf, places a room in each, and joins sibling partitions with
+// corridors.
+func GenerateBSP(g *Grid, seed int64, opts BSPOptions, item GridItemFactory) {
+	var m = newGeneratedMap(g, seed, true)
+	if opts.MinLeaf <= 0 {
+		opts.MinLeaf = 8
+	}
+	if opts.MinRoom <= 0 {
+		opts.MinRoom = 3
+	}
+	if opts.MinRoom > opts.MinLeaf-2 {
+		opts.MinRoom = maxInt32(opts.MinLeaf-2, 1)
+	}
+	m.bsp(1, 1, g.Width-2, g.Height-2, opts)
+	m.write(item)
+	ConnectRegions(g, 0, item)
+}
+
+// Fills the partition at x, y of size w, h and returns a point in one of
+// its rooms.
+func (m *generatedMap) bsp(x, y, w, h int32, opts BSPOptions) (px, py int32) {
+	var (
+		r        = m.rand
+		vertical bool
+	)
+	switch {
+	case w < 2*opts.MinLeaf && h < 2*opts.MinLeaf:
+		return m.room(x, y, w, h, opts)
+	case h < 2*opts.MinLeaf:
+		vertical = true
+	case w < 2*opts.MinLeaf:
+		vertical = false
+	case w*4 > h*5:
+		vertical = true
+	case h*4 > w*5:
+		vertical = false
+	default:
+		vertical = r.Intn(2) == 0
+	}
+	var ax, ay, bx, by int32
+	if vertical {
+		var split = opts.MinLeaf + r.Int31n(w-2*opts.MinLeaf+1)
+		ax, ay = m.bsp(x, y, split, h, opts)
+		bx, by = m.bsp(x+split, y, w-split, h, opts)
+	} else {
+		var split = opts.MinLeaf + r.Int31n(h-2*opts.MinLeaf+1)
+		ax, ay = m.bsp(x, y, w, split, opts)
+		bx, by = m.bsp(x, y+split, w, h-split, opts)
+	}
+	m.corridor(ax, ay, bx, by)
+	if r.Intn(2) == 0 {
+		return ax, ay
+	}
+	return bx, by
+}
+
+// Opens a room inside the partition at x, y of size w, h, leaving a wall
+// around it, and returns its middle.
+func (m *generatedMap) room(x, y, w, h int32, opts BSPOptions) (px, py int32) {
+	var (
+		r    = m.rand
+		size = func(space int32) int32 {
+			if space <= opts.MinRoom {
+				return maxInt32(space, 1)
+			}
+			return opts.MinRoom + r.Int31n(space-opts.MinRoom+1)
+		}
+		rw = size(w - 2)
+		rh = size(h - 2)
+		rx = x + 1 + r.Int31n(maxInt32(w-2-rw, 0)+1)
+		ry = y + 1 + r.Int31n(maxInt32(h-2-rh, 0)+1)
+	)
+	for j := ry; j < ry+rh; j++ {
+		for i := rx; i < rx+rw; i++ {
+			m.set(i, j, false)
+		}
+	}
+	return rx + rw/2, ry + rh/2
+}
+
+type CaveOptions struct {
+	Fill      float32 // Share of cells which start as walls.  Defaults to 0.45.
+	Steps     int     // Rounds of smoothing.  Defaults to 5.
+	Birth     int     // Open cells with this many wall neighbours become walls.  Defaults to 5.
+	Survival  int     // Walls with this many wall neighbours stay.  Defaults to 4.
+	MinRegion int     // Open areas smaller than this are filled in.
+}
+
+// Scatters walls at random and smooths them with a cellular automaton into
+// caves.  Separate caves are joined with tunnels.
+func GenerateCave(g *Grid, seed int64, opts CaveOptions, item GridItemFactory) {
+	var m = newGeneratedMap(g, seed, true)
+	if opts.Fill <= 0 {
+		opts.Fill = 0.45
+	}
+	if opts.Steps <= 0 {
+		opts.Steps = 5
+	}
+	if opts.Birth <= 0 {
+		opts.Birth = 5
+	}
+	if opts.Survival <= 0 {
+		opts.Survival = 4
+	}
+	for i := range m.walls {
+		var x, y = g.Coords(int32(i))
+		m.walls[i] = m.border(x, y) || m.rand.Float32() < opts.Fill
+	}
+	for step := 0; step < opts.Steps; step++ {
+		var next = make([]bool, len(m.walls))
+		for i := range m.walls {
+			var (
+				x, y  = g.Coords(int32(i))
+				walls = 0
+			)
+			for dy := int32(-1); dy <= 1; dy++ {
+				for dx := int32(-1); dx <= 1; dx++ {
+					if (dx != 0 || dy != 0) && m.wall(x+dx, y+dy) {
+						walls++
+					}
+				}
+			}
+			if m.walls[i] {
+				next[i] = walls >= opts.Survival
+			} else {
+				next[i] = walls >= opts.Birth
+			}
+			next[i] = next[i] || m.border(x, y)
+		}
+		m.walls = next
+	}
+	m.write(item)
+	ConnectRegions(g, opts.MinRegion, item)
+}
+
+type WalkOptions struct {
+	Coverage float32 // Share of the map to open.  Defaults to 0.4.
+	MaxSteps int     // Defaults to 100 steps per cell.
+}
+
+// Opens cells along a random walk from the middle of the map until enough
+// of it is open.
+func GenerateDrunkardsWalk(g *Grid, seed int64, opts WalkOptions, item GridItemFactory) {
+	var (
+		m    = newGeneratedMap(g, seed, true)
+		x    = g.Width / 2
+		y    = g.Height / 2
+		open = 0
+		want int
+	)
+	if opts.Coverage <= 0 {
+		opts.Coverage = 0.4
+	}
+	if opts.MaxSteps <= 0 {
+		opts.MaxSteps = 100 * len(m.walls)
+	}
+	want = int(opts.Coverage * float32((g.Width-2)*(g.Height-2)))
+	for step := 0; step < opts.MaxSteps && open < want; step++ {
+		if m.wall(x, y) && !m.border(x, y) {
+			m.set(x, y, false)
+			open++
+		}
+		var (
+			dir    = m.rand.Intn(len(cardinalXs))
+			nx, ny = x + cardinalXs[dir], y + cardinalYs[dir]
+		)
+		if !m.border(nx, ny) {
+			x, y = nx, ny
+		}
+	}
+	m.write(item)
+	ConnectRegions(g, 0, item)
+}
+
+// Makes every open cell of g reachable from every other without diagonal
+// moves.  Open areas smaller than minSize are filled with walls, except
+// the largest, and the rest are joined to the largest by the shortest
+// tunnels through the walls, avoiding the edge of the map.  Areas which
+// only walls on the edge cut off are filled in.  Cells are replaced
+// through item.  Returns the number of areas joined.
+func ConnectRegions(g *Grid, minSize int, item GridItemFactory) (joined int) {
+	var (
+		regions   = g.LabelRegions(DiagonalNever)
+		labels    = regions.Labels
+		largest   = int32(0)
+		connected = make([]bool, len(g.points))
+	)
+	if len(regions.Regions) == 0 {
+		return
+	}
+	for _, region := range regions.Regions {
+		if region.Size > regions.Regions[largest].Size {
+			largest = region.Label
+		}
+	}
+	for i, label := range labels {
+		var x, y = g.Coords(int32(i))
+		switch {
+		case label == -1:
+		case label == largest:
+			connected[i] = true
+		case regions.Regions[label].Size < minSize:
+			g.SetIndex(int32(i), item(x, y, true))
+			labels[i] = -1
+		}
+	}
+	for {
+		var found = g.tunnel(labels, connected, item)
+		if found == -1 {
+			break
+		}
+		joined++
+		for i, label := range labels {
+			if label == found {
+				connected[i] = true
+			}
+		}
+	}
+	for i, label := range labels {
+		if label != -1 && !connected[i] {
+			var x, y = g.Coords(int32(i))
+			g.SetIndex(int32(i), item(x, y, true))
+		}
+	}
+	return
+}
+
+// Searches outward from the connected cells for the nearest open cell
+// which is not connected, opens the cells between them, and returns that
+// cell's label.  Returns -1 if every open cell is connected.
+func (g *Grid) tunnel(labels []int32, connected []bool, item GridItemFactory) int32 {
+	var (
+		parents = make([]int32, len(g.points))
+		queue   []int32
+	)
+	for i := range parents {
+		parents[i] = -2
+		if connected[i] {
+			parents[i] = -1
+			queue = append(queue, int32(i))
+		}
+	}
+	for len(queue) > 0 {
+		var (
+			index  = queue[0]
+			cx, cy = g.Coords(index)
+		)
+		queue = queue[1:]
+		if labels[index] != -1 && !connected[index] {
+			for p := parents[index]; p != -1 && !connected[p]; p = parents[p] {
+				var x, y = g.Coords(p)
+				g.SetIndex(p, item(x, y, false))
+				connected[p] = true
+			}
+			return labels[index]
+		}
+		for d := range cardinalXs {
+			var (
+				nx, ny = cx + cardinalXs[d], cy + cardinalYs[d]
+				n      = g.Index(nx, ny)
+				edge   = nx <= 0 || ny <= 0 || nx >= g.Width-1 || ny >= g.Height-1
+			)
+			if n == -1 || parents[n] != -2 || (edge && labels[n] == -1) {
+				continue
+			}
+			parents[n] = index
+			queue = append(queue, n)
+		}
+	}
+	return -1
+}
@@ -0,0 +1,185 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"testing"
+)
+
+func testGridItemFactory(x, y int32, wall bool) GridItem {
+	return testGridItem{blocked: wall}
+}
+
+func gridWalls(g *Grid) (out []bool) {
+	out = make([]bool, len(g.points))
+	for i := range out {
+		var x, y = g.Coords(int32(i))
+		out[i] = !g.walkable(x, y)
+	}
+	return
+}
+
+func checkGenerated(t *testing.T, name string, generate func(g *Grid, seed int64)) {
+	var (
+		a = NewGrid(48, 32, 1)
+		b = NewGrid(48, 32, 1)
+		c = NewGrid(48, 32, 1)
+	)
+	generate(a, 7)
+	generate(b, 7)
+	generate(c, 8)
+	var wa, wb, wc = gridWalls(a), gridWalls(b), gridWalls(c)
+	var same, open = true, 0
+	for i := range wa {
+		if wa[i] != wb[i] {
+			t.Fatalf("%v: same seed gave different maps", name)
+		}
+		if wa[i] != wc[i] {
+			same = false
+		}
+		if !wa[i] {
+			open++
+		}
+	}
+	if same {
+		t.Fatalf("%v: different seeds gave the same map", name)
+	}
+	if open < 48*32/10 {
+		t.Fatalf("%v: expected open space, got %v cells", name, open)
+	}
+	for x := int32(0); x < 48; x++ {
+		if a.walkable(x, 0) || a.walkable(x, 31) {
+			t.Fatalf("%v: expected walls along the edge", name)
+		}
+	}
+	if regions := a.LabelRegions(DiagonalNever); len(regions.Regions) != 1 {
+		t.Fatalf("%v: expected one connected area, got %v", name, regions.Regions)
+	}
+}
+
+func TestGenerateBSP(t *testing.T) {
+	checkGenerated(t, "BSP", func(g *Grid, seed int64) {
+		GenerateBSP(g, seed, BSPOptions{}, testGridItemFactory)
+	})
+}
+
+func TestGenerateCave(t *testing.T) {
+	checkGenerated(t, "Cave", func(g *Grid, seed int64) {
+		GenerateCave(g, seed, CaveOptions{MinRegion: 4}, testGridItemFactory)
+	})
+}
+
+func TestGenerateDrunkardsWalk(t *testing.T) {
+	checkGenerated(t, "Walk", func(g *Grid, seed int64) {
+		GenerateDrunkardsWalk(g, seed, WalkOptions{}, testGridItemFactory)
+	})
+}
+
+func TestConnectRegions(t *testing.T) {
+	var g = newTestGrid(
+		"#######",
+		"#..#..#",
+		"#..#..#",
+		"####.##",
+		"#.#####",
+		"#######",
+	)
+	if joined := ConnectRegions(g, 2, testGridItemFactory); joined != 1 {
+		t.Fatalf("Expected one area joined, got %v", joined)
+	}
+	if g.walkable(1, 1) {
+		t.Fatalf("Expected small area to be filled")
+	}
+	if regions := g.LabelRegions(DiagonalNever); len(regions.Regions) != 1 || regions.Regions[0].Size != 10 {
+		t.Fatalf("Expected a single area joined by one cell, got %v", regions.Regions)
+	}
+}
+
+func TestSolveWFC(t *testing.T) {
+	// Tile 0 and 1 alternate, so the only tilings are checkerboards.
+	var rules = NewWFCRules([]float32{1, 1})
+	rules.AllowAll(0, 1)
+	tiles, err := SolveWFC(6, 4, 3, rules, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, tile := range tiles {
+		var x, y = int32(i) % 6, int32(i) / 6
+		if tile != (tiles[0]+int(x+y))%2 {
+			t.Fatalf("Expected checkerboard, got %v", tiles)
+		}
+	}
+	again, _ := SolveWFC(6, 4, 3, rules, 1)
+	for i := range tiles {
+		if tiles[i] != again[i] {
+			t.Fatalf("Expected the same tiling for the same seed")
+		}
+	}
+	// Tile 2 may only sit north of itself, so it cannot fill a row.
+	rules = NewWFCRules([]float32{0, 0, 1})
+	rules.Allow(2, 2, WFCNorth)
+	if _, err = SolveWFC(3, 3, 1, rules, 3); err == nil {
+		t.Fatalf("Expected error for impossible rules")
+	}
+}
+
+func TestGenerateWFC(t *testing.T) {
+	var (
+		g     = NewGrid(8, 8, 1)
+		rules = NewWFCRules([]float32{3, 1})
+	)
+	rules.AllowAll(0, 0)
+	rules.AllowAll(0, 1)
+	tiles, err := GenerateWFC(g, 5, rules, 5, 0, 1, func(x, y int32, tile int) GridItem {
+		return testGridItem{blocked: tile == 1}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, tile := range tiles {
+		if tile == 1 && g.GetIndex(int32(i)).Passable() != true {
+			t.Fatalf("Expected walls for tile 1")
+		}
+	}
+	// Walls never touch, so open cells are always connected.
+	if regions := g.LabelRegions(DiagonalNever); len(regions.Regions) != 1 {
+		t.Fatalf("Expected one open area, got %v", regions.Regions)
+	}
+}
+
+func TestGenerateWFCConnects(t *testing.T) {
+	var (
+		g     = NewGrid(16, 16, 1)
+		rules = NewWFCRules([]float32{1, 1})
+	)
+	// Walls may form any shape, so open areas are cut off without tunnels.
+	rules.AllowAll(0, 0)
+	rules.AllowAll(0, 1)
+	rules.AllowAll(1, 1)
+	tiles, err := GenerateWFC(g, 3, rules, 5, 0, 1, func(x, y int32, tile int) GridItem {
+		return testGridItem{blocked: tile == 1}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if regions := g.LabelRegions(DiagonalNever); len(regions.Regions) != 1 {
+		t.Fatalf("Expected one open area, got %v", len(regions.Regions))
+	}
+	for i, tile := range tiles {
+		if (tile == 1) != g.GetIndex(int32(i)).Passable() {
+			t.Fatalf("Tile %v at %v does not match the grid", tile, i)
+		}
+	}
+}
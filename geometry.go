@@ -16,6 +16,7 @@ package twodee
 
 import (
 	"github.com/go-gl/mathgl/mgl32"
+	"math"
 )
 
 type Point struct {
@@ -42,6 +43,60 @@ func (p Point) DistanceTo(pt Point) float32 {
 	return p.Sub(pt).Len()
 }
 
+func (p Point) Dot(pt Point) float32 {
+	return p.Vec2.Dot(pt.Vec2)
+}
+
+// Returns the z component of the cross product of p and pt, which is
+// positive if pt is counter-clockwise from p.
+func (p Point) Cross(pt Point) float32 {
+	return p.X()*pt.Y() - p.Y()*pt.X()
+}
+
+// Returns p scaled to unit length, or the zero point if p is zero.
+func (p Point) Normalize() Point {
+	var l = p.Len()
+	if l == 0 {
+		return p
+	}
+	return p.Scale(1 / l)
+}
+
+// Returns the point t of the way from p to pt.
+func (p Point) Lerp(pt Point, t float32) Point {
+	return p.Add(pt.Sub(p).Scale(t))
+}
+
+// Returns the angle of p from the x axis in radians, counter-clockwise,
+// between -Pi and Pi.
+func (p Point) Angle() float32 {
+	return float32(math.Atan2(float64(p.Y()), float64(p.X())))
+}
+
+// Returns p rotated around the origin by angle radians counter-clockwise.
+func (p Point) Rotate(angle float32) Point {
+	var (
+		sin = float32(math.Sin(float64(angle)))
+		cos = float32(math.Cos(float64(angle)))
+	)
+	return Pt(p.X()*cos-p.Y()*sin, p.X()*sin+p.Y()*cos)
+}
+
+// Returns p turned a quarter turn counter-clockwise.
+func (p Point) Perp() Point {
+	return Pt(-p.Y(), p.X())
+}
+
+// Returns the part of p which lies along onto, or the zero point if onto
+// is zero.
+func (p Point) Project(onto Point) Point {
+	var l = onto.Dot(onto)
+	if l == 0 {
+		return Point{}
+	}
+	return onto.Scale(p.Dot(onto) / l)
+}
+
 type Rectangle struct {
 	Min Point
 	Max Point
@@ -58,6 +113,75 @@ func (r Rectangle) Midpoint() Point {
 	return Pt((r.Max.X()+r.Min.X())/2.0, (r.Max.Y()+r.Min.Y())/2.0)
 }
 
+func (r Rectangle) Width() float32 {
+	return r.Max.X() - r.Min.X()
+}
+
+func (r Rectangle) Height() float32 {
+	return r.Max.Y() - r.Min.Y()
+}
+
+// Returns true if r has no area.
+func (r Rectangle) Empty() bool {
+	return r.Min.X() >= r.Max.X() || r.Min.Y() >= r.Max.Y()
+}
+
+func (r Rectangle) Translate(v Point) Rectangle {
+	return Rectangle{r.Min.Add(v), r.Max.Add(v)}
+}
+
+// Returns r with each side moved in by d, or out if d is negative.  The
+// result is empty, centered on r, if d is more than half of r's size.
+func (r Rectangle) Inset(d float32) (out Rectangle) {
+	var mid = r.Midpoint()
+	out = Rect(r.Min.X()+d, r.Min.Y()+d, r.Max.X()-d, r.Max.Y()-d)
+	if out.Min.X() > out.Max.X() {
+		out.Min.Vec2[0], out.Max.Vec2[0] = mid.X(), mid.X()
+	}
+	if out.Min.Y() > out.Max.Y() {
+		out.Min.Vec2[1], out.Max.Vec2[1] = mid.Y(), mid.Y()
+	}
+	return
+}
+
+// Returns the smallest rectangle holding both r and s.
+func (r Rectangle) Union(s Rectangle) Rectangle {
+	return Rect(
+		minFloat32(r.Min.X(), s.Min.X()),
+		minFloat32(r.Min.Y(), s.Min.Y()),
+		maxFloat32(r.Max.X(), s.Max.X()),
+		maxFloat32(r.Max.Y(), s.Max.Y()),
+	)
+}
+
+// Returns the area covered by both r and s.  Returns false if they share
+// no area, including when they only touch.
+func (r Rectangle) Intersection(s Rectangle) (out Rectangle, ok bool) {
+	out = Rect(
+		maxFloat32(r.Min.X(), s.Min.X()),
+		maxFloat32(r.Min.Y(), s.Min.Y()),
+		minFloat32(r.Max.X(), s.Max.X()),
+		minFloat32(r.Max.Y(), s.Max.Y()),
+	)
+	if out.Empty() {
+		return Rectangle{}, false
+	}
+	return out, true
+}
+
+// Returns the point in r nearest to a.
+func (r Rectangle) ClampPoint(a Point) Point {
+	return Pt(
+		minFloat32(maxFloat32(a.X(), r.Min.X()), r.Max.X()),
+		minFloat32(maxFloat32(a.Y(), r.Min.Y()), r.Max.Y()),
+	)
+}
+
+// Returns the smallest rectangle holding r and a.
+func (r Rectangle) ExpandToInclude(a Point) Rectangle {
+	return r.Union(Rectangle{a, a})
+}
+
 func (r Rectangle) Overlaps(s Rectangle) bool {
 	return s.Min.X() < r.Max.X() && s.Max.X() > r.Min.X() &&
 		s.Min.Y() < r.Max.Y() && s.Max.Y() > r.Min.Y()
@@ -83,7 +207,7 @@ func (r Rectangle) IntersectedBy(a, b Point) bool {
 		// the rectangle. There may be a collision.
 		corners := []Point{
 			Pt(r.Min.X(), r.Min.Y()),
-			Pt(r.Min.Y(), r.Max.Y()),
+			Pt(r.Min.X(), r.Max.Y()),
 			Pt(r.Max.X(), r.Min.Y()),
 			Pt(r.Max.X(), r.Max.Y()),
 		}
@@ -104,3 +228,17 @@ func GetVectorDeterminantEquation(a, b Point) func(Point) float32 {
 		return (p.X()-a.X())*(b.Y()-a.Y()) - (p.Y()-a.Y())*(b.X()-a.X())
 	}
 }
+
+func minFloat32(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFloat32(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
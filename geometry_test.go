@@ -0,0 +1,177 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"math"
+	"testing"
+)
+
+func closePt(a, b Point) bool {
+	return closeTo(a.X(), b.X()) && closeTo(a.Y(), b.Y())
+}
+
+func TestPointAlgebra(t *testing.T) {
+	var (
+		a = Pt(3, 4)
+		b = Pt(1, 0)
+	)
+	if a.Dot(b) != 3 || b.Cross(a) != 4 || a.Cross(b) != -4 {
+		t.Fatalf("Unexpected dot %v or cross %v", a.Dot(b), b.Cross(a))
+	}
+	if !closePt(a.Normalize(), Pt(0.6, 0.8)) || (Point{}).Normalize() != (Point{}) {
+		t.Fatalf("Unexpected normal %v", a.Normalize())
+	}
+	if a.Lerp(Pt(5, 0), 0.5) != Pt(4, 2) {
+		t.Fatalf("Unexpected lerp %v", a.Lerp(Pt(5, 0), 0.5))
+	}
+	if !closeTo(Pt(0, 2).Angle(), math.Pi/2) || !closeTo(Pt(-1, 0).Angle(), math.Pi) {
+		t.Fatalf("Unexpected angle %v", Pt(0, 2).Angle())
+	}
+	if !closePt(b.Rotate(math.Pi/2), Pt(0, 1)) || b.Perp() != Pt(0, 1) {
+		t.Fatalf("Unexpected rotation %v", b.Rotate(math.Pi/2))
+	}
+	if a.Project(Pt(2, 0)) != Pt(3, 0) || a.Project(Point{}) != (Point{}) {
+		t.Fatalf("Unexpected projection %v", a.Project(Pt(2, 0)))
+	}
+}
+
+func TestRectangleAlgebra(t *testing.T) {
+	var (
+		a = Rect(0, 0, 4, 2)
+		b = Rect(2, 1, 6, 5)
+	)
+	if a.Width() != 4 || a.Height() != 2 {
+		t.Fatalf("Unexpected size %v, %v", a.Width(), a.Height())
+	}
+	if a.Union(b) != Rect(0, 0, 6, 5) {
+		t.Fatalf("Unexpected union %v", a.Union(b))
+	}
+	if out, ok := a.Intersection(b); !ok || out != Rect(2, 1, 4, 2) {
+		t.Fatalf("Unexpected intersection %v", out)
+	}
+	if _, ok := a.Intersection(Rect(4, 0, 5, 1)); ok {
+		t.Fatalf("Touching rectangles should not intersect")
+	}
+	if a.Inset(0.5) != Rect(0.5, 0.5, 3.5, 1.5) || a.Inset(-1) != Rect(-1, -1, 5, 3) {
+		t.Fatalf("Unexpected inset %v", a.Inset(0.5))
+	}
+	if out := a.Inset(1.5); out != Rect(1.5, 1, 2.5, 1) || !out.Empty() {
+		t.Fatalf("Unexpected inset %v", out)
+	}
+	if a.Translate(Pt(1, -1)) != Rect(1, -1, 5, 1) {
+		t.Fatalf("Unexpected translation %v", a.Translate(Pt(1, -1)))
+	}
+	if a.ClampPoint(Pt(-1, 1)) != Pt(0, 1) || a.ClampPoint(Pt(5, 3)) != Pt(4, 2) {
+		t.Fatalf("Unexpected clamp %v", a.ClampPoint(Pt(-1, 1)))
+	}
+	if a.ExpandToInclude(Pt(-1, 3)) != Rect(-1, 0, 4, 3) {
+		t.Fatalf("Unexpected expansion %v", a.ExpandToInclude(Pt(-1, 3)))
+	}
+}
+
+func TestRectangleIntersectedBy(t *testing.T) {
+	var r = Rect(2, 0, 4, 1)
+	// Only crosses the top left corner, which used to be misplaced.
+	if !r.IntersectedBy(Pt(1.5, 0.9), Pt(2.5, 1.1)) {
+		t.Fatalf("Expected line to cross the top left corner")
+	}
+	if r.IntersectedBy(Pt(0, 0.5), Pt(1, 0.5)) {
+		t.Fatalf("Line to the left should not intersect")
+	}
+}
+
+// Returns a rectangle with min and max in order, built from any floats.
+func fuzzRect(x1, y1, x2, y2 float32) Rectangle {
+	return Rect(
+		minFloat32(x1, x2), minFloat32(y1, y2),
+		maxFloat32(x1, x2), maxFloat32(y1, y2),
+	)
+}
+
+func fuzzFinite(vals ...float32) bool {
+	for _, v := range vals {
+		if math.IsNaN(float64(v)) || math.Abs(float64(v)) > 1e6 {
+			return false
+		}
+	}
+	return true
+}
+
+func FuzzRectangleSetOperations(f *testing.F) {
+	f.Add(float32(0), float32(0), float32(4), float32(2), float32(2), float32(1), float32(6), float32(5), float32(3), float32(-1))
+	f.Add(float32(-1), float32(-1), float32(1), float32(1), float32(2), float32(2), float32(3), float32(3), float32(0), float32(0))
+	f.Fuzz(func(t *testing.T, ax1, ay1, ax2, ay2, bx1, by1, bx2, by2, px, py float32) {
+		if !fuzzFinite(ax1, ay1, ax2, ay2, bx1, by1, bx2, by2, px, py) {
+			return
+		}
+		var (
+			a     = fuzzRect(ax1, ay1, ax2, ay2)
+			b     = fuzzRect(bx1, by1, bx2, by2)
+			p     = Pt(px, py)
+			union = a.Union(b)
+		)
+		if union != b.Union(a) {
+			t.Fatalf("Union of %v and %v is not symmetric", a, b)
+		}
+		for _, c := range []Point{a.Min, a.Max, b.Min, b.Max} {
+			if !union.ContainsPoint(c) {
+				t.Fatalf("Union %v misses %v", union, c)
+			}
+		}
+		if out, ok := a.Intersection(b); !a.Empty() && !b.Empty() && ok != a.Overlaps(b) {
+			t.Fatalf("Intersection of %v and %v disagrees with Overlaps", a, b)
+		} else if ok && (out.Empty() || !a.ContainsPoint(out.Min) || !b.ContainsPoint(out.Max)) {
+			t.Fatalf("Intersection %v of %v and %v is outside them", out, a, b)
+		}
+		if c := a.ClampPoint(p); !a.ContainsPoint(c) || (a.ContainsPoint(p) && c != p) {
+			t.Fatalf("Clamping %v to %v gave %v", p, a, c)
+		}
+		if e := a.ExpandToInclude(p); !e.ContainsPoint(p) || e.Union(a) != e {
+			t.Fatalf("Expanding %v to %v gave %v", a, p, e)
+		}
+		if in := a.Inset(px); in.Width() < 0 || in.Height() < 0 {
+			t.Fatalf("Inset %v of %v is inside out", in, a)
+		}
+	})
+}
+
+func FuzzPointRotate(f *testing.F) {
+	f.Add(float32(3), float32(4), float32(1))
+	f.Add(float32(-2), float32(0.5), float32(-7))
+	f.Fuzz(func(t *testing.T, x, y, angle float32) {
+		if !fuzzFinite(x, y, angle) || math.Abs(float64(x)) > 1e3 || math.Abs(float64(y)) > 1e3 {
+			return
+		}
+		var (
+			p       = Pt(x, y)
+			r       = p.Rotate(angle)
+			back    = r.Rotate(-angle)
+			epsilon = 1e-4 * (1 + float64(p.Len()))
+		)
+		if math.Abs(float64(r.Len()-p.Len())) > epsilon {
+			t.Fatalf("Rotating %v by %v changed its length to %v", p, angle, r.Len())
+		}
+		if back.DistanceTo(p) > float32(epsilon) {
+			t.Fatalf("Rotating %v back gave %v", p, back)
+		}
+		if p.Perp().Dot(p) != 0 {
+			t.Fatalf("Perp of %v is not perpendicular", p)
+		}
+		if proj := p.Project(r); math.Abs(float64(p.Sub(proj).Dot(r))) > 1e-4*(1+float64(p.Len()*r.Len())) {
+			t.Fatalf("Projection of %v onto %v leaves a parallel part", p, r)
+		}
+	})
+}
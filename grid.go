@@ -18,6 +18,7 @@ import (
 	"github.com/go-gl/mathgl/mgl32"
 	"image"
 	"image/color"
+	"sync"
 )
 
 type GridItem interface {
@@ -25,11 +26,26 @@ type GridItem interface {
 	Opaque() bool
 }
 
+// GridItems may also implement WeightedGridItem to make the pathfinder
+// prefer or avoid them.  Items which do not are charged a cost of 1.
+type WeightedGridItem interface {
+	GridItem
+	MovementCost() float32
+}
+
+// Called after the item at x, y changes from old to val.
+type GridChangeCallback func(x, y int32, old, val GridItem)
+
 type Grid struct {
-	Width     int32
-	Height    int32
-	BlockSize float32
-	points    []GridItem
+	Width          int32
+	Height         int32
+	BlockSize      float32
+	points         []GridItem
+	pathPool       sync.Pool
+	jumps          *jumpTable
+	jumpsMutex     sync.Mutex
+	observers      map[int]GridChangeCallback
+	nextObserverId int
 }
 
 func NewGrid(w, h, blocksize int32) *Grid {
@@ -42,18 +58,39 @@ func NewGrid(w, h, blocksize int32) *Grid {
 }
 
 func (g *Grid) Index(x, y int32) int32 {
-	if x < 0 || y < 0 {
+	if !g.InBounds(x, y) {
 		return -1
 	}
 	return g.Width*(g.Height-y-1) + x
 }
 
+// Returns a new grid holding the same items, which may be searched from
+// other goroutines while this one is modified.  Items are shared, so they
+// should not be changed in place.
+func (g *Grid) Copy() *Grid {
+	var out = NewGrid(g.Width, g.Height, 0)
+	out.BlockSize = g.BlockSize
+	copy(out.points, g.points)
+	return out
+}
+
+// Returns the coordinates of the cell stored at index; the inverse of Index.
+func (g *Grid) Coords(index int32) (x, y int32) {
+	x = index % g.Width
+	y = g.Height - index/g.Width - 1
+	return
+}
+
+func (g *Grid) InBounds(x, y int32) bool {
+	return x >= 0 && y >= 0 && x < g.Width && y < g.Height
+}
+
 func (g *Grid) Get(x, y int32) GridItem {
 	return g.GetIndex(g.Index(x, y))
 }
 
 func (g *Grid) GetIndex(index int32) GridItem {
-	if index < 0 || index > g.Width*g.Height {
+	if index < 0 || index >= g.Width*g.Height {
 		return nil
 	}
 	return g.points[index]
@@ -64,10 +101,32 @@ func (g *Grid) Set(x, y int32, val GridItem) {
 }
 
 func (g *Grid) SetIndex(index int32, val GridItem) {
-	if index < 0 || index > g.Width*g.Height {
+	if index < 0 || index >= g.Width*g.Height {
 		return
 	}
+	var old = g.points[index]
 	g.points[index] = val
+	g.invalidateJumps(index, old, val)
+	if len(g.observers) > 0 {
+		x, y := g.Coords(index)
+		for _, observer := range g.observers {
+			observer(x, y, old, val)
+		}
+	}
+}
+
+func (g *Grid) AddChangeObserver(c GridChangeCallback) (id int) {
+	if g.observers == nil {
+		g.observers = make(map[int]GridChangeCallback)
+	}
+	id = g.nextObserverId
+	g.observers[id] = c
+	g.nextObserverId++
+	return
+}
+
+func (g *Grid) RemoveChangeObserver(id int) {
+	delete(g.observers, id)
 }
 
 func (g *Grid) GetImage(fg, bg color.Color) *image.NRGBA {
@@ -88,40 +147,10 @@ func (g *Grid) GetImage(fg, bg color.Color) *image.NRGBA {
 	return img
 }
 
-func (g *Grid) squareCollides(bounds mgl32.Vec4, x, y float32) bool {
-	// Bounds are {minx, miny, maxx, maxy}
-	// Sizex, sizey are the number of coordinate units a grid entry occupies.
-	var (
-		size  = g.BlockSize
-		fudge = float32(0.001) // Prevents item from sticking to wall when we round its coordinates.
-		minx  = int32((bounds[0] + x) / size)
-		miny  = int32((bounds[1] + y) / size)
-		maxx  = int32((bounds[2] + x - fudge) / size)
-		maxy  = int32((bounds[3] + y - fudge) / size)
-		i     int32
-		j     int32
-		item  GridItem
-	)
-	for i = minx; i <= maxx; i++ {
-		for j = miny; j <= maxy; j++ {
-			item = g.Get(i, j)
-			if item != nil && item.Passable() {
-				return true
-			}
-		}
-	}
-	return false
-}
-
+// Bounds are {minx, miny, maxx, maxy}.  See SweepMove for details of how
+// collisions are resolved.
 func (g *Grid) FixMove(bounds mgl32.Vec4, move mgl32.Vec2) (out mgl32.Vec2) {
-	out = move
-	if g.squareCollides(bounds, out[0], 0.0) {
-		out[0] = g.GridAligned(bounds[0]) - bounds[0]
-	}
-	if g.squareCollides(bounds, out[0], out[1]) {
-		out[1] = g.GridAligned(bounds[1]) - bounds[1]
-	}
-	return
+	return g.SweepMove(Rect(bounds[0], bounds[1], bounds[2], bounds[3]), move).Move
 }
 
 func (g *Grid) GridAligned(x float32) float32 {
@@ -137,33 +166,6 @@ func (g *Grid) InversePosition(i int32) float32 {
 }
 
 func (g *Grid) CanSee(from, to mgl32.Vec2) bool {
-	var (
-		size  = g.BlockSize
-		minx  = int32(from[0] / size)
-		maxx  = int32(to[0] / size)
-		miny  = int32(from[1] / size)
-		maxy  = int32(to[1] / size)
-		slope = float32(maxy-miny) / float32(maxx-minx)
-		c     = float32(miny) - (slope * float32(minx))
-		x     int32
-		y     int32
-		item  GridItem
-	)
-	for x = minx; x <= maxx; x++ {
-		y = int32(slope*float32(x) + c)
-		item = g.Get(x, y)
-		if item != nil && item.Opaque() {
-			// Something blocks the way
-			return false
-		}
-	}
-	for y = miny; y <= maxy; y++ {
-		x = int32((float32(y) - c) / slope)
-		item = g.Get(x, y)
-		if item != nil && item.Opaque() {
-			// Something blocks the way
-			return false
-		}
-	}
-	return true
+	_, blocked := g.Raycast(from, to, OpaqueItem)
+	return !blocked
 }
@@ -0,0 +1,288 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+)
+
+// Maps the colours of a level image to grid items.  Colours with a nil
+// item leave their cells empty.
+type GridPalette map[color.NRGBA]GridItem
+
+// Builds a grid with a cell for each pixel of img, which must only use
+// colours from palette.  The first row of the image is the bottom row of
+// the grid, as GetImage writes it and as textures are laid out, so images
+// from GetImage load back unchanged.  Levels drawn in an editor, top row
+// first, should be flipped vertically before loading.
+func NewGridFromImage(img image.Image, palette GridPalette, blockSize int32) (g *Grid, err error) {
+	var bounds = img.Bounds()
+	g = NewGrid(int32(bounds.Dx()), int32(bounds.Dy()), blockSize)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var (
+				c        = color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				item, ok = palette[c]
+				gx, gy   = int32(x - bounds.Min.X), int32(y - bounds.Min.Y)
+			)
+			if !ok {
+				return nil, fmt.Errorf("Unknown colour %v at %v, %v", c, x, y)
+			}
+			g.Set(gx, gy, item)
+		}
+	}
+	return
+}
+
+// Loads a grid from a PNG.  See NewGridFromImage.
+func LoadGridImage(path string, palette GridPalette, blockSize int32) (g *Grid, err error) {
+	var img image.Image
+	if img, err = loadPNG(path); err != nil {
+		return
+	}
+	return NewGridFromImage(img, palette, blockSize)
+}
+
+// Builds a grid from rows of text, top row first, with legend giving the
+// item for each character.  Rows may be shorter than the widest, leaving
+// the rest of the row empty, and blank lines at either end are ignored.
+func ParseGridText(text string, legend map[rune]GridItem, blockSize int32) (g *Grid, err error) {
+	var (
+		rows  = strings.Split(strings.Trim(strings.Replace(text, "\r", "", -1), "\n"), "\n")
+		width = 0
+	)
+	for _, row := range rows {
+		if n := len([]rune(row)); n > width {
+			width = n
+		}
+	}
+	g = NewGrid(int32(width), int32(len(rows)), blockSize)
+	for i, row := range rows {
+		var x int32
+		for _, c := range row {
+			item, ok := legend[c]
+			if !ok {
+				return nil, fmt.Errorf("Unknown character %q at %v, %v", c, x, i)
+			}
+			g.Set(x, int32(len(rows)-i-1), item)
+			x++
+		}
+	}
+	return
+}
+
+// Loads a grid from a text file.  See ParseGridText.
+func LoadGridText(path string, legend map[rune]GridItem, blockSize int32) (g *Grid, err error) {
+	var contents []byte
+	if contents, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	return ParseGridText(string(contents), legend, blockSize)
+}
+
+// Converts grid items to bytes and back for saving grids.  Items which
+// encode to the same bytes are stored once, so encodings should be short
+// and identify the kind of item rather than the cell.  Nil items are
+// handled by the grid and never passed in.  Encodings saved as JSON should
+// be UTF-8 text.
+type GridItemMarshaller interface {
+	MarshalGridItem(item GridItem) ([]byte, error)
+	UnmarshalGridItem(data []byte) (GridItem, error)
+}
+
+// Returns the distinct encodings of the grid's items and, for each cell in
+// grid index order, 0 for an empty cell or one more than the position of
+// its encoding.
+func (g *Grid) encodeItems(m GridItemMarshaller) (palette []string, cells []uint32, err error) {
+	var indices = map[string]uint32{}
+	cells = make([]uint32, len(g.points))
+	for i, item := range g.points {
+		if item == nil {
+			continue
+		}
+		var data []byte
+		if data, err = m.MarshalGridItem(item); err != nil {
+			return
+		}
+		index, ok := indices[string(data)]
+		if !ok {
+			palette = append(palette, string(data))
+			index = uint32(len(palette))
+			indices[string(data)] = index
+		}
+		cells[i] = index
+	}
+	return
+}
+
+func decodeGrid(width, height int32, blockSize float32, palette []string, cells []uint32, m GridItemMarshaller) (g *Grid, err error) {
+	var items = make([]GridItem, len(palette))
+	if width < 0 || height < 0 || len(cells) != int(width)*int(height) {
+		return nil, fmt.Errorf("Expected %v by %v cells, got %v", width, height, len(cells))
+	}
+	for i, data := range palette {
+		if items[i], err = m.UnmarshalGridItem([]byte(data)); err != nil {
+			return
+		}
+	}
+	g = NewGrid(width, height, 0)
+	g.BlockSize = blockSize
+	for i, cell := range cells {
+		if cell > uint32(len(items)) {
+			return nil, fmt.Errorf("Unknown item %v in cell %v", cell, i)
+		}
+		if cell > 0 {
+			g.points[i] = items[cell-1]
+		}
+	}
+	return
+}
+
+type gridJSON struct {
+	Width     int32    `json:"width"`
+	Height    int32    `json:"height"`
+	BlockSize float32  `json:"blockSize"`
+	Items     []string `json:"items"`
+	Cells     []uint32 `json:"cells"` // In index order, top row first.
+}
+
+// Writes the grid as JSON, with items encoded by m.
+func (g *Grid) WriteJSON(w io.Writer, m GridItemMarshaller) (err error) {
+	var out = gridJSON{
+		Width:     g.Width,
+		Height:    g.Height,
+		BlockSize: g.BlockSize,
+	}
+	if out.Items, out.Cells, err = g.encodeItems(m); err != nil {
+		return
+	}
+	return json.NewEncoder(w).Encode(out)
+}
+
+// Reads a grid written by WriteJSON.
+func ReadGridJSON(r io.Reader, m GridItemMarshaller) (g *Grid, err error) {
+	var in gridJSON
+	if err = json.NewDecoder(r).Decode(&in); err != nil {
+		return
+	}
+	return decodeGrid(in.Width, in.Height, in.BlockSize, in.Items, in.Cells, m)
+}
+
+const gridBinaryMagic = "TDG1"
+
+// Writes the grid in a compact binary form: a header, the distinct item
+// encodings, and then a varint for each cell in index order, which runs
+// left to right along the top row first.
+func (g *Grid) WriteBinary(w io.Writer, m GridItemMarshaller) (err error) {
+	var (
+		palette []string
+		cells   []uint32
+		out     = bufio.NewWriter(w)
+		buf     = make([]byte, binary.MaxVarintLen64)
+		uvarint = func(v uint64) {
+			n := binary.PutUvarint(buf, v)
+			out.Write(buf[:n])
+		}
+	)
+	if palette, cells, err = g.encodeItems(m); err != nil {
+		return
+	}
+	out.WriteString(gridBinaryMagic)
+	uvarint(uint64(g.Width))
+	uvarint(uint64(g.Height))
+	binary.Write(out, binary.LittleEndian, math.Float32bits(g.BlockSize))
+	uvarint(uint64(len(palette)))
+	for _, data := range palette {
+		uvarint(uint64(len(data)))
+		out.WriteString(data)
+	}
+	for _, cell := range cells {
+		uvarint(uint64(cell))
+	}
+	return out.Flush()
+}
+
+// Reads a grid written by WriteBinary.
+func ReadGridBinary(r io.Reader, m GridItemMarshaller) (g *Grid, err error) {
+	var (
+		in            = bufio.NewReader(r)
+		magic         = make([]byte, len(gridBinaryMagic))
+		width, height uint64
+		bits          uint32
+		count         uint64
+		palette       []string
+		cells         []uint32
+	)
+	if _, err = io.ReadFull(in, magic); err != nil {
+		return
+	}
+	if string(magic) != gridBinaryMagic {
+		return nil, fmt.Errorf("Not a grid file")
+	}
+	if width, err = binary.ReadUvarint(in); err != nil {
+		return
+	}
+	if height, err = binary.ReadUvarint(in); err != nil {
+		return
+	}
+	if width > math.MaxInt32 || height > math.MaxInt32 || width*height > math.MaxInt32 {
+		return nil, fmt.Errorf("Grid of %v by %v is too large", width, height)
+	}
+	if err = binary.Read(in, binary.LittleEndian, &bits); err != nil {
+		return
+	}
+	if count, err = binary.ReadUvarint(in); err != nil {
+		return
+	}
+	for i := uint64(0); i < count; i++ {
+		var size uint64
+		if size, err = binary.ReadUvarint(in); err != nil {
+			return
+		}
+		if size > math.MaxInt32 {
+			return nil, fmt.Errorf("Item of %v bytes is too large", size)
+		}
+		// Sizes come from the file, so memory grows only as data arrives.
+		var data bytes.Buffer
+		if _, err = io.CopyN(&data, in, int64(size)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+		palette = append(palette, data.String())
+	}
+	for i := uint64(0); i < width*height; i++ {
+		var cell uint64
+		if cell, err = binary.ReadUvarint(in); err != nil {
+			return
+		}
+		if cell > math.MaxUint32 {
+			return nil, fmt.Errorf("Unknown item %v in cell %v", cell, i)
+		}
+		cells = append(cells, uint32(cell))
+	}
+	return decodeGrid(int32(width), int32(height), math.Float32frombits(bits), palette, cells, m)
+}
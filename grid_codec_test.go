@@ -0,0 +1,213 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const TEST_GRID_TEXT = `
+#####
+#..~#
+#..
+#####
+`
+
+var testGridLegend = map[rune]GridItem{
+	'#': testGridItem{blocked: true},
+	'.': nil,
+	'~': testGridItem{cost: 3},
+}
+
+type testGridItemMarshaller struct{}
+
+func (m testGridItemMarshaller) MarshalGridItem(item GridItem) ([]byte, error) {
+	var i = item.(testGridItem)
+	return []byte(fmt.Sprintf("%v %v", i.blocked, i.cost)), nil
+}
+
+func (m testGridItemMarshaller) UnmarshalGridItem(data []byte) (item GridItem, err error) {
+	var i testGridItem
+	_, err = fmt.Sscanf(string(data), "%v %v", &i.blocked, &i.cost)
+	return i, err
+}
+
+func TestParseGridText(t *testing.T) {
+	g, err := ParseGridText(TEST_GRID_TEXT, testGridLegend, 2)
+	if err != nil {
+		t.Fatalf("Problem parsing text: %v", err)
+	}
+	if g.Width != 5 || g.Height != 4 || g.BlockSize != 2 {
+		t.Fatalf("Unexpected grid size %v %v %v", g.Width, g.Height, g.BlockSize)
+	}
+	if g.walkable(0, 3) || !g.walkable(1, 2) || g.movementCost(3, 2) != 3 {
+		t.Fatalf("Expected top row from the first line")
+	}
+	if g.Get(4, 1) != nil {
+		t.Fatalf("Expected short row to be padded with empty cells")
+	}
+	if _, err = ParseGridText("#?#", testGridLegend, 1); err == nil {
+		t.Fatalf("Expected error for unknown character")
+	}
+}
+
+func TestLoadGridImage(t *testing.T) {
+	var (
+		img     = image.NewNRGBA(image.Rect(0, 0, 3, 2))
+		black   = color.NRGBA{0, 0, 0, 255}
+		white   = color.NRGBA{255, 255, 255, 255}
+		palette = GridPalette{black: testGridItem{blocked: true}, white: nil}
+		buf     bytes.Buffer
+	)
+	for x := 0; x < 3; x++ {
+		img.Set(x, 0, black)
+		img.Set(x, 1, white)
+	}
+	dir, err := ioutil.TempDir("", "grid")
+	if err != nil {
+		t.Fatalf("Problem creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	png.Encode(&buf, img)
+	ioutil.WriteFile(filepath.Join(dir, "level.png"), buf.Bytes(), 0644)
+	g, err := LoadGridImage(filepath.Join(dir, "level.png"), palette, 1)
+	if err != nil {
+		t.Fatalf("Problem loading image: %v", err)
+	}
+	if g.walkable(1, 0) || !g.walkable(1, 1) {
+		t.Fatalf("Expected first row of the image at the bottom of the grid")
+	}
+	img.Set(2, 1, color.NRGBA{255, 0, 0, 255})
+	if _, err = NewGridFromImage(img, palette, 1); err == nil {
+		t.Fatalf("Expected error for unknown colour")
+	}
+}
+
+func TestGridImageRoundTrip(t *testing.T) {
+	var (
+		g       = newTestGrid("#..", "..#", ".#.", "##.")
+		black   = color.NRGBA{0, 0, 0, 255}
+		white   = color.NRGBA{255, 255, 255, 255}
+		palette = GridPalette{black: testGridItem{blocked: true}, white: nil}
+	)
+	out, err := NewGridFromImage(g.GetImage(black, white), palette, 1)
+	if err != nil {
+		t.Fatalf("Problem reading image: %v", err)
+	}
+	for y := int32(0); y < g.Height; y++ {
+		for x := int32(0); x < g.Width; x++ {
+			if out.walkable(x, y) != g.walkable(x, y) {
+				t.Fatalf("Cell %v,%v differs after image round trip", x, y)
+			}
+		}
+	}
+}
+
+func TestGridRoundTrip(t *testing.T) {
+	var (
+		g, _ = ParseGridText(TEST_GRID_TEXT, testGridLegend, 2)
+		m    = testGridItemMarshaller{}
+	)
+	for _, format := range []string{"json", "binary"} {
+		var (
+			buf bytes.Buffer
+			out *Grid
+			err error
+		)
+		if format == "json" {
+			err = g.WriteJSON(&buf, m)
+		} else {
+			err = g.WriteBinary(&buf, m)
+		}
+		if err != nil {
+			t.Fatalf("Problem writing %v: %v", format, err)
+		}
+		if format == "json" {
+			out, err = ReadGridJSON(&buf, m)
+		} else {
+			out, err = ReadGridBinary(&buf, m)
+		}
+		if err != nil {
+			t.Fatalf("Problem reading %v: %v", format, err)
+		}
+		if out.Width != g.Width || out.Height != g.Height || out.BlockSize != 2 {
+			t.Fatalf("Unexpected %v grid size", format)
+		}
+		for i := range g.points {
+			if out.points[i] != g.points[i] {
+				t.Fatalf("Cell %v differs after %v round trip: %v, %v", i, format, out.points[i], g.points[i])
+			}
+		}
+	}
+	if _, err := ReadGridBinary(bytes.NewReader([]byte("nope")), m); err == nil {
+		t.Fatalf("Expected error for bad header")
+	}
+}
+
+func TestGridJSONTopRowFirst(t *testing.T) {
+	var (
+		g   = newTestGrid("#.", "..")
+		buf bytes.Buffer
+		in  gridJSON
+	)
+	if err := g.WriteJSON(&buf, testGridItemMarshaller{}); err != nil {
+		t.Fatalf("Problem writing: %v", err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &in); err != nil {
+		t.Fatalf("Problem reading: %v", err)
+	}
+	if in.Items[in.Cells[0]-1] != "true 0" {
+		t.Fatalf("Expected the top left wall first, got %v %v", in.Items, in.Cells)
+	}
+}
+
+func TestReadGridBinaryTruncated(t *testing.T) {
+	var header = func(width, height, items, size uint64) []byte {
+		var (
+			out     = bytes.NewBufferString(gridBinaryMagic)
+			buf     = make([]byte, binary.MaxVarintLen64)
+			uvarint = func(v uint64) {
+				out.Write(buf[:binary.PutUvarint(buf, v)])
+			}
+		)
+		uvarint(width)
+		uvarint(height)
+		out.Write([]byte{0, 0, 0x80, 0x3f}) // Block size of 1.
+		uvarint(items)
+		if items > 0 {
+			uvarint(size)
+		}
+		return out.Bytes()
+	}
+	// Each claims far more data than follows it.
+	for _, data := range [][]byte{
+		header(1, 1, 1, 1<<30),
+		header(1<<15, 1<<15, 0, 0),
+	} {
+		if _, err := ReadGridBinary(bytes.NewReader(data), testGridItemMarshaller{}); err == nil {
+			t.Fatalf("Expected error for truncated file")
+		}
+	}
+}
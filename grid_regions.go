@@ -0,0 +1,280 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+// Visits the open cells reachable from start, which must be open, moving as
+// the pathfinder would with mode.  claim is called for each neighbour found
+// and should return true, and remember the cell, the first time it sees
+// it.  Returns the indices of the cells reached, nearest first.
+func (g *Grid) flood(start int32, mode DiagonalMode, claim func(index int32) bool) (cells []int32) {
+	cells = []int32{start}
+	for head := 0; head < len(cells); head++ {
+		var x, y = g.Coords(cells[head])
+		g.eachNeighbor(x, y, mode, func(nx, ny int32, dist float32) {
+			if n := g.Index(nx, ny); claim(n) {
+				cells = append(cells, n)
+			}
+		})
+	}
+	return
+}
+
+// Returns the open cells reachable from x, y, including x, y, nearest
+// first.  DiagonalNever fills in four directions and the other modes in
+// eight, following the same corner rules as the pathfinder.  Returns nil if
+// x, y is blocked.
+func (g *Grid) FloodFill(x, y int32, mode DiagonalMode) (out []GridPoint) {
+	var (
+		start = g.Index(x, y)
+		seen  = map[int32]bool{start: true}
+	)
+	if !g.walkable(x, y) {
+		return
+	}
+	var cells = g.flood(start, mode, func(index int32) bool {
+		if seen[index] {
+			return false
+		}
+		seen[index] = true
+		return true
+	})
+	out = make([]GridPoint, len(cells))
+	for i, index := range cells {
+		out[i].X, out[i].Y = g.Coords(index)
+	}
+	return
+}
+
+// An area of open cells which can all reach each other.
+type GridRegion struct {
+	Label int32
+	Size  int
+	Min   GridPoint // Bottom left of the bounds.
+	Max   GridPoint // Top right of the bounds, inclusive.
+}
+
+type GridRegions struct {
+	Labels  []int32 // Region of each cell by grid index, or -1 if blocked.
+	Regions []GridRegion
+}
+
+// Returns the region holding x, y, or nil if the cell is blocked.
+func (r *GridRegions) At(g *Grid, x, y int32) *GridRegion {
+	var index = g.Index(x, y)
+	if index == -1 || r.Labels[index] == -1 {
+		return nil
+	}
+	return &r.Regions[r.Labels[index]]
+}
+
+// Splits the open cells of the grid into connected regions, labelled in
+// grid index order.
+func (g *Grid) LabelRegions(mode DiagonalMode) (r *GridRegions) {
+	r = &GridRegions{Labels: make([]int32, len(g.points))}
+	for i := range r.Labels {
+		r.Labels[i] = -1
+	}
+	for i := range r.Labels {
+		var x, y = g.Coords(int32(i))
+		if r.Labels[i] != -1 || !g.walkable(x, y) {
+			continue
+		}
+		var (
+			label  = int32(len(r.Regions))
+			region = GridRegion{Label: label, Min: GridPoint{x, y}, Max: GridPoint{x, y}}
+		)
+		r.Labels[i] = label
+		var cells = g.flood(int32(i), mode, func(index int32) bool {
+			if r.Labels[index] != -1 {
+				return false
+			}
+			r.Labels[index] = label
+			return true
+		})
+		for _, index := range cells {
+			var cx, cy = g.Coords(index)
+			region.Min.X = minInt32(region.Min.X, cx)
+			region.Min.Y = minInt32(region.Min.Y, cy)
+			region.Max.X = maxInt32(region.Max.X, cx)
+			region.Max.Y = maxInt32(region.Max.Y, cy)
+		}
+		region.Size = len(cells)
+		r.Regions = append(r.Regions, region)
+	}
+	return
+}
+
+// Answers whether two cells of a grid are connected, staying up to date as
+// the grid changes.  Opening a cell merges the regions around it straight
+// away.  Blocking one may split its region, which is worked out again when
+// next queried, so repeated changes between queries are cheap.
+//
+// Not safe to use from several goroutines.
+type GridConnectivity struct {
+	Grid       *Grid
+	Diagonals  DiagonalMode
+	labels     []int32
+	sizes      map[int32]int
+	next       int32
+	seeds      []int32 // Cells beside blocked cells, whose regions may have split.
+	observerId int
+}
+
+func NewGridConnectivity(g *Grid, mode DiagonalMode) (c *GridConnectivity) {
+	var regions = g.LabelRegions(mode)
+	c = &GridConnectivity{
+		Grid:      g,
+		Diagonals: mode,
+		labels:    regions.Labels,
+		sizes:     map[int32]int{},
+		next:      int32(len(regions.Regions)),
+	}
+	for _, region := range regions.Regions {
+		c.sizes[region.Label] = region.Size
+	}
+	c.observerId = g.AddChangeObserver(c.onChange)
+	return
+}
+
+// Stops listening for changes to the grid.
+func (c *GridConnectivity) Delete() {
+	c.Grid.RemoveChangeObserver(c.observerId)
+}
+
+func (c *GridConnectivity) onChange(x, y int32, old, val GridItem) {
+	var (
+		g       = c.Grid
+		index   = g.Index(x, y)
+		blocked = old != nil && old.Passable()
+	)
+	if blocked == (val != nil && val.Passable()) {
+		return
+	}
+	if blocked {
+		c.open(index)
+		return
+	}
+	var label = c.labels[index]
+	c.labels[index] = -1
+	if c.sizes[label]--; c.sizes[label] == 0 {
+		delete(c.sizes, label)
+	}
+	for dy := int32(-1); dy <= 1; dy++ {
+		for dx := int32(-1); dx <= 1; dx++ {
+			if n := g.Index(x+dx, y+dy); n != -1 && c.labels[n] == label {
+				c.seeds = append(c.seeds, n)
+			}
+		}
+	}
+}
+
+// Joins a newly opened cell to the regions around it, relabelling all but
+// the largest of them.
+func (c *GridConnectivity) open(index int32) {
+	var (
+		g      = c.Grid
+		x, y   = g.Coords(index)
+		target = int32(-1)
+		others []int32
+	)
+	c.update()
+	g.eachNeighbor(x, y, c.Diagonals, func(nx, ny int32, dist float32) {
+		var label = c.labels[g.Index(nx, ny)]
+		if target == -1 {
+			target = label
+		} else if label != target {
+			if c.sizes[label] > c.sizes[target] {
+				label, target = target, label
+			}
+			others = append(others, label)
+		}
+	})
+	if target == -1 {
+		target = c.next
+		c.next++
+	}
+	c.labels[index] = target
+	c.sizes[target]++
+	for _, label := range others {
+		if _, ok := c.sizes[label]; !ok {
+			continue // Already merged.
+		}
+		c.sizes[target] += c.sizes[label]
+		delete(c.sizes, label)
+		c.relabel(index, label, target)
+	}
+}
+
+// Gives the label to every cell labelled from which can be reached from
+// index through cells labelled from.
+func (c *GridConnectivity) relabel(index, from, to int32) {
+	c.Grid.flood(index, c.Diagonals, func(n int32) bool {
+		if c.labels[n] != from {
+			return false
+		}
+		c.labels[n] = to
+		return true
+	})
+}
+
+// Relabels the regions which may have split since the last query.
+func (c *GridConnectivity) update() {
+	var fresh = map[int32]bool{}
+	for _, seed := range c.seeds {
+		var old = c.labels[seed]
+		if old == -1 || fresh[old] {
+			continue
+		}
+		var label = c.next
+		c.next++
+		fresh[label] = true
+		delete(c.sizes, old)
+		c.labels[seed] = label
+		c.sizes[label] = len(c.Grid.flood(seed, c.Diagonals, func(n int32) bool {
+			// Skips a cell being opened, which is still unlabelled.
+			if c.labels[n] == label || c.labels[n] == -1 {
+				return false
+			}
+			c.labels[n] = label
+			return true
+		}))
+	}
+	c.seeds = c.seeds[:0]
+}
+
+// Returns the label of the region holding x, y, or -1 if it is blocked or
+// outside the grid.  Labels change as the grid does.
+func (c *GridConnectivity) Label(x, y int32) int32 {
+	var index = c.Grid.Index(x, y)
+	if index == -1 {
+		return -1
+	}
+	c.update()
+	return c.labels[index]
+}
+
+// Returns the number of cells in the region holding x, y.
+func (c *GridConnectivity) Size(x, y int32) int {
+	if label := c.Label(x, y); label != -1 {
+		return c.sizes[label]
+	}
+	return 0
+}
+
+// Returns true if x1, y1 and x2, y2 are both open and a path joins them.
+func (c *GridConnectivity) Connected(x1, y1, x2, y2 int32) bool {
+	var label = c.Label(x1, y1)
+	return label != -1 && label == c.Label(x2, y2)
+}
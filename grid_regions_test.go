@@ -0,0 +1,117 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFloodFill(t *testing.T) {
+	var g = newTestGrid(
+		"..#..",
+		"..#..",
+		"##...",
+		".#...",
+	)
+	if cells := g.FloodFill(0, 3, DiagonalNever); len(cells) != 4 || cells[0] != (GridPoint{0, 3}) {
+		t.Fatalf("Expected the top left room, got %v", cells)
+	}
+	if cells := g.FloodFill(0, 0, DiagonalNever); len(cells) != 1 {
+		t.Fatalf("Expected a single cell, got %v", cells)
+	}
+	// Squeezing between the corners joins the two rooms.
+	if cells := g.FloodFill(0, 3, DiagonalAlways); len(cells) != 14 {
+		t.Fatalf("Expected both rooms, got %v", cells)
+	}
+	if cells := g.FloodFill(2, 3, DiagonalNever); cells != nil {
+		t.Fatalf("Expected nothing from a wall, got %v", cells)
+	}
+}
+
+func TestLabelRegions(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"..#..",
+			"..#..",
+			"##...",
+			".#...",
+		)
+		r = g.LabelRegions(DiagonalNever)
+	)
+	if len(r.Regions) != 3 {
+		t.Fatalf("Expected three regions, got %v", r.Regions)
+	}
+	right := r.At(g, 4, 0)
+	if right.Size != 10 || right.Min != (GridPoint{2, 0}) || right.Max != (GridPoint{4, 3}) {
+		t.Fatalf("Unexpected region %+v", right)
+	}
+	if r.At(g, 1, 1) != nil || r.At(g, 0, 3).Label != 0 {
+		t.Fatalf("Unexpected labels %v", r.Labels)
+	}
+}
+
+func TestGridConnectivityMatchesLabels(t *testing.T) {
+	var modes = []DiagonalMode{DiagonalNever, DiagonalAlways, DiagonalNoObstacles}
+	for _, mode := range modes {
+		var (
+			g = newRandomGrid(3, 16, 0.4)
+			r = rand.New(rand.NewSource(int64(mode)))
+			c = NewGridConnectivity(g, mode)
+		)
+		for step := 0; step < 200; step++ {
+			var x, y = r.Int31n(16), r.Int31n(16)
+			g.Set(x, y, testGridItem{blocked: g.walkable(x, y)})
+			if step%3 != 0 {
+				continue
+			}
+			var want = g.LabelRegions(mode)
+			for i := 0; i < 20; i++ {
+				var (
+					x1, y1 = r.Int31n(16), r.Int31n(16)
+					x2, y2 = r.Int31n(16), r.Int31n(16)
+					a      = want.At(g, x1, y1)
+					b      = want.At(g, x2, y2)
+				)
+				if c.Connected(x1, y1, x2, y2) != (a != nil && a == b) {
+					t.Fatalf("Mode %v step %v: wrong answer for %v,%v and %v,%v", mode, step, x1, y1, x2, y2)
+				}
+				if a != nil && c.Size(x1, y1) != a.Size {
+					t.Fatalf("Mode %v step %v: expected size %v, got %v", mode, step, a.Size, c.Size(x1, y1))
+				}
+			}
+		}
+		c.Delete()
+	}
+}
+
+func TestGetPathConnectivity(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"..#..",
+			"..#..",
+		)
+		c    = NewGridConnectivity(g, DiagonalNever)
+		opts = PathOptions{Connectivity: c}
+	)
+	defer c.Delete()
+	if _, err := g.GetPathWithOptions(0, 0, 4, 0, opts); err == nil {
+		t.Fatalf("Expected no path between regions")
+	}
+	g.Set(2, 0, nil)
+	if path, err := g.GetPathWithOptions(0, 0, 4, 0, opts); err != nil || len(path) != 5 {
+		t.Fatalf("Expected path once the wall opens, got %v %v", path, err)
+	}
+}
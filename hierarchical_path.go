@@ -0,0 +1,436 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Based on "Near Optimal Hierarchical Path-Finding", Botea, Müller &
+// Schaeffer, 2004.
+
+package twodee
+
+import (
+	"fmt"
+)
+
+// Entrances at least this wide get a transition at each end rather than
+// one in the middle.
+const hpaWideEntrance = 6
+
+type hpaBounds struct {
+	x0, y0 int32
+	x1, y1 int32 // Exclusive.
+}
+
+func (b hpaBounds) contains(x, y int32) bool {
+	return x >= b.x0 && y >= b.y0 && x < b.x1 && y < b.y1
+}
+
+type hpaEdge struct {
+	to   int32 // Grid index.
+	cost float32
+}
+
+type hpaCluster struct {
+	bounds hpaBounds
+	nodes  []int32
+	edges  map[int32][]hpaEdge
+}
+
+// A pair of neighbouring open cells either side of a cluster border.  The a
+// side is in the cluster to the west or south.
+type hpaTransition struct {
+	a, b int32
+}
+
+// Searches large grids by splitting them into square clusters and planning
+// over a graph of the entrances between clusters first.  Paths are usually a
+// little more expensive than those from GetPath, more so on grids with
+// varied movement costs, in exchange for much less searching.  The graph is
+// kept up to date as the grid changes, rebuilding only the affected
+// clusters.
+//
+// Diagonal moves between clusters are only planned through entrances, so
+// DiagonalAlways and DiagonalOneObstacle may miss paths which squeeze
+// diagonally across a cluster corner.
+type HierarchicalPathfinder struct {
+	Grid         *Grid
+	ClusterSize  int32
+	Options      PathOptions
+	clustersWide int32
+	clustersHigh int32
+	clusters     []hpaCluster
+	eastBorders  [][]hpaTransition // Border on the east side of each cluster.
+	northBorders [][]hpaTransition // Border on the north side of each cluster.
+	dirty        map[int32]bool
+	dirtyEast    map[int32]bool
+	dirtyNorth   map[int32]bool
+	observerId   int
+}
+
+func NewHierarchicalPathfinder(g *Grid, clusterSize int32, opts PathOptions) (h *HierarchicalPathfinder, err error) {
+	if clusterSize <= 0 {
+		err = fmt.Errorf("Cluster size must be positive, got %v", clusterSize)
+		return
+	}
+	var (
+		wide = (g.Width + clusterSize - 1) / clusterSize
+		high = (g.Height + clusterSize - 1) / clusterSize
+		c    int32
+	)
+	h = &HierarchicalPathfinder{
+		Grid:         g,
+		ClusterSize:  clusterSize,
+		Options:      opts,
+		clustersWide: wide,
+		clustersHigh: high,
+		clusters:     make([]hpaCluster, wide*high),
+		eastBorders:  make([][]hpaTransition, wide*high),
+		northBorders: make([][]hpaTransition, wide*high),
+		dirty:        map[int32]bool{},
+		dirtyEast:    map[int32]bool{},
+		dirtyNorth:   map[int32]bool{},
+	}
+	for c = 0; c < wide*high; c++ {
+		var cx, cy = c % wide, c / wide
+		h.clusters[c].bounds = hpaBounds{
+			x0: cx * clusterSize,
+			y0: cy * clusterSize,
+			x1: minInt32((cx+1)*clusterSize, g.Width),
+			y1: minInt32((cy+1)*clusterSize, g.Height),
+		}
+		h.dirty[c] = true
+		h.dirtyEast[c] = true
+		h.dirtyNorth[c] = true
+	}
+	h.observerId = g.AddChangeObserver(h.onChange)
+	return
+}
+
+func minInt32(a, b int32) int32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Stops listening for changes to the grid.
+func (h *HierarchicalPathfinder) Delete() {
+	h.Grid.RemoveChangeObserver(h.observerId)
+}
+
+func (h *HierarchicalPathfinder) clusterOf(x, y int32) int32 {
+	return (y/h.ClusterSize)*h.clustersWide + x/h.ClusterSize
+}
+
+func (h *HierarchicalPathfinder) clusterOfIndex(index int32) int32 {
+	return h.clusterOf(h.Grid.Coords(index))
+}
+
+// Marks the clusters and borders affected by a change at x, y.
+func (h *HierarchicalPathfinder) onChange(x, y int32, old, val GridItem) {
+	var (
+		c  = h.clusterOf(x, y)
+		b  = h.clusters[c].bounds
+		cw = h.clustersWide
+	)
+	h.dirty[c] = true
+	if x == b.x0 && b.x0 > 0 {
+		h.dirtyEast[c-1] = true
+		h.dirty[c-1] = true
+	}
+	if x == b.x1-1 && b.x1 < h.Grid.Width {
+		h.dirtyEast[c] = true
+		h.dirty[c+1] = true
+	}
+	if y == b.y0 && b.y0 > 0 {
+		h.dirtyNorth[c-cw] = true
+		h.dirty[c-cw] = true
+	}
+	if y == b.y1-1 && b.y1 < h.Grid.Height {
+		h.dirtyNorth[c] = true
+		h.dirty[c+cw] = true
+	}
+}
+
+// Rebuilds any borders and clusters changed since the last query.
+func (h *HierarchicalPathfinder) update() {
+	if len(h.dirty) == 0 {
+		return
+	}
+	var search = h.Grid.getPathSearch()
+	defer h.Grid.putPathSearch(search)
+	for c := range h.dirtyEast {
+		h.eastBorders[c] = h.scanBorder(c, true)
+	}
+	for c := range h.dirtyNorth {
+		h.northBorders[c] = h.scanBorder(c, false)
+	}
+	for c := range h.dirty {
+		h.buildCluster(search, c)
+	}
+	h.dirty = map[int32]bool{}
+	h.dirtyEast = map[int32]bool{}
+	h.dirtyNorth = map[int32]bool{}
+}
+
+// Finds the transitions across the east or north border of cluster c.
+func (h *HierarchicalPathfinder) scanBorder(c int32, east bool) (out []hpaTransition) {
+	var (
+		g     = h.Grid
+		b     = h.clusters[c].bounds
+		first int32
+		last  int32
+		i     int32
+		start = int32(-1)
+	)
+	if (east && b.x1 >= g.Width) || (!east && b.y1 >= g.Height) {
+		return
+	}
+	// Cell i along the border, on the a and b sides.
+	var cell = func(i int32, other bool) (x, y int32) {
+		var offset int32
+		if other {
+			offset = 1
+		}
+		if east {
+			return b.x1 - 1 + offset, b.y0 + i
+		}
+		return b.x0 + i, b.y1 - 1 + offset
+	}
+	var transition = func(i int32) hpaTransition {
+		ax, ay := cell(i, false)
+		bx, by := cell(i, true)
+		return hpaTransition{g.Index(ax, ay), g.Index(bx, by)}
+	}
+	if east {
+		last = b.y1 - b.y0
+	} else {
+		last = b.x1 - b.x0
+	}
+	for i = 0; i <= last; i++ {
+		var open = i < last
+		if open {
+			ax, ay := cell(i, false)
+			bx, by := cell(i, true)
+			open = g.walkable(ax, ay) && g.walkable(bx, by)
+		}
+		if open && start == -1 {
+			start = i
+		} else if !open && start != -1 {
+			first = start
+			if i-first >= hpaWideEntrance {
+				out = append(out, transition(first), transition(i-1))
+			} else {
+				out = append(out, transition((first+i-1)/2))
+			}
+			start = -1
+		}
+	}
+	return
+}
+
+// Collects the nodes of cluster c from its borders and connects them.
+func (h *HierarchicalPathfinder) buildCluster(search *pathSearch, c int32) {
+	var (
+		g       = h.Grid
+		cluster = &h.clusters[c]
+		cw      = h.clustersWide
+		seen    = map[int32]bool{}
+	)
+	cluster.nodes = cluster.nodes[:0]
+	cluster.edges = map[int32][]hpaEdge{}
+	var link = func(transitions []hpaTransition, mineIsA bool) {
+		for _, t := range transitions {
+			var mine, other = t.a, t.b
+			if !mineIsA {
+				mine, other = t.b, t.a
+			}
+			if !seen[mine] {
+				seen[mine] = true
+				cluster.nodes = append(cluster.nodes, mine)
+			}
+			ox, oy := g.Coords(other)
+			cluster.edges[mine] = append(cluster.edges[mine], hpaEdge{other, g.movementCost(ox, oy)})
+		}
+	}
+	link(h.eastBorders[c], true)
+	link(h.northBorders[c], true)
+	if c%cw > 0 {
+		link(h.eastBorders[c-1], false)
+	}
+	if c >= cw {
+		link(h.northBorders[c-cw], false)
+	}
+	for _, from := range cluster.nodes {
+		search.reset()
+		h.searchCluster(search, cluster.bounds, from, -1, false)
+		for _, to := range cluster.nodes {
+			if to != from && search.seen(to) {
+				cluster.edges[from] = append(cluster.edges[from], hpaEdge{to, search.nodes[to].g})
+			}
+		}
+	}
+}
+
+// Searches from start without leaving bounds.  If goal is not -1 the search
+// stops on reaching it.  If reverse is set, each step is charged for the
+// cell being left rather than the cell entered, which gives the cost of
+// travelling to start rather than from it.  Returns false if goal was given
+// and could not be reached.
+func (h *HierarchicalPathfinder) searchCluster(search *pathSearch, b hpaBounds, start, goal int32, reverse bool) bool {
+	var (
+		g         = h.Grid
+		heuristic = h.Options.heuristic()
+		gx, gy    int32
+	)
+	if goal != -1 {
+		gx, gy = g.Coords(goal)
+	}
+	search.relax(start, 0, 0, -1)
+	for search.Len() > 0 {
+		var current = search.pop()
+		if current == goal {
+			return true
+		}
+		cx, cy := g.Coords(current)
+		leave := g.movementCost(cx, cy)
+		g.eachNeighbor(cx, cy, h.Options.Diagonals, func(nx, ny int32, dist float32) {
+			if !b.contains(nx, ny) {
+				return
+			}
+			var (
+				cost = search.nodes[current].g
+				est  float32
+			)
+			if reverse {
+				cost += dist * leave
+			} else {
+				cost += dist * g.movementCost(nx, ny)
+			}
+			if goal != -1 {
+				est = heuristic(absInt32(gx-nx), absInt32(gy-ny))
+			}
+			search.relax(g.Index(nx, ny), cost, cost+est, current)
+		})
+	}
+	return goal == -1
+}
+
+// Returns the entrances to pass through on the way from x1, y1 to x2, y2,
+// starting and ending with those points.  Consecutive waypoints are either
+// in the same cluster or are neighbouring cells.
+func (h *HierarchicalPathfinder) GetAbstractPath(x1, y1, x2, y2 int32) (out []GridPoint, err error) {
+	var (
+		g          = h.Grid
+		start      = g.Index(x1, y1)
+		goal       = g.Index(x2, y2)
+		heuristic  = h.Options.heuristic()
+		search     *pathSearch
+		startEdges []hpaEdge
+		goalCosts  = map[int32]float32{}
+		sc, gc     int32
+	)
+	if start == -1 || goal == -1 || !g.walkable(x1, y1) || !g.walkable(x2, y2) {
+		err = fmt.Errorf("No path found")
+		return
+	}
+	h.update()
+	search = g.getPathSearch()
+	defer g.putPathSearch(search)
+	sc = h.clusterOf(x1, y1)
+	gc = h.clusterOf(x2, y2)
+
+	// Connect the start and goal to the entrances of their clusters.
+	h.searchCluster(search, h.clusters[sc].bounds, start, -1, false)
+	for _, node := range h.clusters[sc].nodes {
+		if search.seen(node) {
+			startEdges = append(startEdges, hpaEdge{node, search.nodes[node].g})
+		}
+	}
+	if sc == gc && search.seen(goal) {
+		startEdges = append(startEdges, hpaEdge{goal, search.nodes[goal].g})
+	}
+	search.reset()
+	h.searchCluster(search, h.clusters[gc].bounds, goal, -1, true)
+	for _, node := range h.clusters[gc].nodes {
+		if search.seen(node) {
+			goalCosts[node] = search.nodes[node].g
+		}
+	}
+
+	search.reset()
+	search.relax(start, 0, 0, -1)
+	for search.Len() > 0 {
+		var (
+			current = search.pop()
+			cost    = search.nodes[current].g
+			edges   = h.clusters[h.clusterOfIndex(current)].edges[current]
+		)
+		if current == goal {
+			return search.points(g, goal), nil
+		}
+		if current == start {
+			edges = append(edges[:len(edges):len(edges)], startEdges...)
+		}
+		if c, ok := goalCosts[current]; ok {
+			edges = append(edges[:len(edges):len(edges)], hpaEdge{goal, c})
+		}
+		for _, e := range edges {
+			ex, ey := g.Coords(e.to)
+			est := heuristic(absInt32(x2-ex), absInt32(y2-ey))
+			search.relax(e.to, cost+e.cost, cost+e.cost+est, current)
+		}
+	}
+	err = fmt.Errorf("No path found")
+	return
+}
+
+// Expands an abstract path into one which visits every cell, in the same
+// form returned by GetPath.  Long paths may be refined a few waypoints at a
+// time as the agent moves along them.
+func (h *HierarchicalPathfinder) RefinePath(abstract []GridPoint) (out []GridPoint, err error) {
+	var (
+		g      = h.Grid
+		search = g.getPathSearch()
+	)
+	defer g.putPathSearch(search)
+	if len(abstract) == 0 {
+		return
+	}
+	out = append(out, abstract[0])
+	for i := 1; i < len(abstract); i++ {
+		var (
+			a  = abstract[i-1]
+			b  = abstract[i]
+			ca = h.clusterOf(a.X, a.Y)
+		)
+		if ca != h.clusterOf(b.X, b.Y) {
+			out = append(out, b)
+			continue
+		}
+		search.reset()
+		if !h.searchCluster(search, h.clusters[ca].bounds, g.Index(a.X, a.Y), g.Index(b.X, b.Y), false) {
+			err = fmt.Errorf("No path found")
+			return
+		}
+		out = append(out, search.points(g, g.Index(b.X, b.Y))[1:]...)
+	}
+	return
+}
+
+func (h *HierarchicalPathfinder) GetPath(x1, y1, x2, y2 int32) (out []GridPoint, err error) {
+	var abstract []GridPoint
+	if abstract, err = h.GetAbstractPath(x1, y1, x2, y2); err != nil {
+		return
+	}
+	return h.RefinePath(abstract)
+}
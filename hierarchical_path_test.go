@@ -0,0 +1,106 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestHierarchicalPathNearOptimal(t *testing.T) {
+	var modes = []DiagonalMode{DiagonalNever, DiagonalNoObstacles}
+	for seed := int64(0); seed < 10; seed++ {
+		for _, mode := range modes {
+			var (
+				g    = newRandomGrid(seed, 48, 0.25)
+				r    = rand.New(rand.NewSource(seed))
+				opts = PathOptions{Diagonals: mode}
+				h, _ = NewHierarchicalPathfinder(g, 8, opts)
+			)
+			for q := 0; q < 10; q++ {
+				var (
+					start = GridPoint{r.Int31n(48), r.Int31n(48)}
+					goal  = GridPoint{r.Int31n(48), r.Int31n(48)}
+				)
+				if !g.walkable(start.X, start.Y) || !g.walkable(goal.X, goal.Y) {
+					continue
+				}
+				expected, experr := g.GetPathWithOptions(start.X, start.Y, goal.X, goal.Y, opts)
+				path, err := h.GetPath(start.X, start.Y, goal.X, goal.Y)
+				if (err == nil) != (experr == nil) {
+					t.Fatalf("Seed %v: got error %v, A* got %v", seed, err, experr)
+				}
+				if err != nil {
+					continue
+				}
+				checkContiguous(t, g, path, start, goal)
+				if cost, want := pathCost(g, path), pathCost(g, expected); cost > want*1.5 {
+					t.Fatalf("Seed %v: found cost %v from %v to %v, A* found %v", seed, cost, start, goal, want)
+				}
+			}
+			h.Delete()
+		}
+	}
+}
+
+func TestHierarchicalPathUpdates(t *testing.T) {
+	var (
+		g    = NewGrid(16, 8, 1)
+		h, _ = NewHierarchicalPathfinder(g, 8, PathOptions{})
+		path []GridPoint
+		err  error
+	)
+	defer h.Delete()
+	if path, err = h.GetPath(0, 0, 15, 0); err != nil || len(path) != 16 {
+		t.Fatalf("Expected straight path, got %v %v", path, err)
+	}
+	for y := int32(0); y < 7; y++ {
+		g.Set(8, y, testGridItem{blocked: true})
+	}
+	if path, err = h.GetPath(0, 0, 15, 0); err != nil || len(path) != 30 {
+		t.Fatalf("Expected path over wall, got %v %v", path, err)
+	}
+	checkContiguous(t, g, path, GridPoint{0, 0}, GridPoint{15, 0})
+	g.Set(8, 7, testGridItem{blocked: true})
+	if path, err = h.GetPath(0, 0, 15, 0); err == nil {
+		t.Fatalf("Expected no path through closed wall, got %v", path)
+	}
+	g.Set(8, 3, nil)
+	if path, err = h.GetPath(0, 0, 15, 0); err != nil || len(path) != 22 {
+		t.Fatalf("Expected path through gap, got %v %v", path, err)
+	}
+}
+
+func TestHierarchicalPathClusterSize(t *testing.T) {
+	if _, err := NewHierarchicalPathfinder(NewGrid(8, 8, 1), 0, PathOptions{}); err == nil {
+		t.Fatalf("Expected error for a cluster size of 0")
+	}
+}
+
+func BenchmarkHierarchicalPath256(b *testing.B) {
+	var (
+		g    = newRandomUniformGrid(1, 256, 0.1)
+		h, _ = NewHierarchicalPathfinder(g, 16, PathOptions{Diagonals: DiagonalNoObstacles})
+	)
+	defer h.Delete()
+	if _, err := h.GetPath(0, 0, 255, 255); err != nil {
+		b.Fatalf("Expected path: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.GetPath(0, 0, 255, 255)
+	}
+}
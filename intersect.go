@@ -0,0 +1,246 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"math"
+	"sort"
+)
+
+type Segment struct {
+	A Point
+	B Point
+}
+
+// Returns the point t of the way from A to B.
+func (s Segment) At(t float32) Point {
+	return s.A.Lerp(s.B, t)
+}
+
+// A half line starting at Origin.  Direction need not be unit length;
+// positions along the ray are measured in multiples of it.
+type Ray struct {
+	Origin    Point
+	Direction Point
+}
+
+// Returns the ray from a through b.
+func RayTo(a, b Point) Ray {
+	return Ray{a, b.Sub(a)}
+}
+
+func (r Ray) At(t float32) Point {
+	return r.Origin.Add(r.Direction.Scale(t))
+}
+
+// Where a segment or ray meets something.
+type LineHit struct {
+	Point  Point
+	T      float32 // Position along the segment, from 0 to 1, or the ray.
+	U      float32 // Position along the segment hit, from 0 to 1, if there is one.
+	Normal Point   // Unit normal of the surface hit, facing back along the line.  Zero if the line starts inside or runs along it.
+}
+
+// Positions along a segment within this of its ends, and lines within this
+// angle or distance, relative to length, of each other, are treated as
+// meeting there, so that rounding cannot lose hits on corners.
+const intersectEpsilon = 1e-5
+
+// Returns the positions along the lines through a1, a2 and b1, b2 where
+// they cross, measured in multiples of a2-a1 and b2-b1.  Returns false if
+// the lines are parallel.
+func lineParams(a1, a2, b1, b2 Point) (t, u float32, ok bool) {
+	var (
+		sideOfB = GetVectorDeterminantEquation(b1, b2)
+		sideOfA = GetVectorDeterminantEquation(a1, a2)
+		d1      = sideOfB(a1)
+		d2      = sideOfB(a2)
+	)
+	if d1 == d2 {
+		return
+	}
+	t = d1 / (d1 - d2)
+	u = sideOfA(b1) / (sideOfA(b1) - sideOfA(b2))
+	return t, u, true
+}
+
+// Returns the unit normal of the line through a, b on the side facing p.
+func facingNormal(a, b, p Point) (n Point) {
+	n = b.Sub(a).Perp().Normalize()
+	if n.Dot(p.Sub(a)) < 0 {
+		n = n.Scale(-1)
+	}
+	return
+}
+
+// Returns where a first meets b.  Segments lying along each other meet
+// where their overlap starts, nearest a.A.
+func IntersectSegments(a, b Segment) (hit LineHit, ok bool) {
+	var (
+		d     = a.B.Sub(a.A)
+		e     = b.B.Sub(b.A)
+		cross = d.Cross(e)
+	)
+	if cross*cross <= intersectEpsilon*intersectEpsilon*d.Dot(d)*e.Dot(e) {
+		return collinearOverlap(a, b)
+	}
+	var t, u, crosses = lineParams(a.A, a.B, b.A, b.B)
+	if !crosses || t < -intersectEpsilon || t > 1+intersectEpsilon || u < -intersectEpsilon || u > 1+intersectEpsilon {
+		return
+	}
+	hit.T = minFloat32(maxFloat32(t, 0), 1)
+	hit.U = minFloat32(maxFloat32(u, 0), 1)
+	hit.Point = a.At(hit.T)
+	hit.Normal = facingNormal(b.A, b.B, a.A)
+	return hit, true
+}
+
+func collinearOverlap(a, b Segment) (hit LineHit, ok bool) {
+	var (
+		d     = a.B.Sub(a.A)
+		l     = d.Dot(d)
+		param = func(p Point) float32 {
+			return p.Sub(a.A).Dot(d) / l
+		}
+	)
+	// The cross product is the distance between the lines times |d|.
+	if cross := a.A.Sub(b.A).Cross(d); l == 0 || cross*cross > intersectEpsilon*intersectEpsilon*l*l {
+		return // Degenerate or parallel but apart.
+	}
+	var (
+		t1 = param(b.A)
+		t2 = param(b.B)
+		lo = maxFloat32(minFloat32(t1, t2), 0)
+		hi = minFloat32(maxFloat32(t1, t2), 1)
+	)
+	if lo > hi {
+		return
+	}
+	hit.T = lo
+	hit.Point = a.At(lo)
+	if t1 != t2 {
+		hit.U = (lo - t1) / (t2 - t1)
+	}
+	return hit, true
+}
+
+// Returns where r meets s.  Rays running along the segment do not meet it.
+func IntersectRaySegment(r Ray, s Segment) (hit LineHit, ok bool) {
+	var t, u, crosses = lineParams(r.Origin, r.At(1), s.A, s.B)
+	if !crosses || t < 0 || u < 0 || u > 1 {
+		return
+	}
+	hit.T = t
+	hit.U = u
+	hit.Point = r.At(t)
+	hit.Normal = facingNormal(s.A, s.B, r.Origin)
+	return hit, true
+}
+
+// Returns where r enters rect, using the slab method.  A ray starting
+// inside hits at once.
+func IntersectRayRect(r Ray, rect Rectangle) (hit LineHit, ok bool) {
+	var (
+		enter = float32(0)
+		exit  = float32(math.MaxFloat32)
+	)
+	for axis := 0; axis < 2; axis++ {
+		var (
+			o  = r.Origin.Vec2[axis]
+			d  = r.Direction.Vec2[axis]
+			lo = rect.Min.Vec2[axis]
+			hi = rect.Max.Vec2[axis]
+		)
+		if d == 0 {
+			if o < lo || o > hi {
+				return
+			}
+			continue
+		}
+		var (
+			t1     = (lo - o) / d
+			t2     = (hi - o) / d
+			normal = Point{}
+		)
+		normal.Vec2[axis] = -1
+		if t1 > t2 {
+			t1, t2 = t2, t1
+			normal.Vec2[axis] = 1
+		}
+		if t1 > enter {
+			enter = t1
+			hit.Normal = normal
+		}
+		exit = minFloat32(exit, t2)
+		if enter > exit {
+			return
+		}
+	}
+	hit.T = enter
+	hit.Point = r.At(enter)
+	return hit, true
+}
+
+// Returns where r enters c.  A ray starting inside hits at once.
+func IntersectRayCircle(r Ray, c Circle) (hit LineHit, ok bool) {
+	var (
+		f    = r.Origin.Sub(c.Center)
+		qa   = r.Direction.Dot(r.Direction)
+		qb   = 2 * f.Dot(r.Direction)
+		qc   = f.Dot(f) - c.Radius*c.Radius
+		disc = qb*qb - 4*qa*qc
+	)
+	if qc <= 0 {
+		return LineHit{Point: r.Origin}, true
+	}
+	if qa == 0 || disc < 0 {
+		return
+	}
+	var t = (-qb - float32(math.Sqrt(float64(disc)))) / (2 * qa)
+	if t < 0 {
+		return
+	}
+	hit.T = t
+	hit.Point = r.At(t)
+	hit.Normal = hit.Point.Sub(c.Center).Normalize()
+	return hit, true
+}
+
+// Returns every point where s crosses the edges of p, nearest s.A first.
+// A segment through a corner crosses it once.
+func IntersectSegmentPolygon(s Segment, p Polygon) (hits []LineHit) {
+	for i, pt := range p.Points {
+		var edge = Segment{pt, p.Points[(i+1)%len(p.Points)]}
+		if hit, ok := IntersectSegments(s, edge); ok {
+			hits = append(hits, hit)
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].T < hits[j].T
+	})
+	for i := 1; i < len(hits); i++ {
+		if hits[i].T-hits[i-1].T <= intersectEpsilon {
+			hits = append(hits[:i], hits[i+1:]...)
+			i--
+		}
+	}
+	return
+}
+
+// Returns p bounced off a surface with the given unit normal, as a laser
+// would be.
+func (p Point) Reflect(normal Point) Point {
+	return p.Sub(normal.Scale(2 * p.Dot(normal)))
+}
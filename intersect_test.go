@@ -0,0 +1,119 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"testing"
+)
+
+func TestIntersectSegments(t *testing.T) {
+	var hit, ok = IntersectSegments(Segment{Pt(0, 0), Pt(4, 4)}, Segment{Pt(0, 4), Pt(4, 0)})
+	if !ok || hit.Point != Pt(2, 2) || hit.T != 0.5 || hit.U != 0.5 {
+		t.Fatalf("Unexpected hit %v", hit)
+	}
+	if !closePt(hit.Normal, Pt(-0.7071068, -0.7071068)) {
+		t.Fatalf("Expected normal to face the start, got %v", hit.Normal)
+	}
+	if _, ok = IntersectSegments(Segment{Pt(0, 0), Pt(1, 1)}, Segment{Pt(0, 4), Pt(4, 0)}); ok {
+		t.Fatalf("Short segment should not reach")
+	}
+	if _, ok = IntersectSegments(Segment{Pt(0, 0), Pt(4, 0)}, Segment{Pt(0, 1), Pt(4, 1)}); ok {
+		t.Fatalf("Parallel segments should not meet")
+	}
+	if hit, ok = IntersectSegments(Segment{Pt(0, 0), Pt(4, 0)}, Segment{Pt(6, 0), Pt(2, 0)}); !ok || hit.Point != Pt(2, 0) || hit.U != 1 {
+		t.Fatalf("Expected overlap to start at 2, 0, got %v", hit)
+	}
+}
+
+func TestIntersectRaySegment(t *testing.T) {
+	var (
+		wall     = Segment{Pt(3, -1), Pt(3, 1)}
+		hit, ok  = IntersectRaySegment(RayTo(Pt(0, 0), Pt(1, 0)), wall)
+		incoming = Pt(1, -1)
+	)
+	if !ok || hit.T != 3 || hit.Point != Pt(3, 0) || hit.Normal != Pt(-1, 0) {
+		t.Fatalf("Unexpected hit %v", hit)
+	}
+	if incoming.Reflect(hit.Normal) != Pt(-1, -1) {
+		t.Fatalf("Unexpected reflection %v", incoming.Reflect(hit.Normal))
+	}
+	if _, ok = IntersectRaySegment(RayTo(Pt(0, 0), Pt(-1, 0)), wall); ok {
+		t.Fatalf("Ray pointing away should not hit")
+	}
+}
+
+func TestIntersectRayRect(t *testing.T) {
+	var (
+		rect    = Rect(2, 2, 4, 4)
+		hit, ok = IntersectRayRect(RayTo(Pt(0, 3), Pt(1, 3)), rect)
+	)
+	if !ok || hit.T != 2 || hit.Point != Pt(2, 3) || hit.Normal != Pt(-1, 0) {
+		t.Fatalf("Unexpected hit %v", hit)
+	}
+	if hit, ok = IntersectRayRect(RayTo(Pt(3, 6), Pt(3, 5)), rect); !ok || hit.Point != Pt(3, 4) || hit.Normal != Pt(0, 1) {
+		t.Fatalf("Unexpected hit from above %v", hit)
+	}
+	if _, ok = IntersectRayRect(RayTo(Pt(0, 0), Pt(1, 3)), rect); ok {
+		t.Fatalf("Ray should pass above the rectangle")
+	}
+	if hit, ok = IntersectRayRect(RayTo(Pt(3, 3), Pt(4, 3)), rect); !ok || hit.T != 0 {
+		t.Fatalf("Ray inside should hit at once, got %v", hit)
+	}
+}
+
+func TestIntersectRayCircle(t *testing.T) {
+	var hit, ok = IntersectRayCircle(Ray{Pt(-5, 0), Pt(2, 0)}, Circle{Pt(0, 0), 1})
+	if !ok || hit.T != 2 || hit.Point != Pt(-1, 0) || hit.Normal != Pt(-1, 0) {
+		t.Fatalf("Unexpected hit %v", hit)
+	}
+	if _, ok = IntersectRayCircle(Ray{Pt(-5, 2), Pt(1, 0)}, Circle{Pt(0, 0), 1}); ok {
+		t.Fatalf("Ray should pass the circle")
+	}
+}
+
+func TestIntersectSegmentPolygon(t *testing.T) {
+	var (
+		square = Rect(0, 0, 2, 2).Polygon()
+		hits   = IntersectSegmentPolygon(Segment{Pt(-1, 1), Pt(3, 1)}, square)
+	)
+	if len(hits) != 2 || hits[0].Point != Pt(0, 1) || hits[1].Point != Pt(2, 1) {
+		t.Fatalf("Unexpected hits %v", hits)
+	}
+	if hits = IntersectSegmentPolygon(Segment{Pt(-1, -1), Pt(1, 1)}, square); len(hits) != 1 || hits[0].Point != Pt(0, 0) {
+		t.Fatalf("Expected one hit at the corner, got %v", hits)
+	}
+}
+
+func TestIntersectSegmentPolygonRoundedCorner(t *testing.T) {
+	// None of these coordinates are exact in floating point.
+	var tri = NewPolygon(Pt(0.3, 0.5), Pt(0.9, 0.1), Pt(1.3, 0.2))
+	for _, s := range []Segment{
+		{Pt(0.1, 0.7), Pt(0.7, 0.1)}, // Touches the corner.
+		{Pt(0.3, 0.1), Pt(0.3, 0.9)}, // Passes down the corner.
+	} {
+		var hits = IntersectSegmentPolygon(s, tri)
+		if len(hits) != 1 || !closePt(hits[0].Point, Pt(0.3, 0.5)) {
+			t.Fatalf("Expected one hit at the corner from %v, got %v", s, hits)
+		}
+	}
+}
+
+func TestIntersectSegmentsRoundedCollinear(t *testing.T) {
+	// Both lie along y = 3x, give or take rounding.
+	var hit, ok = IntersectSegments(Segment{Pt(0.1, 0.3), Pt(0.5, 1.5)}, Segment{Pt(0.2, 0.6), Pt(0.7, 2.1)})
+	if !ok || !closeTo(hit.T, 0.25) || !closePt(hit.Point, Pt(0.2, 0.6)) {
+		t.Fatalf("Expected overlap to start at 0.2, 0.6, got %v %v", hit, ok)
+	}
+}
@@ -0,0 +1,394 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Jump point search as described in "Online Graph Pruning for Pathfinding on
+// Grid Maps", Harabor & Grastien, 2011, without corner cutting.  The
+// precomputed variant follows "JPS+: Over 100x Faster than A*", Rabin, 2015.
+
+package twodee
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// Selects the search used by GetPathWithOptions.
+type PathAlgorithm int
+
+const (
+	AStar PathAlgorithm = iota
+	// Jump point search.  Only supports DiagonalNoObstacles; searches
+	// with other modes fail.  Movement costs are ignored, so this should
+	// only be used on grids where every open cell costs the same.
+	JumpPointSearch
+	// Jump point search using jump distances precomputed for every cell.
+	// The table is built on first use, and the entries which pass a cell
+	// are filled in again after Set changes whether it is walkable.
+	JumpPointSearchPlus
+)
+
+// Directions in clockwise order starting north.  Even indices are cardinal.
+var (
+	jumpXs = [8]int32{0, 1, 1, 1, 0, -1, -1, -1}
+	jumpYs = [8]int32{1, 1, 0, -1, -1, -1, 0, 1}
+)
+
+// Directions worth searching when arriving at a node travelling in each
+// direction.  The start node searches all of them.
+var (
+	allJumpDirections   = []int{0, 1, 2, 3, 4, 5, 6, 7}
+	validJumpDirections [8][]int
+)
+
+func init() {
+	for dir := 0; dir < 8; dir++ {
+		if dir%2 == 0 {
+			validJumpDirections[dir] = []int{(dir + 6) % 8, (dir + 7) % 8, dir, (dir + 1) % 8, (dir + 2) % 8}
+		} else {
+			validJumpDirections[dir] = []int{(dir + 7) % 8, dir, (dir + 1) % 8}
+		}
+	}
+}
+
+func signInt32(v int32) int32 {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	}
+	return 0
+}
+
+func jumpDirection(dx, dy int32) int {
+	dx = signInt32(dx)
+	dy = signInt32(dy)
+	for dir := 0; dir < 8; dir++ {
+		if jumpXs[dir] == dx && jumpYs[dir] == dy {
+			return dir
+		}
+	}
+	return -1
+}
+
+// Returns true if arriving at x, y travelling dx, dy along a row or column
+// uncovers a neighbour which can't be reached more cheaply another way.
+func (g *Grid) isJumpPoint(x, y, dx, dy int32) bool {
+	return (g.walkable(x+dy, y+dx) && !g.walkable(x-dx+dy, y-dy+dx)) ||
+		(g.walkable(x-dy, y-dx) && !g.walkable(x-dx-dy, y-dy-dx))
+}
+
+// Returns true if a single step from x, y in dir is allowed.
+func (g *Grid) canJumpStep(x, y int32, dir int) bool {
+	var (
+		dx = jumpXs[dir]
+		dy = jumpYs[dir]
+	)
+	if !g.walkable(x+dx, y+dy) {
+		return false
+	}
+	return dir%2 == 0 || (g.walkable(x+dx, y) && g.walkable(x, y+dy))
+}
+
+// Returns the number of steps from x, y in dir to the next jump point, or
+// if there is none, minus the number of steps which can be taken before
+// hitting a wall.
+func (g *Grid) scanJump(x, y int32, dir int) int32 {
+	var (
+		dx = jumpXs[dir]
+		dy = jumpYs[dir]
+		k  int32
+	)
+	for k = 0; g.canJumpStep(x, y, dir); k++ {
+		x += dx
+		y += dy
+		if dir%2 == 0 {
+			if g.isJumpPoint(x, y, dx, dy) {
+				return k + 1
+			}
+		} else if g.scanJump(x, y, (dir+7)%8) > 0 || g.scanJump(x, y, (dir+1)%8) > 0 {
+			return k + 1
+		}
+	}
+	return -k
+}
+
+// Jump distances for every cell and direction, as returned by scanJump.
+type jumpTable struct {
+	distances []int16
+	dirty     []GridPoint // Cells whose walkability changed since filling.
+}
+
+// Past this many changed cells, the table is rebuilt rather than patched.
+const maxDirtyJumps = 8
+
+// Cardinal directions are filled first, as diagonal entries read them.
+var jumpFillOrder = []int{0, 2, 4, 6, 1, 3, 5, 7}
+
+// Returns the jump table for the grid, building or patching it if needed.
+// Returns nil if the grid is too large for the table.
+func (g *Grid) getJumpTable() *jumpTable {
+	g.jumpsMutex.Lock()
+	defer g.jumpsMutex.Unlock()
+	if g.jumps == nil && g.Width <= math.MaxInt16 && g.Height <= math.MaxInt16 {
+		g.jumps = g.buildJumpTable()
+	}
+	if g.jumps != nil && len(g.jumps.dirty) > 0 {
+		g.patchJumpTable(g.jumps)
+	}
+	return g.jumps
+}
+
+// Marks the cell at index to be filled in again if the change from old to
+// val changes whether it is walkable.
+func (g *Grid) invalidateJumps(index int32, old, val GridItem) {
+	var (
+		wasOpen = old == nil || !old.Passable()
+		isOpen  = val == nil || !val.Passable()
+	)
+	if wasOpen == isOpen {
+		return
+	}
+	g.jumpsMutex.Lock()
+	if t := g.jumps; t != nil {
+		if len(t.dirty) >= maxDirtyJumps {
+			g.jumps = nil
+		} else {
+			var x, y = g.Coords(index)
+			t.dirty = append(t.dirty, GridPoint{x, y})
+		}
+	}
+	g.jumpsMutex.Unlock()
+}
+
+func (g *Grid) buildJumpTable() (t *jumpTable) {
+	t = &jumpTable{
+		distances: make([]int16, 8*len(g.points)),
+	}
+	for _, dir := range jumpFillOrder {
+		g.fillJumps(t, dir, nil)
+	}
+	return
+}
+
+// Fills in the entries of the table which a jump could carry past one of
+// the dirty cells.
+func (g *Grid) patchJumpTable(t *jumpTable) {
+	for _, dir := range jumpFillOrder {
+		g.fillJumps(t, dir, func(x, y int32) bool {
+			for _, c := range t.dirty {
+				if jumpPasses(x, y, dir, c) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	t.dirty = t.dirty[:0]
+}
+
+// Returns true if the jump table entry for x, y in dir may depend on the
+// walkability of c.  Cardinal jumps look at the rows or columns beside
+// them.  Diagonal jumps look along both cardinal directions from every
+// cell they pass, so only reach c from the quadrant behind it.
+func jumpPasses(x, y int32, dir int, c GridPoint) bool {
+	var (
+		dx     = jumpXs[dir]
+		dy     = jumpYs[dir]
+		aheadX = dx == 0 || (dx > 0 && x <= c.X+1) || (dx < 0 && x >= c.X-1)
+		aheadY = dy == 0 || (dy > 0 && y <= c.Y+1) || (dy < 0 && y >= c.Y-1)
+	)
+	switch {
+	case dx == 0:
+		return aheadY && absInt32(x-c.X) <= 1
+	case dy == 0:
+		return aheadX && absInt32(y-c.Y) <= 1
+	}
+	return aheadX && aheadY
+}
+
+// Fills in the entries for dir of the cells for which update returns true,
+// or of every cell if update is nil.
+func (g *Grid) fillJumps(t *jumpTable, dir int, update func(x, y int32) bool) {
+	var (
+		dx     = jumpXs[dir]
+		dy     = jumpYs[dir]
+		x0, x1 = int32(0), g.Width
+		y0, y1 = int32(0), g.Height
+		xs, ys = int32(1), int32(1)
+	)
+	// Visit cells furthest along dir first, so the next cell over has
+	// always been filled in.
+	if dx > 0 {
+		x0, x1, xs = g.Width-1, -1, -1
+	}
+	if dy > 0 {
+		y0, y1, ys = g.Height-1, -1, -1
+	}
+	for x := x0; x != x1; x += xs {
+		for y := y0; y != y1; y += ys {
+			if update == nil || update(x, y) {
+				t.distances[8*g.Index(x, y)+int32(dir)] = int16(g.tableJump(t, x, y, dir))
+			}
+		}
+	}
+}
+
+// Computes a jump table entry from the entries of the next cell along dir.
+func (g *Grid) tableJump(t *jumpTable, x, y int32, dir int) int32 {
+	var (
+		nx = x + jumpXs[dir]
+		ny = y + jumpYs[dir]
+		d  int32
+	)
+	if !g.canJumpStep(x, y, dir) {
+		return 0
+	}
+	if dir%2 == 0 {
+		if g.isJumpPoint(nx, ny, jumpXs[dir], jumpYs[dir]) {
+			return 1
+		}
+	} else if t.get(g, nx, ny, (dir+7)%8) > 0 || t.get(g, nx, ny, (dir+1)%8) > 0 {
+		return 1
+	}
+	if d = t.get(g, nx, ny, dir); d > 0 {
+		return d + 1
+	}
+	return d - 1
+}
+
+func (t *jumpTable) get(g *Grid, x, y int32, dir int) int32 {
+	return int32(t.distances[8*g.Index(x, y)+int32(dir)])
+}
+
+func (g *Grid) getJumpPointPath(ctx context.Context, x1, y1, x2, y2 int32, plus bool) (out []GridPoint, err error) {
+	var (
+		search   *pathSearch
+		table    *jumpTable
+		start    = g.Index(x1, y1)
+		goal     = g.Index(x2, y2)
+		current  int32
+		cx, cy   int32
+		dirs     []int
+		expanded int
+	)
+	if start == -1 || goal == -1 {
+		err = fmt.Errorf("No path found")
+		return
+	}
+	if plus {
+		table = g.getJumpTable()
+	}
+	search = g.getPathSearch()
+	defer g.putPathSearch(search)
+	search.relax(start, 0, 0, -1)
+	for search.Len() > 0 {
+		current = search.pop()
+		if expanded++; expanded%pathCancelInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				return
+			}
+		}
+		if current == goal {
+			return expandJumpPath(search.points(g, goal)), nil
+		}
+		cx, cy = g.Coords(current)
+		dirs = allJumpDirections
+		if parent := search.nodes[current].parent; parent != -1 {
+			px, py := g.Coords(parent)
+			dirs = validJumpDirections[jumpDirection(cx-px, cy-py)]
+		}
+		for _, dir := range dirs {
+			var (
+				dist   int32
+				steps  int32
+				dx, dy = jumpXs[dir], jumpYs[dir]
+				gx, gy = x2 - cx, y2 - cy
+				reach  int32
+			)
+			if table != nil {
+				dist = table.get(g, cx, cy, dir)
+			} else {
+				dist = g.scanJump(cx, cy, dir)
+			}
+			if reach = dist; reach < 0 {
+				reach = -reach
+			}
+			switch {
+			case dir%2 == 0 && signInt32(gx) == dx && signInt32(gy) == dy:
+				// Goal lies straight ahead.
+				if d := absInt32(gx) + absInt32(gy); d <= reach {
+					steps = d
+				}
+			case dir%2 == 1 && signInt32(gx) == dx && signInt32(gy) == dy:
+				// Goal lies in this quadrant; stop level with it so a
+				// straight jump can finish the path.
+				if absInt32(gx) <= reach || absInt32(gy) <= reach {
+					steps = absInt32(gx)
+					if absInt32(gy) < steps {
+						steps = absInt32(gy)
+					}
+				}
+			}
+			if steps == 0 && dist > 0 {
+				steps = dist
+			}
+			if steps == 0 {
+				continue
+			}
+			var (
+				nx   = cx + dx*steps
+				ny   = cy + dy*steps
+				cost = search.nodes[current].g + float32(steps)
+				h    = OctileHeuristic(absInt32(x2-nx), absInt32(y2-ny))
+			)
+			if dir%2 == 1 {
+				cost = search.nodes[current].g + math.Sqrt2*float32(steps)
+			}
+			search.relax(g.Index(nx, ny), cost, cost+h, current)
+		}
+	}
+	err = fmt.Errorf("No path found")
+	return
+}
+
+// Fills in the cells between jump points, which are always joined by
+// straight or diagonal lines.
+func expandJumpPath(points []GridPoint) (out []GridPoint) {
+	var count = 1
+	for i := 1; i < len(points); i++ {
+		dx := absInt32(points[i].X - points[i-1].X)
+		dy := absInt32(points[i].Y - points[i-1].Y)
+		if dy > dx {
+			dx = dy
+		}
+		count += int(dx)
+	}
+	out = make([]GridPoint, 1, count)
+	out[0] = points[0]
+	for i := 1; i < len(points); i++ {
+		var (
+			pt = points[i-1]
+			dx = signInt32(points[i].X - pt.X)
+			dy = signInt32(points[i].Y - pt.Y)
+		)
+		for pt != points[i] {
+			pt.X += dx
+			pt.Y += dy
+			out = append(out, pt)
+		}
+	}
+	return
+}
@@ -0,0 +1,174 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Builds a random grid where every open cell costs 1.
+func newRandomUniformGrid(seed int64, size int32, density float64) *Grid {
+	var g = newRandomGrid(seed, size, density)
+	for i, item := range g.points {
+		g.points[i] = testGridItem{blocked: item.Passable()}
+	}
+	return g
+}
+
+// Checks that path is made of single allowed steps from start to goal.
+func checkContiguous(t *testing.T, g *Grid, path []GridPoint, start, goal GridPoint) {
+	if path[0] != start || path[len(path)-1] != goal {
+		t.Fatalf("Path %v does not join %v and %v", path, start, goal)
+	}
+	for i := 1; i < len(path); i++ {
+		var (
+			dx = path[i].X - path[i-1].X
+			dy = path[i].Y - path[i-1].Y
+		)
+		if absInt32(dx) > 1 || absInt32(dy) > 1 || !g.walkable(path[i].X, path[i].Y) {
+			t.Fatalf("Invalid step from %v to %v", path[i-1], path[i])
+		}
+		if dx != 0 && dy != 0 && !g.canCutCorner(path[i-1].X, path[i-1].Y, dx, dy, DiagonalNoObstacles) {
+			t.Fatalf("Path cuts corner from %v to %v", path[i-1], path[i])
+		}
+	}
+}
+
+func TestJumpPointSearchMatchesAStar(t *testing.T) {
+	var algorithms = []PathAlgorithm{JumpPointSearch, JumpPointSearchPlus}
+	for seed := int64(0); seed < 30; seed++ {
+		var (
+			g    = newRandomUniformGrid(seed, 32, 0.3)
+			r    = rand.New(rand.NewSource(seed))
+			opts = PathOptions{Diagonals: DiagonalNoObstacles}
+		)
+		for q := 0; q < 10; q++ {
+			var (
+				start = GridPoint{r.Int31n(32), r.Int31n(32)}
+				goal  = GridPoint{r.Int31n(32), r.Int31n(32)}
+			)
+			if !g.walkable(start.X, start.Y) || !g.walkable(goal.X, goal.Y) {
+				continue
+			}
+			opts.Algorithm = AStar
+			expected, experr := g.GetPathWithOptions(start.X, start.Y, goal.X, goal.Y, opts)
+			for _, algorithm := range algorithms {
+				opts.Algorithm = algorithm
+				path, err := g.GetPathWithOptions(start.X, start.Y, goal.X, goal.Y, opts)
+				if (err == nil) != (experr == nil) {
+					t.Fatalf("Seed %v: algorithm %v got error %v, A* got %v", seed, algorithm, err, experr)
+				}
+				if err != nil {
+					continue
+				}
+				checkContiguous(t, g, path, start, goal)
+				if cost, want := pathCost(g, path), pathCost(g, expected); cost-want > 0.001 || want-cost > 0.001 {
+					t.Fatalf("Seed %v: algorithm %v found cost %v from %v to %v, A* found %v", seed, algorithm, cost, start, goal, want)
+				}
+			}
+		}
+	}
+}
+
+func TestJumpPointSearchPlusInvalidation(t *testing.T) {
+	var (
+		g = newTestGrid(
+			".....",
+			".....",
+			".....",
+		)
+		opts = PathOptions{Algorithm: JumpPointSearchPlus, Diagonals: DiagonalNoObstacles}
+		path []GridPoint
+		err  error
+	)
+	if path, err = g.GetPathWithOptions(0, 1, 4, 1, opts); err != nil || len(path) != 5 {
+		t.Fatalf("Expected straight path, got %v %v", path, err)
+	}
+	if g.jumps == nil {
+		t.Fatalf("Expected jump table to be built")
+	}
+	g.Set(2, 1, testGridItem{cost: 2})
+	if g.jumps == nil {
+		t.Fatalf("Changing cost should not invalidate jump table")
+	}
+	g.Set(2, 1, testGridItem{blocked: true})
+	if g.jumps == nil || len(g.jumps.dirty) != 1 {
+		t.Fatalf("Adding a wall should mark the cell to be filled in again")
+	}
+	if path, err = g.GetPathWithOptions(0, 1, 4, 1, opts); err != nil || len(path) != 5 {
+		t.Fatalf("Expected path around wall, got %v %v", path, err)
+	}
+	checkContiguous(t, g, path, GridPoint{0, 1}, GridPoint{4, 1})
+}
+
+func TestJumpPointSearchPlusPatch(t *testing.T) {
+	var (
+		g = newRandomUniformGrid(4, 32, 0.3)
+		r = rand.New(rand.NewSource(4))
+	)
+	g.getJumpTable()
+	for round := 0; round < 20; round++ {
+		// Some rounds change too many cells and rebuild instead.
+		for i := 0; i < 1+round%10; i++ {
+			g.Set(r.Int31n(32), r.Int31n(32), testGridItem{blocked: r.Intn(2) == 0})
+		}
+		var (
+			patched = g.getJumpTable()
+			built   = g.buildJumpTable()
+		)
+		for i, d := range built.distances {
+			if patched.distances[i] != d {
+				x, y := g.Coords(int32(i / 8))
+				t.Fatalf("Round %v: entry for %v,%v in direction %v is %v, expected %v", round, x, y, i%8, patched.distances[i], d)
+			}
+		}
+	}
+}
+
+func TestJumpPointSearchUnsupportedMode(t *testing.T) {
+	var g = newTestGrid("...")
+	for _, algorithm := range []PathAlgorithm{JumpPointSearch, JumpPointSearchPlus} {
+		var opts = PathOptions{Algorithm: algorithm, Diagonals: DiagonalNever}
+		if _, err := g.GetPathWithOptions(0, 0, 2, 0, opts); err == nil {
+			t.Fatalf("Expected error for jump point search without diagonals")
+		}
+	}
+}
+
+func benchmarkJumpPointSearch(b *testing.B, algorithm PathAlgorithm) {
+	var (
+		g    = newRandomUniformGrid(1, 256, 0.1)
+		opts = PathOptions{Algorithm: algorithm, Diagonals: DiagonalNoObstacles}
+	)
+	g.GetPathWithOptions(0, 0, 255, 255, opts)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.GetPathWithOptions(0, 0, 255, 255, opts)
+	}
+}
+
+func BenchmarkUniformAStar256(b *testing.B) {
+	benchmarkJumpPointSearch(b, AStar)
+}
+
+func BenchmarkJumpPointSearch256(b *testing.B) {
+	benchmarkJumpPointSearch(b, JumpPointSearch)
+}
+
+func BenchmarkJumpPointSearchPlus256(b *testing.B) {
+	benchmarkJumpPointSearch(b, JumpPointSearchPlus)
+}
@@ -0,0 +1,627 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Loads projects made with the LDtk level editor (https://ldtk.io).
+
+package twodee
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Values of the custom fields of levels and entities.  Int fields are int,
+// Float fields float64, Bool fields bool and String, Color, Enum and
+// FilePath fields string.  Arrays of ints are []int.  Other types are left
+// as decoded by encoding/json.  Null fields are nil.
+type LDtkFields map[string]interface{}
+
+func (f LDtkFields) GetString(name string) (val string, ok bool) {
+	val, ok = f[name].(string)
+	return
+}
+
+func (f LDtkFields) GetInt(name string) (val int, ok bool) {
+	val, ok = f[name].(int)
+	return
+}
+
+// Returns float and int fields as float64.
+func (f LDtkFields) GetFloat(name string) (val float64, ok bool) {
+	switch v := f[name].(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return
+}
+
+func (f LDtkFields) GetBool(name string) (val bool, ok bool) {
+	val, ok = f[name].(bool)
+	return
+}
+
+type LDtkTileset struct {
+	UID          int
+	Identifier   string
+	Path         string // Resolved relative to the project.  Empty for internal atlases.
+	Width        int    // In pixels.
+	Height       int
+	TileGridSize int
+	Spacing      int
+	Padding      int
+}
+
+func (ts *LDtkTileset) Metadata(pxPerUnit int) TileMetadata {
+	var step = ts.TileGridSize + ts.Spacing
+	return TileMetadata{
+		Path:          ts.Path,
+		PxPerUnit:     pxPerUnit,
+		TileWidth:     ts.TileGridSize,
+		TileHeight:    ts.TileGridSize,
+		FramesWide:    (ts.Width - 2*ts.Padding + ts.Spacing) / step,
+		FramesHigh:    (ts.Height - 2*ts.Padding + ts.Spacing) / step,
+		Interpolation: NearestInterpolation,
+	}
+}
+
+type LDtkTile struct {
+	ID    int
+	X, Y  int // Top left within the layer in pixels, y pointing down.
+	SrcX  int // Top left within the tileset image in pixels.
+	SrcY  int
+	FlipX bool
+	FlipY bool
+	Alpha float32
+}
+
+type LDtkEntity struct {
+	Identifier string
+	IID        string
+	GridX      int // Cell within the layer, y pointing down.
+	GridY      int
+	X, Y       int // Pivot position within the layer in pixels, y pointing down.
+	Width      int
+	Height     int
+	PivotX     float32 // Fraction of the size from the top left.
+	PivotY     float32
+	Tags       []string
+	Fields     LDtkFields
+}
+
+type LDtkLayer struct {
+	Identifier string
+	Type       string // IntGrid, Entities, Tiles or AutoLayer.
+	Width      int    // In cells.
+	Height     int
+	GridSize   int
+	Opacity    float32
+	Visible    bool
+	OffsetX    int // In pixels, y pointing down.
+	OffsetY    int
+	Tileset    *LDtkTileset
+	// Rows from the top down, 0 for empty cells.  Only for IntGrid layers.
+	IntGrid []int
+	// Identifiers of IntGrid values, which may be empty.
+	IntGridValues map[int]string
+	// Tiles from Tiles layers, or generated by auto-layer rules, in
+	// drawing order.
+	Tiles    []LDtkTile
+	Entities []*LDtkEntity
+}
+
+// Returns the IntGrid value at x, y, counting rows from the bottom of the
+// layer as Grid does.
+func (l *LDtkLayer) IntGridAt(x, y int) int {
+	if x < 0 || y < 0 || x >= l.Width || y >= l.Height || len(l.IntGrid) == 0 {
+		return 0
+	}
+	return l.IntGrid[(l.Height-y-1)*l.Width+x]
+}
+
+// A level next to another.  Dir is one of n, s, e or w, a diagonal such as
+// ne, < or > for levels at other depths, or o for overlapping levels.
+type LDtkNeighbour struct {
+	IID string
+	Dir string
+}
+
+type LDtkLevel struct {
+	Identifier string
+	IID        string
+	UID        int
+	WorldX     int // Top left in world pixels, y pointing down.
+	WorldY     int
+	WorldDepth int
+	Width      int // In pixels.
+	Height     int
+	Fields     LDtkFields
+	Neighbours []LDtkNeighbour
+	// Topmost first, as listed in LDtk.  Nil until loaded for projects
+	// which save levels to separate files.
+	Layers       []*LDtkLayer
+	externalPath string
+}
+
+func (l *LDtkLevel) Layer(identifier string) *LDtkLayer {
+	for _, layer := range l.Layers {
+		if layer.Identifier == identifier {
+			return layer
+		}
+	}
+	return nil
+}
+
+// Returns the entities with the given identifier from every layer.
+func (l *LDtkLevel) Entities(identifier string) (out []*LDtkEntity) {
+	for _, layer := range l.Layers {
+		for _, e := range layer.Entities {
+			if e.Identifier == identifier {
+				out = append(out, e)
+			}
+		}
+	}
+	return
+}
+
+// Returns the bounds of e in units with the origin at the bottom left of
+// the level and y pointing up.
+func (l *LDtkLevel) EntityBounds(e *LDtkEntity, pxPerUnit float32) Rectangle {
+	var (
+		left = float32(e.X) - e.PivotX*float32(e.Width)
+		top  = float32(e.Y) - e.PivotY*float32(e.Height)
+		y    = float32(l.Height) - top - float32(e.Height)
+	)
+	return Rect(
+		left/pxPerUnit,
+		y/pxPerUnit,
+		(left+float32(e.Width))/pxPerUnit,
+		(y+float32(e.Height))/pxPerUnit,
+	)
+}
+
+// Returns the tiles of layer ready for LoadBatch with its tileset's
+// metadata, positioned with the origin at the bottom left of the level.
+func (l *LDtkLevel) LayerTiles(layer *LDtkLayer) (out []TexturedTile) {
+	if layer.Tileset == nil {
+		return
+	}
+	var size = float32(layer.Tileset.TileGridSize)
+	for _, tile := range layer.Tiles {
+		out = append(out, TileQuad{
+			X:        float32(tile.X + layer.OffsetX),
+			Y:        float32(l.Height-tile.Y-layer.OffsetY) - size,
+			Width:    size,
+			Height:   size,
+			TextureX: float32(tile.SrcX),
+			TextureY: float32(tile.SrcY),
+			FlipX:    tile.FlipX,
+			FlipY:    tile.FlipY,
+		})
+	}
+	return
+}
+
+// A Batch holding the tiles of one layer.
+type LDtkBatch struct {
+	*Batch
+	Layer *LDtkLayer
+}
+
+// Loads a Batch for each layer with tiles, in drawing order, so the
+// bottommost layer comes first.
+func (l *LDtkLevel) LoadBatches(pxPerUnit int) (batches []*LDtkBatch, err error) {
+	for i := len(l.Layers) - 1; i >= 0; i-- {
+		var (
+			layer = l.Layers[i]
+			tiles = l.LayerTiles(layer)
+			batch *Batch
+		)
+		if len(tiles) == 0 || layer.Tileset.Path == "" {
+			continue
+		}
+		if batch, err = LoadBatch(tiles, layer.Tileset.Metadata(pxPerUnit)); err != nil {
+			for _, b := range batches {
+				b.Delete()
+			}
+			return nil, err
+		}
+		batches = append(batches, &LDtkBatch{batch, layer})
+	}
+	return
+}
+
+// Builds a Grid from an IntGrid layer.  item is called for every non-empty
+// cell with its value and that value's identifier, and may return nil to
+// leave the cell empty.
+func (l *LDtkLevel) Grid(identifier string, blockSize int32, item func(value int, name string) GridItem) (g *Grid, err error) {
+	var layer = l.Layer(identifier)
+	if layer == nil || layer.Type != "IntGrid" {
+		err = fmt.Errorf("No IntGrid layer named %v", identifier)
+		return
+	}
+	g = NewGrid(int32(layer.Width), int32(layer.Height), blockSize)
+	for y := 0; y < layer.Height; y++ {
+		for x := 0; x < layer.Width; x++ {
+			if value := layer.IntGridAt(x, y); value != 0 {
+				if val := item(value, layer.IntGridValues[value]); val != nil {
+					g.Set(int32(x), int32(y), val)
+				}
+			}
+		}
+	}
+	return
+}
+
+type LDtkProject struct {
+	// Free, GridVania, LinearHorizontal or LinearVertical.
+	WorldLayout     string
+	WorldGridWidth  int
+	WorldGridHeight int
+	DefaultGridSize int
+	Tilesets        map[int]*LDtkTileset // By UID.
+	Levels          []*LDtkLevel
+	dir             string
+	intGridValues   map[int]map[int]string // By layer definition UID.
+}
+
+// Returns the level with the given identifier, loading its layers first if
+// they are saved separately.
+func (p *LDtkProject) Level(identifier string) (level *LDtkLevel, err error) {
+	for _, l := range p.Levels {
+		if l.Identifier == identifier {
+			return l, p.loadLevel(l)
+		}
+	}
+	return nil, fmt.Errorf("No LDtk level named %v", identifier)
+}
+
+// Returns the level with the given instance ID, loading its layers first
+// if they are saved separately.
+func (p *LDtkProject) LevelByIID(iid string) (level *LDtkLevel, err error) {
+	for _, l := range p.Levels {
+		if l.IID == iid {
+			return l, p.loadLevel(l)
+		}
+	}
+	return nil, fmt.Errorf("No LDtk level with IID %v", iid)
+}
+
+// Returns the levels at depth overlapping the rectangle at x, y of the
+// given size in world pixels, with y pointing down.  Layers are not
+// loaded, so levels can be streamed in as the camera nears them.
+func (p *LDtkProject) LevelsIn(x, y, width, height, depth int) (out []*LDtkLevel) {
+	for _, l := range p.Levels {
+		if l.WorldDepth == depth &&
+			l.WorldX < x+width && l.WorldX+l.Width > x &&
+			l.WorldY < y+height && l.WorldY+l.Height > y {
+			out = append(out, l)
+		}
+	}
+	return
+}
+
+// Returns the level at depth containing the world pixel x, y, or nil.
+func (p *LDtkProject) LevelAt(x, y, depth int) *LDtkLevel {
+	if levels := p.LevelsIn(x, y, 1, 1, depth); len(levels) > 0 {
+		return levels[0]
+	}
+	return nil
+}
+
+// Returns the levels next to level, as worked out by LDtk.
+func (p *LDtkProject) Neighbours(level *LDtkLevel) (out []*LDtkLevel) {
+	for _, n := range level.Neighbours {
+		for _, l := range p.Levels {
+			if l.IID == n.IID {
+				out = append(out, l)
+			}
+		}
+	}
+	return
+}
+
+type ldtkFieldInstance struct {
+	Identifier string          `json:"__identifier"`
+	Type       string          `json:"__type"`
+	Value      json.RawMessage `json:"__value"`
+}
+
+func ldtkFields(fields []ldtkFieldInstance) (out LDtkFields, err error) {
+	out = LDtkFields{}
+	for _, field := range fields {
+		var value interface{}
+		switch field.Type {
+		case "Int":
+			var v *int
+			err = json.Unmarshal(field.Value, &v)
+			if v != nil {
+				value = *v
+			}
+		case "Array<Int>":
+			var v []int
+			err = json.Unmarshal(field.Value, &v)
+			value = v
+		default:
+			err = json.Unmarshal(field.Value, &value)
+		}
+		if err != nil {
+			return
+		}
+		out[field.Identifier] = value
+	}
+	return
+}
+
+type ldtkTile struct {
+	Px  [2]int  `json:"px"`
+	Src [2]int  `json:"src"`
+	F   int     `json:"f"`
+	T   int     `json:"t"`
+	A   float32 `json:"a"`
+}
+
+type ldtkEntity struct {
+	Identifier string              `json:"__identifier"`
+	IID        string              `json:"iid"`
+	Grid       [2]int              `json:"__grid"`
+	Pivot      [2]float32          `json:"__pivot"`
+	Tags       []string            `json:"__tags"`
+	Width      int                 `json:"width"`
+	Height     int                 `json:"height"`
+	Px         [2]int              `json:"px"`
+	Fields     []ldtkFieldInstance `json:"fieldInstances"`
+}
+
+type ldtkLayer struct {
+	Identifier     string       `json:"__identifier"`
+	Type           string       `json:"__type"`
+	Width          int          `json:"__cWid"`
+	Height         int          `json:"__cHei"`
+	GridSize       int          `json:"__gridSize"`
+	Opacity        float32      `json:"__opacity"`
+	OffsetX        int          `json:"__pxTotalOffsetX"`
+	OffsetY        int          `json:"__pxTotalOffsetY"`
+	TilesetUID     *int         `json:"__tilesetDefUid"`
+	LayerDefUID    int          `json:"layerDefUid"`
+	Visible        bool         `json:"visible"`
+	IntGrid        []int        `json:"intGridCsv"`
+	AutoLayerTiles []ldtkTile   `json:"autoLayerTiles"`
+	GridTiles      []ldtkTile   `json:"gridTiles"`
+	Entities       []ldtkEntity `json:"entityInstances"`
+}
+
+type ldtkLevel struct {
+	Identifier string              `json:"identifier"`
+	IID        string              `json:"iid"`
+	UID        int                 `json:"uid"`
+	WorldX     int                 `json:"worldX"`
+	WorldY     int                 `json:"worldY"`
+	WorldDepth int                 `json:"worldDepth"`
+	Width      int                 `json:"pxWid"`
+	Height     int                 `json:"pxHei"`
+	Fields     []ldtkFieldInstance `json:"fieldInstances"`
+	Layers     []ldtkLayer         `json:"layerInstances"`
+	External   string              `json:"externalRelPath"`
+	Neighbours []struct {
+		IID string `json:"levelIid"`
+		Dir string `json:"dir"`
+	} `json:"__neighbours"`
+}
+
+type ldtkTileset struct {
+	UID          int    `json:"uid"`
+	Identifier   string `json:"identifier"`
+	RelPath      string `json:"relPath"`
+	Width        int    `json:"pxWid"`
+	Height       int    `json:"pxHei"`
+	TileGridSize int    `json:"tileGridSize"`
+	Spacing      int    `json:"spacing"`
+	Padding      int    `json:"padding"`
+}
+
+type ldtkLayerDef struct {
+	UID           int `json:"uid"`
+	IntGridValues []struct {
+		Value      int    `json:"value"`
+		Identifier string `json:"identifier"`
+	} `json:"intGridValues"`
+}
+
+type ldtkWorld struct {
+	WorldLayout     string      `json:"worldLayout"`
+	WorldGridWidth  int         `json:"worldGridWidth"`
+	WorldGridHeight int         `json:"worldGridHeight"`
+	Levels          []ldtkLevel `json:"levels"`
+}
+
+type ldtkProject struct {
+	ldtkWorld
+	DefaultGridSize int `json:"defaultGridSize"`
+	Defs            struct {
+		Tilesets []ldtkTileset  `json:"tilesets"`
+		Layers   []ldtkLayerDef `json:"layers"`
+	} `json:"defs"`
+	Worlds []ldtkWorld `json:"worlds"`
+}
+
+// Loads a .ldtk project.  Levels saved to separate files are loaded when
+// first requested with Level or LevelByIID.
+func LoadLDtkProject(path string) (p *LDtkProject, err error) {
+	var contents []byte
+	if contents, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	return ParseLDtkProject(contents, filepath.Dir(path))
+}
+
+// Parses a project.  Tilesets and separately saved levels are found
+// relative to dir.
+func ParseLDtkProject(contents []byte, dir string) (p *LDtkProject, err error) {
+	var parsed ldtkProject
+	if err = json.Unmarshal(contents, &parsed); err != nil {
+		return
+	}
+	if len(parsed.Worlds) > 0 && len(parsed.Levels) == 0 {
+		// Projects with several worlds; their levels are merged.
+		parsed.ldtkWorld = parsed.Worlds[0]
+		for _, world := range parsed.Worlds[1:] {
+			parsed.Levels = append(parsed.Levels, world.Levels...)
+		}
+	}
+	p = &LDtkProject{
+		WorldLayout:     parsed.WorldLayout,
+		WorldGridWidth:  parsed.WorldGridWidth,
+		WorldGridHeight: parsed.WorldGridHeight,
+		DefaultGridSize: parsed.DefaultGridSize,
+		Tilesets:        map[int]*LDtkTileset{},
+		dir:             dir,
+		intGridValues:   map[int]map[int]string{},
+	}
+	for _, ts := range parsed.Defs.Tilesets {
+		var tileset = &LDtkTileset{
+			UID:          ts.UID,
+			Identifier:   ts.Identifier,
+			Width:        ts.Width,
+			Height:       ts.Height,
+			TileGridSize: ts.TileGridSize,
+			Spacing:      ts.Spacing,
+			Padding:      ts.Padding,
+		}
+		if ts.RelPath != "" {
+			tileset.Path = filepath.Join(dir, ts.RelPath)
+		}
+		p.Tilesets[ts.UID] = tileset
+	}
+	for _, def := range parsed.Defs.Layers {
+		var values = map[int]string{}
+		for _, v := range def.IntGridValues {
+			values[v.Value] = v.Identifier
+		}
+		p.intGridValues[def.UID] = values
+	}
+	for _, l := range parsed.Levels {
+		var level *LDtkLevel
+		if level, err = p.newLevel(l); err != nil {
+			return nil, err
+		}
+		p.Levels = append(p.Levels, level)
+	}
+	return
+}
+
+func (p *LDtkProject) newLevel(l ldtkLevel) (level *LDtkLevel, err error) {
+	level = &LDtkLevel{
+		Identifier:   l.Identifier,
+		IID:          l.IID,
+		UID:          l.UID,
+		WorldX:       l.WorldX,
+		WorldY:       l.WorldY,
+		WorldDepth:   l.WorldDepth,
+		Width:        l.Width,
+		Height:       l.Height,
+		externalPath: l.External,
+	}
+	for _, n := range l.Neighbours {
+		level.Neighbours = append(level.Neighbours, LDtkNeighbour{n.IID, n.Dir})
+	}
+	if level.Fields, err = ldtkFields(l.Fields); err != nil {
+		return
+	}
+	if l.Layers != nil {
+		level.Layers, err = p.newLayers(l.Layers)
+	}
+	return
+}
+
+// Reads the layers of a level saved to its own file.
+func (p *LDtkProject) loadLevel(level *LDtkLevel) (err error) {
+	var (
+		contents []byte
+		parsed   ldtkLevel
+	)
+	if level.Layers != nil || level.externalPath == "" {
+		return
+	}
+	if contents, err = ioutil.ReadFile(filepath.Join(p.dir, level.externalPath)); err != nil {
+		return
+	}
+	if err = json.Unmarshal(contents, &parsed); err != nil {
+		return
+	}
+	level.Layers, err = p.newLayers(parsed.Layers)
+	return
+}
+
+func (p *LDtkProject) newLayers(layers []ldtkLayer) (out []*LDtkLayer, err error) {
+	out = []*LDtkLayer{}
+	for _, l := range layers {
+		var layer = &LDtkLayer{
+			Identifier:    l.Identifier,
+			Type:          l.Type,
+			Width:         l.Width,
+			Height:        l.Height,
+			GridSize:      l.GridSize,
+			Opacity:       l.Opacity,
+			Visible:       l.Visible,
+			OffsetX:       l.OffsetX,
+			OffsetY:       l.OffsetY,
+			IntGrid:       l.IntGrid,
+			IntGridValues: p.intGridValues[l.LayerDefUID],
+		}
+		if l.TilesetUID != nil {
+			layer.Tileset = p.Tilesets[*l.TilesetUID]
+		}
+		var tiles = l.GridTiles
+		if l.Type != "Tiles" {
+			tiles = l.AutoLayerTiles
+		}
+		for _, t := range tiles {
+			layer.Tiles = append(layer.Tiles, LDtkTile{
+				ID:    t.T,
+				X:     t.Px[0],
+				Y:     t.Px[1],
+				SrcX:  t.Src[0],
+				SrcY:  t.Src[1],
+				FlipX: t.F&1 != 0,
+				FlipY: t.F&2 != 0,
+				Alpha: t.A,
+			})
+		}
+		for _, e := range l.Entities {
+			var entity = &LDtkEntity{
+				Identifier: e.Identifier,
+				IID:        e.IID,
+				GridX:      e.Grid[0],
+				GridY:      e.Grid[1],
+				X:          e.Px[0],
+				Y:          e.Px[1],
+				Width:      e.Width,
+				Height:     e.Height,
+				PivotX:     e.Pivot[0],
+				PivotY:     e.Pivot[1],
+				Tags:       e.Tags,
+			}
+			if entity.Fields, err = ldtkFields(e.Fields); err != nil {
+				return
+			}
+			layer.Entities = append(layer.Entities, entity)
+		}
+		out = append(out, layer)
+	}
+	return
+}
@@ -0,0 +1,217 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const TEST_LDTK_STRING = `{
+	"worldLayout": "Free",
+	"defaultGridSize": 16,
+	"defs": {
+		"tilesets": [{"uid": 7, "identifier": "Terrain", "relPath": "terrain.png",
+			"pxWid": 64, "pxHei": 32, "tileGridSize": 16, "spacing": 0, "padding": 0}],
+		"layers": [{"uid": 3, "intGridValues": [
+			{"value": 1, "identifier": "wall"},
+			{"value": 2, "identifier": "water"}]}]
+	},
+	"levels": [{
+		"identifier": "Start", "iid": "a-1", "uid": 0,
+		"worldX": 0, "worldY": 0, "worldDepth": 0, "pxWid": 48, "pxHei": 32,
+		"fieldInstances": [
+			{"__identifier": "music", "__type": "String", "__value": "calm"},
+			{"__identifier": "gravity", "__type": "Float", "__value": 9.5}],
+		"__neighbours": [{"levelIid": "b-2", "dir": "e"}],
+		"layerInstances": [{
+			"__identifier": "Entities", "__type": "Entities", "__cWid": 3, "__cHei": 2,
+			"__gridSize": 16, "__opacity": 1, "__pxTotalOffsetX": 0, "__pxTotalOffsetY": 0,
+			"__tilesetDefUid": null, "layerDefUid": 4, "visible": true,
+			"intGridCsv": [], "autoLayerTiles": [], "gridTiles": [],
+			"entityInstances": [{
+				"__identifier": "Player", "iid": "p-1", "__grid": [1, 0],
+				"__pivot": [0.5, 1], "__tags": ["actor"], "width": 16, "height": 16,
+				"px": [24, 16],
+				"fieldInstances": [
+					{"__identifier": "health", "__type": "Int", "__value": 3},
+					{"__identifier": "keys", "__type": "Array<Int>", "__value": [1, 4]},
+					{"__identifier": "target", "__type": "Int", "__value": null}]
+			}]
+		}, {
+			"__identifier": "Decor", "__type": "Tiles", "__cWid": 3, "__cHei": 2,
+			"__gridSize": 16, "__opacity": 1, "__pxTotalOffsetX": 0, "__pxTotalOffsetY": 0,
+			"__tilesetDefUid": 7, "layerDefUid": 5, "visible": true,
+			"intGridCsv": [], "autoLayerTiles": [], "entityInstances": [],
+			"gridTiles": [{"px": [32, 0], "src": [16, 0], "f": 1, "t": 1, "a": 1}]
+		}, {
+			"__identifier": "Collision", "__type": "IntGrid", "__cWid": 3, "__cHei": 2,
+			"__gridSize": 16, "__opacity": 1, "__pxTotalOffsetX": 0, "__pxTotalOffsetY": 0,
+			"__tilesetDefUid": 7, "layerDefUid": 3, "visible": true,
+			"intGridCsv": [1, 0, 2, 1, 1, 1], "gridTiles": [], "entityInstances": [],
+			"autoLayerTiles": [
+				{"px": [0, 0], "src": [0, 16], "f": 0, "t": 4, "a": 1},
+				{"px": [0, 16], "src": [0, 16], "f": 2, "t": 4, "a": 1}]
+		}]
+	}, {
+		"identifier": "Cave", "iid": "b-2", "uid": 1,
+		"worldX": 48, "worldY": 0, "worldDepth": 0, "pxWid": 32, "pxHei": 32,
+		"fieldInstances": [], "__neighbours": [{"levelIid": "a-1", "dir": "w"}],
+		"layerInstances": null, "externalRelPath": "levels/Cave.ldtkl"
+	}]
+}`
+
+const TEST_LDTKL_STRING = `{
+	"identifier": "Cave", "iid": "b-2", "uid": 1, "pxWid": 32, "pxHei": 32,
+	"layerInstances": [{
+		"__identifier": "Collision", "__type": "IntGrid", "__cWid": 2, "__cHei": 2,
+		"__gridSize": 16, "__opacity": 1, "__tilesetDefUid": null, "layerDefUid": 3,
+		"visible": true, "intGridCsv": [0, 2, 0, 0],
+		"autoLayerTiles": [], "gridTiles": [], "entityInstances": []
+	}]
+}`
+
+func loadTestLDtk(t *testing.T) (p *LDtkProject, level *LDtkLevel) {
+	var err error
+	if p, err = ParseLDtkProject([]byte(TEST_LDTK_STRING), "world"); err != nil {
+		t.Fatalf("Problem parsing project: %v", err)
+	}
+	if level, err = p.Level("Start"); err != nil {
+		t.Fatalf("Problem getting level: %v", err)
+	}
+	return
+}
+
+func TestLDtkGrid(t *testing.T) {
+	var (
+		_, level = loadTestLDtk(t)
+		g        *Grid
+		err      error
+	)
+	g, err = level.Grid("Collision", 1, func(value int, name string) GridItem {
+		if name == "wall" {
+			return testGridItem{blocked: true}
+		}
+		return testGridItem{cost: 2}
+	})
+	if err != nil {
+		t.Fatalf("Problem building grid: %v", err)
+	}
+	// The top row of the layer is the top row of the grid.
+	if g.Width != 3 || g.Height != 2 || g.Get(1, 1) != nil || !g.Get(0, 1).Passable() || g.Get(2, 1).Passable() {
+		t.Fatalf("Unexpected grid %v", g.points)
+	}
+	if !g.Get(1, 0).Passable() {
+		t.Fatalf("Expected wall along the bottom row")
+	}
+	if _, err = level.Grid("Decor", 1, nil); err == nil {
+		t.Fatalf("Expected error for a layer without an IntGrid")
+	}
+}
+
+func TestLDtkLayerTiles(t *testing.T) {
+	var (
+		_, level = loadTestLDtk(t)
+		decor    = level.LayerTiles(level.Layer("Decor"))
+		auto     = level.LayerTiles(level.Layer("Collision"))
+	)
+	if len(decor) != 1 || len(auto) != 2 {
+		t.Fatalf("Expected grid and auto-layer tiles, got %v and %v", len(decor), len(auto))
+	}
+	if x, y, w, h := decor[0].ScaledBounds(16); x != 2 || y != 1 || w != 1 || h != 1 {
+		t.Fatalf("Unexpected bounds %v %v %v %v", x, y, w, h)
+	}
+	if x, _, w, _ := decor[0].ScaledTextureBounds(64, 32); x != 32.0/64 || w != -16.0/64 {
+		t.Fatalf("Unexpected flipped texture bounds %v %v", x, w)
+	}
+	if _, y, _, h := auto[1].ScaledBounds(16); y != 0 || h != 1 {
+		t.Fatalf("Expected second auto tile on the bottom row, got %v %v", y, h)
+	}
+	if _, y, _, h := auto[1].ScaledTextureBounds(64, 32); y != 16.0/32 || h != -16.0/32 {
+		t.Fatalf("Unexpected vertically flipped texture bounds %v %v", y, h)
+	}
+	if meta := level.Layer("Decor").Tileset.Metadata(16); meta.Path != filepath.Join("world", "terrain.png") || meta.FramesWide != 4 || meta.FramesHigh != 2 {
+		t.Fatalf("Unexpected metadata %+v", meta)
+	}
+}
+
+func TestLDtkEntities(t *testing.T) {
+	var (
+		_, level = loadTestLDtk(t)
+		players  = level.Entities("Player")
+	)
+	if len(players) != 1 || players[0].IID != "p-1" || players[0].Tags[0] != "actor" {
+		t.Fatalf("Expected player, got %v", players)
+	}
+	var fields = players[0].Fields
+	if health, ok := fields.GetInt("health"); !ok || health != 3 {
+		t.Fatalf("Expected int field, got %v", fields)
+	}
+	if keys, ok := fields["keys"].([]int); !ok || len(keys) != 2 || keys[1] != 4 {
+		t.Fatalf("Expected int array field, got %v", fields["keys"])
+	}
+	if target, ok := fields["target"]; !ok || target != nil {
+		t.Fatalf("Expected null field, got %v", target)
+	}
+	if gravity, _ := level.Fields.GetFloat("gravity"); gravity != 9.5 {
+		t.Fatalf("Expected level field, got %v", level.Fields)
+	}
+	// Pivot at the bottom middle, 16 pixels down from the top.
+	if b := level.EntityBounds(players[0], 16); b != Rect(1, 1, 2, 2) {
+		t.Fatalf("Unexpected entity bounds %v", b)
+	}
+}
+
+func TestLDtkWorld(t *testing.T) {
+	var (
+		dir, err = ioutil.TempDir("", "ldtk")
+		p        *LDtkProject
+		cave     *LDtkLevel
+	)
+	if err != nil {
+		t.Fatalf("Problem creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "levels"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "world.ldtk"), []byte(TEST_LDTK_STRING), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "levels", "Cave.ldtkl"), []byte(TEST_LDTKL_STRING), 0644)
+	if p, err = LoadLDtkProject(filepath.Join(dir, "world.ldtk")); err != nil {
+		t.Fatalf("Problem loading project: %v", err)
+	}
+	if l := p.LevelAt(50, 10, 0); l == nil || l.Identifier != "Cave" || l.Layers != nil {
+		t.Fatalf("Expected unloaded cave at world position, got %v", l)
+	}
+	if levels := p.LevelsIn(40, 0, 16, 16, 0); len(levels) != 2 {
+		t.Fatalf("Expected both levels in rectangle, got %v", levels)
+	}
+	if p.LevelAt(10, 10, 1) != nil {
+		t.Fatalf("Expected no level at another depth")
+	}
+	start, _ := p.Level("Start")
+	if n := p.Neighbours(start); len(n) != 1 || n[0].Identifier != "Cave" {
+		t.Fatalf("Expected cave as neighbour, got %v", n)
+	}
+	if cave, err = p.LevelByIID("b-2"); err != nil {
+		t.Fatalf("Problem loading external level: %v", err)
+	}
+	if c := cave.Layer("Collision"); c == nil || c.IntGridAt(1, 1) != 2 || c.IntGridValues[2] != "water" {
+		t.Fatalf("Expected layers from external level, got %v", cave.Layers)
+	}
+	if _, err = p.Level("Missing"); err == nil {
+		t.Fatalf("Expected error for missing level")
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type PathRequest struct {
+	ID      int // Chosen by the caller to match results to requests.
+	From    GridPoint
+	To      GridPoint
+	Options PathOptions
+}
+
+// Sent through the GameEventHandler when a request finishes.  Err is set if
+// no path was found or the request was cancelled.
+type PathResultEvent struct {
+	*BasicGameEvent
+	Request PathRequest
+	Path    []GridPoint
+	Err     error
+}
+
+type pathJob struct {
+	ctx     context.Context
+	request PathRequest
+}
+
+// Runs path requests on a pool of goroutines against a snapshot of a grid.
+// Results are enqueued on a GameEventHandler, so observers receive them from
+// Poll on the game loop.  Workers wait for room in the handler's queue
+// rather than drop results, so it should be polled every frame.
+type PathService struct {
+	grid      *Grid
+	gridMutex sync.RWMutex
+	handler   *GameEventHandler
+	eventType GameEventType
+	jobs      chan pathJob
+	done      chan struct{}
+	closed    bool
+	closeLock sync.RWMutex
+	workers   sync.WaitGroup
+}
+
+func NewPathService(g *Grid, handler *GameEventHandler, eventType GameEventType, workers int) (s *PathService) {
+	if workers < 1 {
+		workers = 1
+	}
+	s = &PathService{
+		grid:      g.Copy(),
+		handler:   handler,
+		eventType: eventType,
+		jobs:      make(chan pathJob, 100),
+		done:      make(chan struct{}),
+	}
+	s.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	return
+}
+
+// Replaces the snapshot searched by later requests.  Requests already
+// running finish against the old snapshot.
+func (s *PathService) UpdateGrid(g *Grid) {
+	var snapshot = g.Copy()
+	s.gridMutex.Lock()
+	s.grid = snapshot
+	s.gridMutex.Unlock()
+}
+
+// Queues a request.  Returns an error without waiting if the queue is
+// full, which happens when results are not polled quickly enough.
+// Connectivity is not supported, as it belongs to the caller's grid
+// rather than the snapshot.  Cancelling ctx abandons the request whether
+// or not it has started; a result carrying ctx.Err() is still delivered.
+func (s *PathService) Request(ctx context.Context, request PathRequest) (err error) {
+	if request.Options.Connectivity != nil {
+		return fmt.Errorf("PathService does not support Connectivity")
+	}
+	s.closeLock.RLock()
+	defer s.closeLock.RUnlock()
+	if s.closed {
+		return fmt.Errorf("PathService is closed")
+	}
+	select {
+	case s.jobs <- pathJob{ctx, request}:
+	default:
+		err = fmt.Errorf("PathService queue is full")
+	}
+	return
+}
+
+// Stops the workers after queued requests finish.  Results which are
+// still waiting for room in the handler's queue are dropped.
+func (s *PathService) Close() {
+	s.closeLock.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.jobs)
+		close(s.done)
+	}
+	s.closeLock.Unlock()
+	s.workers.Wait()
+}
+
+func (s *PathService) work() {
+	defer s.workers.Done()
+	for job := range s.jobs {
+		var (
+			req    = job.request
+			result = &PathResultEvent{
+				BasicGameEvent: NewBasicGameEvent(s.eventType),
+				Request:        req,
+			}
+			grid *Grid
+		)
+		if result.Err = job.ctx.Err(); result.Err == nil {
+			s.gridMutex.RLock()
+			grid = s.grid
+			s.gridMutex.RUnlock()
+			result.Path, result.Err = grid.GetPathContext(job.ctx, req.From.X, req.From.Y, req.To.X, req.To.Y, req.Options)
+		}
+		s.handler.EnqueueWait(result, s.done)
+	}
+}
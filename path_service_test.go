@@ -0,0 +1,133 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const testPathResultEvent GameEventType = 0
+
+// Polls handler until count results arrive or a second passes.
+func pollPathResults(handler *GameEventHandler, count int) (results map[int]*PathResultEvent) {
+	var deadline = time.Now().Add(time.Second)
+	results = map[int]*PathResultEvent{}
+	handler.AddObserver(testPathResultEvent, func(e GETyper) {
+		result := e.(*PathResultEvent)
+		results[result.Request.ID] = result
+	})
+	for len(results) < count && time.Now().Before(deadline) {
+		handler.Poll()
+		time.Sleep(time.Millisecond)
+	}
+	return
+}
+
+func TestPathServiceDeliversResults(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"....",
+			".##.",
+			"....",
+		)
+		handler = NewGameEventHandler(1)
+		service = NewPathService(g, handler, testPathResultEvent, 2)
+		ctx     = context.Background()
+	)
+	defer service.Close()
+	service.Request(ctx, PathRequest{ID: 1, From: GridPoint{0, 1}, To: GridPoint{3, 1}})
+	service.Request(ctx, PathRequest{ID: 2, From: GridPoint{0, 1}, To: GridPoint{1, 1}})
+	results := pollPathResults(handler, 2)
+	if r := results[1]; r == nil || r.Err != nil || len(r.Path) != 6 {
+		t.Fatalf("Unexpected result for request 1: %v", r)
+	}
+	if r := results[2]; r == nil || r.Err == nil {
+		t.Fatalf("Expected error for request into wall, got %v", r)
+	}
+}
+
+func TestPathServiceSnapshot(t *testing.T) {
+	var (
+		g       = newTestGrid("...")
+		handler = NewGameEventHandler(1)
+		service = NewPathService(g, handler, testPathResultEvent, 1)
+		ctx     = context.Background()
+	)
+	defer service.Close()
+	g.Set(1, 0, testGridItem{blocked: true})
+	service.Request(ctx, PathRequest{ID: 1, From: GridPoint{0, 0}, To: GridPoint{2, 0}})
+	if r := pollPathResults(handler, 1)[1]; r == nil || r.Err != nil {
+		t.Fatalf("Expected snapshot to ignore later changes, got %v", r)
+	}
+	service.UpdateGrid(g)
+	service.Request(ctx, PathRequest{ID: 2, From: GridPoint{0, 0}, To: GridPoint{2, 0}})
+	if r := pollPathResults(handler, 1)[2]; r == nil || r.Err == nil {
+		t.Fatalf("Expected updated snapshot to block path, got %v", r)
+	}
+}
+
+func TestPathServiceCancel(t *testing.T) {
+	var (
+		g           = newRandomGrid(1, 64, 0.2)
+		handler     = NewGameEventHandler(1)
+		service     = NewPathService(g, handler, testPathResultEvent, 1)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer service.Close()
+	cancel()
+	service.Request(context.Background(), PathRequest{ID: 1, From: GridPoint{0, 0}, To: GridPoint{63, 63}})
+	if err := service.Request(ctx, PathRequest{ID: 2}); err != nil && err != context.Canceled {
+		t.Fatalf("Unexpected error queueing request: %v", err)
+	}
+	results := pollPathResults(handler, 2)
+	if r := results[1]; r == nil {
+		t.Fatalf("Expected result for request 1")
+	}
+	if r := results[2]; r != nil && r.Err != context.Canceled {
+		t.Fatalf("Expected cancelled request to report context.Canceled, got %v", r.Err)
+	}
+}
+
+func TestPathServiceQueueFull(t *testing.T) {
+	var (
+		g        = newTestGrid("...")
+		handler  = NewGameEventHandler(1)
+		service  = NewPathService(g, handler, testPathResultEvent, 2)
+		ctx      = context.Background()
+		accepted = 0
+		err      error
+	)
+	// Without polling, results fill the handler and then requests fill
+	// the queue, which must fail rather than block.
+	for ; accepted < 1000; accepted++ {
+		var req = PathRequest{ID: accepted, From: GridPoint{0, 0}, To: GridPoint{2, 0}}
+		if err = service.Request(ctx, req); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		t.Fatalf("Expected error once the queue is full")
+	}
+	if results := pollPathResults(handler, accepted); len(results) != accepted {
+		t.Fatalf("Expected %v results, got %v", accepted, len(results))
+	}
+	var conn = NewGridConnectivity(g, DiagonalNever)
+	if err = service.Request(ctx, PathRequest{Options: PathOptions{Connectivity: conn}}); err == nil {
+		t.Fatalf("Expected error for a request using Connectivity")
+	}
+	service.Close()
+}
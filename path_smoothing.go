@@ -0,0 +1,115 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// Returns the world space centre of the cell at x, y.
+func (g *Grid) cellCenter(x, y int32) mgl32.Vec2 {
+	return mgl32.Vec2{g.InversePosition(x), g.InversePosition(y)}
+}
+
+// Returns the cost of walking in a straight line between the centres of two
+// cells, charging each cell crossed for the distance walked inside it, or
+// false if the line crosses a blocked cell or cuts a corner mode forbids.
+func (g *Grid) lineCost(a, b GridPoint, mode DiagonalMode) (cost float32, ok bool) {
+	var (
+		from = g.cellCenter(a.X, a.Y)
+		to   = g.cellCenter(b.X, b.Y)
+		hits []RaycastHit
+		// Lines through the corner where four cells meet visit one of the
+		// cells beside it, but walk no further than this inside it.
+		corner = g.BlockSize * 1e-4
+	)
+	if mode == DiagonalNever {
+		// Passing a corner with both cells beside it open keeps to open
+		// cells as a path without diagonal steps does.
+		mode = DiagonalNoObstacles
+	}
+	g.Traverse(from, to, func(h RaycastHit) bool {
+		hits = append(hits, h)
+		return false
+	})
+	hits = append(hits, RaycastHit{Cell: b, Distance: to.Sub(from).Len()})
+	for i := 0; i+1 < len(hits); i++ {
+		var h, next = hits[i], hits[i+1]
+		if i > 0 && i+2 < len(hits) && next.Distance-h.Distance < corner {
+			// A diagonal step from the cell before to the cell after.
+			var prev = hits[i-1].Cell
+			if !g.canCutCorner(prev.X, prev.Y, next.Cell.X-prev.X, next.Cell.Y-prev.Y, mode) {
+				return 0, false
+			}
+			continue
+		}
+		if !g.walkable(h.Cell.X, h.Cell.Y) {
+			return 0, false
+		}
+		cost += (next.Distance - h.Distance) * g.movementCost(h.Cell.X, h.Cell.Y)
+	}
+	return cost / g.BlockSize, true
+}
+
+// Returns the cost GetPath charges for following path from i to j.
+func (g *Grid) segmentCost(path []GridPoint, i, j int) (cost float32) {
+	for k := i + 1; k <= j; k++ {
+		var (
+			dx   = absInt32(path[k].X - path[k-1].X)
+			dy   = absInt32(path[k].Y - path[k-1].Y)
+			dist = float32(math.Sqrt(float64(dx*dx + dy*dy)))
+		)
+		cost += dist * g.movementCost(path[k].X, path[k].Y)
+	}
+	return
+}
+
+// Removes waypoints from a path returned by GetPath wherever the waypoints
+// either side of them can be joined by a straight line which crosses no
+// blocked cells and costs roughly no more than the original route, so
+// smoothed paths still keep to cheap cells such as roads.  Lines only pass
+// through the corners of cells where opts.Diagonals allows, so opts should
+// be those the path was found with.  The result starts and ends at the same
+// points as path.
+func (g *Grid) SmoothPath(path []GridPoint, opts PathOptions) (out []GridPoint) {
+	var (
+		anchor = 0
+		i      int
+	)
+	if len(path) < 3 {
+		return append(out, path...)
+	}
+	out = append(out, path[0])
+	for i = 2; i < len(path); i++ {
+		cost, ok := g.lineCost(path[anchor], path[i], opts.Diagonals)
+		if ok && cost <= g.segmentCost(path, anchor, i)+0.0001 {
+			continue
+		}
+		anchor = i - 1
+		out = append(out, path[anchor])
+	}
+	return append(out, path[len(path)-1])
+}
+
+// Converts a path into world space, placing each waypoint in the centre of
+// its cell.  The result may be passed to NewLineGeometry for display.
+func (g *Grid) WorldPath(path []GridPoint) (out []mgl32.Vec2) {
+	out = make([]mgl32.Vec2, len(path))
+	for i, pt := range path {
+		out[i] = g.cellCenter(pt.X, pt.Y)
+	}
+	return
+}
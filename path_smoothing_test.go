@@ -0,0 +1,108 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"testing"
+)
+
+func TestSmoothPathOpen(t *testing.T) {
+	var (
+		g = newTestGrid(
+			".....",
+			".....",
+			".....",
+		)
+		path, _ = g.GetPath(0, 0, 4, 2)
+		out     = g.SmoothPath(path, PathOptions{})
+	)
+	if len(out) != 2 || out[0] != path[0] || out[1] != path[len(path)-1] {
+		t.Fatalf("Expected straight line, got %v", out)
+	}
+}
+
+func TestSmoothPathAroundWall(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"......",
+			"......",
+			"####..",
+			"......",
+		)
+		path, err = g.GetPath(0, 0, 0, 3)
+		out       = g.SmoothPath(path, PathOptions{})
+	)
+	if err != nil {
+		t.Fatalf("Expected path, got error %v", err)
+	}
+	if len(out) >= len(path) || len(out) < 3 {
+		t.Fatalf("Expected a few waypoints, got %v", out)
+	}
+	for i := 1; i < len(out); i++ {
+		if _, ok := g.lineCost(out[i-1], out[i], DiagonalNever); !ok {
+			t.Fatalf("Segment %v to %v crosses a wall", out[i-1], out[i])
+		}
+	}
+}
+
+func TestSmoothPathKeepsToRoads(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"99999",
+			"99999",
+			"1111.",
+		)
+		path, _ = g.GetPath(0, 0, 4, 2)
+		out     = g.SmoothPath(path, PathOptions{})
+	)
+	for _, pt := range out {
+		if pt.X == 4 && pt.Y == 0 {
+			return
+		}
+	}
+	t.Fatalf("Expected smoothed path to keep the corner of the road, got %v", out)
+}
+
+func TestSmoothPathCorners(t *testing.T) {
+	// The line from corner to corner passes between walls which only
+	// touch the cells on it at their corners.
+	var (
+		g = newTestGrid(
+			"...",
+			"..#",
+			".#.",
+		)
+		path = []GridPoint{{0, 0}, {0, 1}, {1, 1}, {1, 2}, {2, 2}}
+	)
+	for _, mode := range []DiagonalMode{DiagonalNever, DiagonalNoObstacles} {
+		if out := g.SmoothPath(path, PathOptions{Diagonals: mode}); len(out) < 3 {
+			t.Fatalf("Mode %v: expected not to cut the corners, got %v", mode, out)
+		}
+	}
+	if out := g.SmoothPath(path, PathOptions{Diagonals: DiagonalAlways}); len(out) != 2 {
+		t.Fatalf("Expected a straight line between the corners, got %v", out)
+	}
+}
+
+func TestWorldPath(t *testing.T) {
+	var (
+		g   = NewGrid(4, 4, 2)
+		out = g.WorldPath([]GridPoint{{0, 0}, {2, 1}})
+	)
+	if out[0] != (mgl32.Vec2{1, 1}) || out[1] != (mgl32.Vec2{5, 3}) {
+		t.Fatalf("Unexpected world path %v", out)
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"container/heap"
+)
+
+// Indexes items by splitting an area into quarters wherever it holds many
+// items.  Suits worlds where items cluster or vary widely in size.  Each
+// item is stored in the smallest quarter holding all of it, and items
+// outside Area are kept at the top of the tree.
+type QuadTree struct {
+	Area     Rectangle
+	MaxItems int // Items a quarter holds before it splits.
+	MaxDepth int // Times the area may be split.
+	root     *quadNode
+	items    map[Bounded]*quadEntry
+}
+
+type quadNode struct {
+	area     Rectangle
+	depth    int
+	parent   *quadNode
+	children []*quadNode // Nil for a leaf, or four quarters.
+	entries  []*quadEntry
+	count    int // Items in this node and those below it.
+}
+
+type quadEntry struct {
+	spatialEntry
+	node *quadNode
+}
+
+func NewQuadTree(area Rectangle) *QuadTree {
+	return &QuadTree{
+		Area:     area,
+		MaxItems: 8,
+		MaxDepth: 8,
+		root:     &quadNode{area: area},
+		items:    map[Bounded]*quadEntry{},
+	}
+}
+
+func (q *QuadTree) Len() int {
+	return len(q.items)
+}
+
+func (q *QuadTree) Insert(item Bounded) {
+	if _, ok := q.items[item]; ok {
+		q.Update(item)
+		return
+	}
+	var e = &quadEntry{spatialEntry: spatialEntry{item: item, bounds: item.Bounds()}}
+	q.items[item] = e
+	q.add(q.root, e)
+}
+
+// Moves item to the quarter for its current bounds.  Items which still
+// belong in the same quarter are not moved.
+func (q *QuadTree) Update(item Bounded) {
+	var e, ok = q.items[item]
+	if !ok {
+		q.Insert(item)
+		return
+	}
+	e.bounds = item.Bounds()
+	if n := e.node; (n == q.root || n.contains(e.bounds)) && n.child(e.bounds) == nil {
+		return
+	}
+	q.drop(e)
+	q.add(q.root, e)
+}
+
+func (q *QuadTree) Remove(item Bounded) {
+	if e, ok := q.items[item]; ok {
+		q.drop(e)
+		delete(q.items, item)
+	}
+}
+
+func (n *quadNode) contains(r Rectangle) bool {
+	return r.Min.X() >= n.area.Min.X() && r.Max.X() <= n.area.Max.X() &&
+		r.Min.Y() >= n.area.Min.Y() && r.Max.Y() <= n.area.Max.Y()
+}
+
+// Returns the child holding all of r, or nil.
+func (n *quadNode) child(r Rectangle) *quadNode {
+	for _, c := range n.children {
+		if c.contains(r) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Stores e in the deepest node below n which holds it, splitting the leaf
+// it lands in if that leaf is full.
+func (q *QuadTree) add(n *quadNode, e *quadEntry) {
+	for {
+		n.count++
+		var c = n.child(e.bounds)
+		if c == nil {
+			break
+		}
+		n = c
+	}
+	e.node = n
+	n.entries = append(n.entries, e)
+	if n.children == nil && len(n.entries) > q.MaxItems && n.depth < q.MaxDepth {
+		q.split(n)
+	}
+}
+
+func (q *QuadTree) split(n *quadNode) {
+	var (
+		mid = n.area.Midpoint()
+		min = n.area.Min
+		max = n.area.Max
+	)
+	n.children = []*quadNode{
+		{area: Rectangle{min, mid}},
+		{area: Rect(mid.X(), min.Y(), max.X(), mid.Y())},
+		{area: Rect(min.X(), mid.Y(), mid.X(), max.Y())},
+		{area: Rectangle{mid, max}},
+	}
+	for _, c := range n.children {
+		c.depth = n.depth + 1
+		c.parent = n
+	}
+	var entries = n.entries
+	n.entries = nil
+	for _, e := range entries {
+		n.count-- // Counted again by add.
+		q.add(n, e)
+	}
+}
+
+// Removes e from its node, and folds quarters back into their parent once
+// the parent could hold all their items.
+func (q *QuadTree) drop(e *quadEntry) {
+	var (
+		n     = e.node
+		count = len(n.entries)
+	)
+	for i, other := range n.entries {
+		if other == e {
+			n.entries[i] = n.entries[count-1]
+			n.entries[count-1] = nil
+			n.entries = n.entries[:count-1]
+			break
+		}
+	}
+	e.node = nil
+	for ; n != nil; n = n.parent {
+		n.count--
+		if n.children != nil && n.count <= q.MaxItems {
+			n.merge()
+		}
+	}
+}
+
+func (n *quadNode) merge() {
+	for _, c := range n.children {
+		if c.children != nil {
+			c.merge()
+		}
+		for _, e := range c.entries {
+			e.node = n
+			n.entries = append(n.entries, e)
+		}
+	}
+	n.children = nil
+}
+
+// Calls visit for each item in n and the nodes below it which touch area.
+func (n *quadNode) each(area Rectangle, visit func(e *spatialEntry)) {
+	for _, e := range n.entries {
+		visit(&e.spatialEntry)
+	}
+	for _, c := range n.children {
+		if c.count > 0 && touches(c.area, area) {
+			c.each(area, visit)
+		}
+	}
+}
+
+func (q *QuadTree) QueryRect(area Rectangle, out []Bounded) []Bounded {
+	q.root.each(area, func(e *spatialEntry) {
+		if e.bounds.Overlaps(area) {
+			out = append(out, e.item)
+		}
+	})
+	return out
+}
+
+func (q *QuadTree) QueryPoint(p Point, out []Bounded) []Bounded {
+	q.root.each(Rectangle{p, p}, func(e *spatialEntry) {
+		if e.bounds.ContainsPoint(p) {
+			out = append(out, e.item)
+		}
+	})
+	return out
+}
+
+// Nodes and items waiting to be visited by Nearest, closest first.
+type quadQueue []quadQueued
+
+type quadQueued struct {
+	dist  float32
+	node  *quadNode
+	entry *quadEntry
+}
+
+func (h quadQueue) Len() int            { return len(h) }
+func (h quadQueue) Less(i, j int) bool  { return h[i].dist < h[j].dist }
+func (h quadQueue) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *quadQueue) Push(x interface{}) { *h = append(*h, x.(quadQueued)) }
+func (h *quadQueue) Pop() (x interface{}) {
+	var last = len(*h) - 1
+	x = (*h)[last]
+	*h = (*h)[:last]
+	return
+}
+
+// Visits nodes and items in order of distance from p, so that the first k
+// items reached are the nearest.
+func (q *QuadTree) Nearest(p Point, k int) (out []Bounded) {
+	var queue = &quadQueue{{node: q.root}}
+	for queue.Len() > 0 && len(out) < k {
+		var next = heap.Pop(queue).(quadQueued)
+		if next.entry != nil {
+			out = append(out, next.entry.item)
+			continue
+		}
+		for _, e := range next.node.entries {
+			heap.Push(queue, quadQueued{dist: boundsDistance(p, e.bounds), entry: e})
+		}
+		for _, c := range next.node.children {
+			if c.count > 0 {
+				heap.Push(queue, quadQueued{dist: boundsDistance(p, c.area), node: c})
+			}
+		}
+	}
+	return
+}
+
+func (q *QuadTree) Raycast(from, to Point) (hits []SpatialHit) {
+	q.root.raycast(from, to, &hits)
+	sortSpatialHits(hits)
+	return
+}
+
+func (n *quadNode) raycast(from, to Point, hits *[]SpatialHit) {
+	for _, e := range n.entries {
+		if hit, ok := e.raycast(from, to); ok {
+			*hits = append(*hits, hit)
+		}
+	}
+	for _, c := range n.children {
+		if c.count == 0 {
+			continue
+		}
+		if hit, ok := IntersectRayRect(RayTo(from, to), c.area); ok && hit.T <= 1 {
+			c.raycast(from, to, hits)
+		}
+	}
+}
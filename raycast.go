@@ -0,0 +1,137 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Traversal follows "A Fast Voxel Traversal Algorithm for Ray Tracing",
+// Amanatides & Woo, 1987.
+
+package twodee
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// Decides whether a grid item stops a ray.
+type GridItemPredicate func(item GridItem) bool
+
+// Matches items which block sight.
+func OpaqueItem(item GridItem) bool {
+	return item != nil && item.Opaque()
+}
+
+// Matches items which block movement, as in FixMove.
+func SolidItem(item GridItem) bool {
+	return item != nil && item.Passable()
+}
+
+type RaycastHit struct {
+	Cell     GridPoint
+	Point    mgl32.Vec2 // World space point where the ray entered Cell.
+	Normal   mgl32.Vec2 // Face of Cell which was hit, zero if the ray started inside it.
+	Distance float32    // World space distance from the start of the ray to Point.
+}
+
+// Called with each cell a ray passes through, in order.  Returning true
+// stops the traversal at that cell.
+type RaycastVisitor func(hit RaycastHit) (stop bool)
+
+// Returns the cell containing the world space point v.  Unlike
+// GridPosition, negative coordinates round down.
+func (g *Grid) cellAt(v float32) int32 {
+	return int32(math.Floor(float64(v / g.BlockSize)))
+}
+
+// Calls visit for each cell touched by the segment from, to, including the
+// cells containing both ends.  Returns the cell visit stopped at, if any.
+// Cells outside the grid are visited too, so callers may run rays in from
+// off the map.
+func (g *Grid) Traverse(from, to mgl32.Vec2, visit RaycastVisitor) (hit RaycastHit, ok bool) {
+	var (
+		size   = g.BlockSize
+		delta  = to.Sub(from)
+		length = delta.Len()
+		x      = g.cellAt(from[0])
+		y      = g.cellAt(from[1])
+		endX   = g.cellAt(to[0])
+		endY   = g.cellAt(to[1])
+		stepX  int32
+		stepY  int32
+		// Fraction of the segment at which the ray crosses the next
+		// vertical and horizontal cell boundaries.
+		tMaxX   = math.Inf(1)
+		tMaxY   = math.Inf(1)
+		tDeltaX = math.Inf(1)
+		tDeltaY = math.Inf(1)
+		t       float64
+		normal  mgl32.Vec2
+	)
+	if delta[0] > 0 {
+		stepX = 1
+		tMaxX = float64((float32(x+1)*size - from[0]) / delta[0])
+		tDeltaX = float64(size / delta[0])
+	} else if delta[0] < 0 {
+		stepX = -1
+		tMaxX = float64((float32(x)*size - from[0]) / delta[0])
+		tDeltaX = float64(-size / delta[0])
+	}
+	if delta[1] > 0 {
+		stepY = 1
+		tMaxY = float64((float32(y+1)*size - from[1]) / delta[1])
+		tDeltaY = float64(size / delta[1])
+	} else if delta[1] < 0 {
+		stepY = -1
+		tMaxY = float64((float32(y)*size - from[1]) / delta[1])
+		tDeltaY = float64(-size / delta[1])
+	}
+	for {
+		hit = RaycastHit{
+			Cell:     GridPoint{x, y},
+			Point:    from.Add(delta.Mul(float32(t))),
+			Normal:   normal,
+			Distance: float32(t) * length,
+		}
+		if visit(hit) {
+			ok = true
+			return
+		}
+		if x == endX && y == endY {
+			break
+		}
+		if tMaxX < tMaxY {
+			t = tMaxX
+			tMaxX += tDeltaX
+			x += stepX
+			normal = mgl32.Vec2{float32(-stepX), 0}
+		} else {
+			t = tMaxY
+			tMaxY += tDeltaY
+			y += stepY
+			normal = mgl32.Vec2{0, float32(-stepY)}
+		}
+		if t > 1 {
+			// Rounding may step past the final cell.
+			break
+		}
+	}
+	hit = RaycastHit{}
+	return
+}
+
+// Returns the first cell along the segment from, to whose item matches
+// blocks.
+func (g *Grid) Raycast(from, to mgl32.Vec2, blocks GridItemPredicate) (hit RaycastHit, ok bool) {
+	return g.Traverse(from, to, func(h RaycastHit) bool {
+		return blocks(g.Get(h.Cell.X, h.Cell.Y))
+	})
+}
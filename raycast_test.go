@@ -0,0 +1,100 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"testing"
+)
+
+func approxVec2(a, b mgl32.Vec2) bool {
+	var d = a.Sub(b)
+	return d[0] < 0.0001 && d[0] > -0.0001 && d[1] < 0.0001 && d[1] > -0.0001
+}
+
+func TestRaycastHit(t *testing.T) {
+	var (
+		g = newTestGrid(
+			".....",
+			"...#.",
+			".....",
+		)
+		hit RaycastHit
+		ok  bool
+	)
+	g.BlockSize = 2
+	if hit, ok = g.Raycast(mgl32.Vec2{1, 3}, mgl32.Vec2{9, 3}, OpaqueItem); !ok {
+		t.Fatalf("Expected ray to hit wall")
+	}
+	if hit.Cell != (GridPoint{3, 1}) {
+		t.Fatalf("Expected hit at 3,1, got %v", hit.Cell)
+	}
+	if !approxVec2(hit.Point, mgl32.Vec2{6, 3}) || hit.Distance != 5 {
+		t.Fatalf("Unexpected hit point %v distance %v", hit.Point, hit.Distance)
+	}
+	if hit.Normal != (mgl32.Vec2{-1, 0}) {
+		t.Fatalf("Expected normal facing left, got %v", hit.Normal)
+	}
+	if hit, ok = g.Raycast(mgl32.Vec2{9, 3}, mgl32.Vec2{1, 3}, OpaqueItem); !ok || hit.Normal != (mgl32.Vec2{1, 0}) {
+		t.Fatalf("Reversed ray should hit right face, got %v %v", hit, ok)
+	}
+	if !approxVec2(hit.Point, mgl32.Vec2{8, 3}) {
+		t.Fatalf("Unexpected reversed hit point %v", hit.Point)
+	}
+}
+
+func TestRaycastVertical(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"...",
+			".#.",
+			"...",
+		)
+		hit RaycastHit
+		ok  bool
+	)
+	if hit, ok = g.Raycast(mgl32.Vec2{1.5, 0.5}, mgl32.Vec2{1.5, 2.5}, OpaqueItem); !ok {
+		t.Fatalf("Expected vertical ray to hit wall")
+	}
+	if hit.Normal != (mgl32.Vec2{0, -1}) || !approxVec2(hit.Point, mgl32.Vec2{1.5, 1}) {
+		t.Fatalf("Unexpected vertical hit %v", hit)
+	}
+	if g.CanSee(mgl32.Vec2{1.5, 2.5}, mgl32.Vec2{1.5, 0.5}) {
+		t.Fatalf("CanSee should be blocked vertically")
+	}
+	if !g.CanSee(mgl32.Vec2{0.5, 2.5}, mgl32.Vec2{0.5, 0.5}) {
+		t.Fatalf("CanSee should see along clear column")
+	}
+}
+
+func TestTraverseVisitsCells(t *testing.T) {
+	var (
+		g     = NewGrid(4, 4, 1)
+		cells []GridPoint
+	)
+	g.Traverse(mgl32.Vec2{0.5, 0.25}, mgl32.Vec2{3.5, 1.75}, func(h RaycastHit) bool {
+		cells = append(cells, h.Cell)
+		return false
+	})
+	var expected = []GridPoint{{0, 0}, {1, 0}, {1, 1}, {2, 1}, {3, 1}}
+	if len(cells) != len(expected) {
+		t.Fatalf("Expected cells %v, got %v", expected, cells)
+	}
+	for i := range cells {
+		if cells[i] != expected[i] {
+			t.Fatalf("Expected cells %v, got %v", expected, cells)
+		}
+	}
+}
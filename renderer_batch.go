@@ -144,25 +144,36 @@ func triangles(t TexturedTile, ratio, texw, texh float32) [30]float32 {
 	var (
 		x, y, w, h     = t.ScaledBounds(ratio)
 		tx, ty, tw, th = t.ScaledTextureBounds(texw, texh)
+		// Texture coordinates for the bottom left, bottom right, top right
+		// and top left corners.
+		s = [4][2]float32{
+			{tx, ty},
+			{tx + tw, ty},
+			{tx + tw, ty + th},
+			{tx, ty + th},
+		}
 	)
+	if tt, ok := t.(TransposedTile); ok && tt.Transposed() {
+		s[1], s[3] = s[3], s[1]
+	}
 	return [30]float32{
 		x, y, 0.0,
-		tx, ty,
+		s[0][0], s[0][1],
 
 		x + w, y + h, 0.0,
-		tx + tw, ty + th,
+		s[2][0], s[2][1],
 
 		x, y + h, 0.0,
-		tx, ty + th,
+		s[3][0], s[3][1],
 
 		x, y, 0.0,
-		tx, ty,
+		s[0][0], s[0][1],
 
 		x + w, y, 0.0,
-		tx + tw, ty,
+		s[1][0], s[1][1],
 
 		x + w, y + h, 0.0,
-		tx + tw, ty + th,
+		s[2][0], s[2][1],
 	}
 }
 
@@ -0,0 +1,186 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"fmt"
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"image/color"
+	"unsafe"
+)
+
+// Draws ShapeGeometry filled with a colour, a texture, or a texture tinted
+// by a colour.
+type ShapeRenderer struct {
+	*Renderer
+	program       uint32
+	buffer        uint32
+	indexBuffer   uint32
+	bufferBytes   int
+	indexBytes    int
+	positionLoc   uint32
+	textureLoc    uint32
+	modelviewLoc  int32
+	projectionLoc int32
+	colorLoc      int32
+	texturedLoc   int32
+	samplerLoc    int32
+	offPosition   unsafe.Pointer
+	offTexture    unsafe.Pointer
+	stride        int32
+}
+
+const SHAPE_FRAGMENT = `#version 150
+precision mediump float;
+
+in vec2 v_TexturePos;
+uniform vec4 v_Color;
+uniform float f_Textured;
+uniform sampler2D u_Texture;
+out vec4 v_FragData;
+
+void main() {
+  vec4 texel = texture(u_Texture, v_TexturePos);
+  v_FragData = v_Color * mix(vec4(1.0), texel, f_Textured);
+}` + "\x00"
+
+const SHAPE_VERTEX = `#version 150
+in vec2 v_Position;
+in vec2 v_Texture;
+uniform mat4 m_ModelView;
+uniform mat4 m_Projection;
+out vec2 v_TexturePos;
+
+void main() {
+    v_TexturePos = v_Texture;
+    gl_Position = m_Projection * m_ModelView * vec4(v_Position, 0.0, 1.0);
+}` + "\x00"
+
+func NewShapeRenderer(camera *Camera) (sr *ShapeRenderer, err error) {
+	var (
+		program uint32
+		vbos    = make([]uint32, 2)
+		point   TexturedPoint
+	)
+	if program, err = BuildProgram(SHAPE_VERTEX, SHAPE_FRAGMENT); err != nil {
+		return
+	}
+	gl.GenBuffers(2, &vbos[0])
+	sr = &ShapeRenderer{
+		Renderer:      NewRenderer(camera),
+		program:       program,
+		buffer:        vbos[0],
+		indexBuffer:   vbos[1],
+		positionLoc:   uint32(gl.GetAttribLocation(program, gl.Str("v_Position\x00"))),
+		textureLoc:    uint32(gl.GetAttribLocation(program, gl.Str("v_Texture\x00"))),
+		modelviewLoc:  gl.GetUniformLocation(program, gl.Str("m_ModelView\x00")),
+		projectionLoc: gl.GetUniformLocation(program, gl.Str("m_Projection\x00")),
+		colorLoc:      gl.GetUniformLocation(program, gl.Str("v_Color\x00")),
+		texturedLoc:   gl.GetUniformLocation(program, gl.Str("f_Textured\x00")),
+		samplerLoc:    gl.GetUniformLocation(program, gl.Str("u_Texture\x00")),
+		offPosition:   gl.PtrOffset(int(unsafe.Offsetof(point.X))),
+		offTexture:    gl.PtrOffset(int(unsafe.Offsetof(point.TextureX))),
+		stride:        int32(unsafe.Sizeof(point)),
+	}
+	if e := gl.GetError(); e != 0 {
+		err = fmt.Errorf("ERROR: OpenGL error %X", e)
+	}
+	return
+}
+
+func (sr *ShapeRenderer) Bind() (err error) {
+	gl.UseProgram(sr.program)
+	gl.BindBuffer(gl.ARRAY_BUFFER, sr.buffer)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, sr.indexBuffer)
+	gl.EnableVertexAttribArray(sr.positionLoc)
+	gl.EnableVertexAttribArray(sr.textureLoc)
+	gl.VertexAttribPointer(sr.positionLoc, 2, gl.FLOAT, false, sr.stride, sr.offPosition)
+	gl.VertexAttribPointer(sr.textureLoc, 2, gl.FLOAT, false, sr.stride, sr.offTexture)
+	gl.UniformMatrix4fv(sr.projectionLoc, 1, false, &sr.Renderer.Camera.Projection[0])
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.Uniform1i(sr.samplerLoc, 0)
+	if e := gl.GetError(); e != 0 {
+		err = fmt.Errorf("ERROR: OpenGL error %X", e)
+	}
+	return
+}
+
+func (sr *ShapeRenderer) Unbind() (err error) {
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, 0)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	if e := gl.GetError(); e != 0 {
+		err = fmt.Errorf("ERROR: OpenGL error %X", e)
+	}
+	return
+}
+
+func (sr *ShapeRenderer) Draw(shape *ShapeGeometry, mv mgl32.Mat4, style *ShapeStyle) (err error) {
+	var (
+		dataBytes    = len(shape.Vertices) * int(sr.stride)
+		indexBytes   = len(shape.Indices) * 4
+		elementCount = int32(len(shape.Indices))
+		r, g, b, a   = uint32(0xffff), uint32(0xffff), uint32(0xffff), uint32(0xffff)
+		textured     = float32(0)
+	)
+	if elementCount == 0 {
+		return
+	}
+	if style.Color != nil {
+		r, g, b, a = style.Color.RGBA()
+	}
+	if style.Texture != nil {
+		style.Texture.Bind()
+		textured = 1
+	}
+	gl.Uniform1f(sr.texturedLoc, textured)
+	gl.Uniform4f(sr.colorLoc, float32(r)/0xffff, float32(g)/0xffff, float32(b)/0xffff, float32(a)/0xffff)
+	gl.UniformMatrix4fv(sr.modelviewLoc, 1, false, &mv[0])
+	if dataBytes > sr.bufferBytes {
+		sr.bufferBytes = dataBytes
+		gl.BufferData(gl.ARRAY_BUFFER, dataBytes, gl.Ptr(shape.Vertices), gl.STREAM_DRAW)
+	} else {
+		gl.BufferSubData(gl.ARRAY_BUFFER, 0, dataBytes, gl.Ptr(shape.Vertices))
+	}
+	if indexBytes > sr.indexBytes {
+		sr.indexBytes = indexBytes
+		gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, indexBytes, gl.Ptr(shape.Indices), gl.STREAM_DRAW)
+	} else {
+		gl.BufferSubData(gl.ELEMENT_ARRAY_BUFFER, 0, indexBytes, gl.Ptr(shape.Indices))
+	}
+	gl.DrawElements(gl.TRIANGLES, elementCount, gl.UNSIGNED_INT, gl.PtrOffset(0))
+	if e := gl.GetError(); e != 0 {
+		err = fmt.Errorf("ERROR: OpenGL error %X", e)
+	}
+	return
+}
+
+func (sr *ShapeRenderer) Delete() (err error) {
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, 0)
+	gl.DeleteBuffers(1, &sr.buffer)
+	gl.DeleteBuffers(1, &sr.indexBuffer)
+	gl.DeleteProgram(sr.program)
+	if e := gl.GetError(); e != 0 {
+		err = fmt.Errorf("ERROR: OpenGL error %X", e)
+	}
+	return
+}
+
+type ShapeStyle struct {
+	Color   color.Color // Fills the shape, or tints the texture.  White if nil.
+	Texture *Texture    // Stretched across the shape's bounds.  Optional.
+}
@@ -0,0 +1,380 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"fmt"
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"time"
+)
+
+const tilemapStep = 30 // Floats per tile, as written by triangles.
+
+// Draws large tile maps which change as the game runs.  Each layer is
+// split into square chunks with a buffer each.  Changing a tile only
+// rewrites its chunk, and chunks outside the camera are not drawn.
+//
+// Tiles are addressed like the cells of a Grid, so the tiles and changes
+// from an Autotiler can be passed straight through.
+type TilemapRenderer struct {
+	*BatchRenderer
+	Texture   *Texture
+	Metadata  TileMetadata
+	Width     int32 // In tiles.
+	Height    int32
+	ChunkSize int32 // Tiles along each side of a chunk.
+	Layers    []*TilemapLayer
+}
+
+type TilemapLayer struct {
+	Visible    bool
+	renderer   *TilemapRenderer
+	tiles      []TexturedTile
+	chunks     []*tilemapChunk
+	animations map[int32]*FrameAnimation
+	frames     map[int32]int // Animation frame last written for each tile.
+}
+
+type tilemapChunk struct {
+	batch  *Batch // Shares the renderer's texture.
+	bounds Rectangle
+	count  int // Tiles in the chunk.
+	dirty  bool
+}
+
+func NewTilemapRenderer(camera *Camera, metadata TileMetadata, width, height, chunkSize int32) (r *TilemapRenderer, err error) {
+	var (
+		batch     *BatchRenderer
+		texture   *Texture
+		smoothing = TextureSmoothing(metadata.Interpolation)
+	)
+	if chunkSize < 1 {
+		err = fmt.Errorf("Invalid chunk size %v", chunkSize)
+		return
+	}
+	if smoothing == 0 {
+		smoothing = Nearest
+	}
+	if texture, err = LoadTexture(metadata.Path, smoothing); err != nil {
+		return
+	}
+	if batch, err = NewBatchRenderer(camera); err != nil {
+		texture.Delete()
+		return
+	}
+	r = &TilemapRenderer{
+		BatchRenderer: batch,
+		Texture:       texture,
+		Metadata:      metadata,
+		Width:         width,
+		Height:        height,
+		ChunkSize:     chunkSize,
+	}
+	return
+}
+
+// Adds an empty layer, drawn above those added before it.
+func (r *TilemapRenderer) AddLayer() (l *TilemapLayer) {
+	var (
+		wide = (r.Width + r.ChunkSize - 1) / r.ChunkSize
+		high = (r.Height + r.ChunkSize - 1) / r.ChunkSize
+	)
+	l = &TilemapLayer{
+		Visible:    true,
+		renderer:   r,
+		tiles:      make([]TexturedTile, r.Width*r.Height),
+		chunks:     make([]*tilemapChunk, wide*high),
+		animations: map[int32]*FrameAnimation{},
+		frames:     map[int32]int{},
+	}
+	for i := range l.chunks {
+		l.chunks[i] = &tilemapChunk{}
+	}
+	r.Layers = append(r.Layers, l)
+	return
+}
+
+// Advances the animations of animated tiles, rewriting only the tiles
+// whose frame changed.
+func (r *TilemapRenderer) Update(elapsed time.Duration) {
+	var updated = map[*FrameAnimation]bool{}
+	for _, l := range r.Layers {
+		for _, anim := range l.animations {
+			if !updated[anim] {
+				updated[anim] = true
+				anim.Update(elapsed)
+			}
+		}
+	}
+	for _, l := range r.Layers {
+		for index, anim := range l.animations {
+			if l.frames[index] != anim.Current {
+				l.frames[index] = anim.Current
+				l.writeTile(index)
+			}
+		}
+	}
+}
+
+// Draws every visible layer, bottom first.  Call Bind first, as with
+// BatchRenderer.
+func (r *TilemapRenderer) Draw() (err error) {
+	for i := range r.Layers {
+		if err = r.DrawLayer(i); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Draws the chunks of one layer which may be seen by the camera, so that
+// sprites can be drawn between layers.
+func (r *TilemapRenderer) DrawLayer(i int) (err error) {
+	var l = r.Layers[i]
+	if !l.Visible {
+		return
+	}
+	for c, chunk := range l.chunks {
+		if chunk.dirty {
+			if err = l.rebuild(int32(c)); err != nil {
+				return
+			}
+		}
+		if chunk.count == 0 || !chunk.bounds.Overlaps(r.Camera.WorldBounds) {
+			continue
+		}
+		if err = r.BatchRenderer.Draw(chunk.batch, 0, 0, 0); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (r *TilemapRenderer) Delete() error {
+	for _, l := range r.Layers {
+		for _, chunk := range l.chunks {
+			if chunk.batch != nil {
+				gl.DeleteBuffers(1, &chunk.batch.Buffer)
+			}
+		}
+	}
+	r.Layers = nil
+	r.Texture.Delete()
+	return r.BatchRenderer.Delete()
+}
+
+func (l *TilemapLayer) Index(x, y int32) int32 {
+	var r = l.renderer
+	if x < 0 || y < 0 || x >= r.Width || y >= r.Height {
+		return -1
+	}
+	return r.Width*(r.Height-y-1) + x
+}
+
+func (l *TilemapLayer) Get(x, y int32) TexturedTile {
+	return l.GetIndex(l.Index(x, y))
+}
+
+func (l *TilemapLayer) GetIndex(index int32) TexturedTile {
+	if index < 0 || int(index) >= len(l.tiles) {
+		return nil
+	}
+	return l.tiles[index]
+}
+
+func (l *TilemapLayer) Set(x, y int32, tile TexturedTile) {
+	l.SetIndex(l.Index(x, y), tile)
+}
+
+// Sets the tile at index, or clears it if tile is nil.  Its chunk is
+// rebuilt before it is next drawn.
+func (l *TilemapLayer) SetIndex(index int32, tile TexturedTile) {
+	if index < 0 || int(index) >= len(l.tiles) {
+		return
+	}
+	l.tiles[index] = tile
+	l.chunks[l.chunkOf(index)].dirty = true
+}
+
+// Replaces every tile, for instance with those from Autotiler.Tiles.
+func (l *TilemapLayer) SetTiles(tiles []TexturedTile) {
+	for i := range l.tiles {
+		if i < len(tiles) {
+			l.tiles[i] = tiles[i]
+		} else {
+			l.tiles[i] = nil
+		}
+	}
+	for _, chunk := range l.chunks {
+		chunk.dirty = true
+	}
+}
+
+// Animates the tile at x, y.  The frames of anim count tiles along the rows
+// of the tileset from the tile's own texture, so a sequence of 0, 1, 2
+// steps through it and the next two tiles.  Many tiles may share an
+// animation to stay in step.  A nil anim stops the animation.
+func (l *TilemapLayer) Animate(x, y int32, anim *FrameAnimation) {
+	var index = l.Index(x, y)
+	if index == -1 {
+		return
+	}
+	if anim == nil {
+		delete(l.animations, index)
+		delete(l.frames, index)
+	} else {
+		l.animations[index] = anim
+		l.frames[index] = anim.Current
+	}
+	l.writeTile(index)
+}
+
+func (l *TilemapLayer) chunkOf(index int32) int32 {
+	var (
+		r    = l.renderer
+		x    = index % r.Width
+		y    = r.Height - index/r.Width - 1
+		wide = (r.Width + r.ChunkSize - 1) / r.ChunkSize
+	)
+	return (y/r.ChunkSize)*wide + x/r.ChunkSize
+}
+
+// Returns the position of the tile at index within its chunk's buffer.
+func (l *TilemapLayer) slotOf(index int32) int32 {
+	var (
+		r = l.renderer
+		x = index % r.Width
+		y = r.Height - index/r.Width - 1
+	)
+	return (y%r.ChunkSize)*r.ChunkSize + x%r.ChunkSize
+}
+
+// Returns the vertices of the tile at index, with its texture moved to the
+// current frame of any animation.
+func (l *TilemapLayer) vertices(index int32) (v [tilemapStep]float32) {
+	var (
+		r    = l.renderer
+		tile = l.tiles[index]
+		texw = float32(r.Texture.Width)
+		texh = float32(r.Texture.Height)
+	)
+	if tile == nil {
+		return
+	}
+	v = triangles(tile, float32(r.Metadata.PxPerUnit), texw, texh)
+	if frame := l.frames[index]; frame != 0 {
+		var (
+			wide = r.Metadata.FramesWide
+			dx   float32
+			dy   float32
+		)
+		if wide < 1 {
+			wide = 1
+		}
+		dx = float32(frame%wide*r.Metadata.TileWidth) / texw
+		// Textures are flipped, so moving down the image moves down in
+		// texture coordinates.
+		dy = -float32(frame/wide*r.Metadata.TileHeight) / texh
+		for i := 0; i < tilemapStep; i += 5 {
+			v[i+3] += dx
+			v[i+4] += dy
+		}
+	}
+	return
+}
+
+// Returns the vertices and bounds of the tiles in chunk c.
+func (l *TilemapLayer) chunkVertices(c int32) (data []float32, bounds Rectangle, count int) {
+	var (
+		r     = l.renderer
+		wide  = (r.Width + r.ChunkSize - 1) / r.ChunkSize
+		cx    = (c % wide) * r.ChunkSize
+		cy    = (c / wide) * r.ChunkSize
+		ratio = float32(r.Metadata.PxPerUnit)
+	)
+	data = make([]float32, r.ChunkSize*r.ChunkSize*tilemapStep)
+	for y := cy; y < cy+r.ChunkSize && y < r.Height; y++ {
+		for x := cx; x < cx+r.ChunkSize && x < r.Width; x++ {
+			var index = l.Index(x, y)
+			if l.tiles[index] == nil {
+				continue
+			}
+			var (
+				v            = l.vertices(index)
+				tx, ty, w, h = l.tiles[index].ScaledBounds(ratio)
+				b            = Rect(tx, ty, tx+w, ty+h)
+			)
+			copy(data[l.slotOf(index)*tilemapStep:], v[:])
+			if count == 0 {
+				bounds = b
+			} else {
+				bounds = Rect(
+					minFloat32(bounds.Min.X(), b.Min.X()),
+					minFloat32(bounds.Min.Y(), b.Min.Y()),
+					maxFloat32(bounds.Max.X(), b.Max.X()),
+					maxFloat32(bounds.Max.Y(), b.Max.Y()),
+				)
+			}
+			count++
+		}
+	}
+	return
+}
+
+// Rewrites the whole buffer of chunk c, creating it on first use.
+func (l *TilemapLayer) rebuild(c int32) (err error) {
+	var (
+		chunk               = l.chunks[c]
+		data, bounds, count = l.chunkVertices(c)
+		vbo                 uint32
+	)
+	if chunk.batch == nil {
+		if vbo, err = CreateVBO(len(data)*4, data, gl.DYNAMIC_DRAW); err != nil {
+			return
+		}
+		chunk.batch = &Batch{
+			Buffer:        vbo,
+			Texture:       l.renderer.Texture,
+			Count:         len(data) / 5,
+			textureOffset: Pt(0, 0),
+		}
+	} else {
+		gl.BindBuffer(gl.ARRAY_BUFFER, chunk.batch.Buffer)
+		gl.BufferSubData(gl.ARRAY_BUFFER, 0, len(data)*4, gl.Ptr(data))
+		gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+		if e := gl.GetError(); e != 0 {
+			err = fmt.Errorf("ERROR: OpenGL error %X", e)
+			return
+		}
+	}
+	chunk.bounds = bounds
+	chunk.count = count
+	chunk.dirty = false
+	return
+}
+
+// Rewrites a single tile in its chunk's buffer.  Chunks waiting to be
+// rebuilt pick up the change then.
+func (l *TilemapLayer) writeTile(index int32) {
+	var chunk = l.chunks[l.chunkOf(index)]
+	if chunk.dirty || chunk.batch == nil {
+		chunk.dirty = true
+		return
+	}
+	var v = l.vertices(index)
+	gl.BindBuffer(gl.ARRAY_BUFFER, chunk.batch.Buffer)
+	gl.BufferSubData(gl.ARRAY_BUFFER, int(l.slotOf(index))*tilemapStep*4, tilemapStep*4, gl.Ptr(&v[0]))
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"testing"
+	"time"
+)
+
+// Builds a renderer without a GL context, which is enough to check the
+// chunk bookkeeping.
+func newTestTilemapRenderer() *TilemapRenderer {
+	return &TilemapRenderer{
+		Texture:   &Texture{Width: 64, Height: 64},
+		Metadata:  TileMetadata{PxPerUnit: 16, TileWidth: 16, TileHeight: 16, FramesWide: 4, FramesHigh: 4},
+		Width:     5,
+		Height:    3,
+		ChunkSize: 2,
+	}
+}
+
+func TestTilemapChunks(t *testing.T) {
+	var (
+		r = newTestTilemapRenderer()
+		l = r.AddLayer()
+	)
+	if len(l.chunks) != 6 {
+		t.Fatalf("Expected 3x2 chunks, got %v", len(l.chunks))
+	}
+	l.Set(4, 2, TileQuad{X: 64, Y: 32, Width: 16, Height: 16})
+	l.Set(2, 0, TileQuad{X: 32, Y: 0, Width: 16, Height: 32})
+	if c := l.chunkOf(l.Index(4, 2)); c != 5 || !l.chunks[5].dirty {
+		t.Fatalf("Expected top right chunk to be dirty, got %v", c)
+	}
+	if l.chunks[0].dirty {
+		t.Fatalf("Expected bottom left chunk to stay clean")
+	}
+	data, bounds, count := l.chunkVertices(1)
+	if count != 1 || bounds != Rect(2, 0, 3, 2) {
+		t.Fatalf("Unexpected chunk bounds %v with %v tiles", bounds, count)
+	}
+	if len(data) != 4*tilemapStep || data[0] != 2 || data[tilemapStep] != 0 {
+		t.Fatalf("Expected tile in the first slot, got %v", data[:tilemapStep+1])
+	}
+	if _, _, count = l.chunkVertices(0); count != 0 {
+		t.Fatalf("Expected empty chunk")
+	}
+}
+
+func TestTilemapAnimation(t *testing.T) {
+	var (
+		r    = newTestTilemapRenderer()
+		l    = r.AddLayer()
+		anim = NewFrameAnimation(time.Second, []int{0, 5})
+	)
+	l.Set(0, 0, TileQuad{Width: 16, Height: 16})
+	l.Animate(0, 0, anim)
+	before := l.vertices(l.Index(0, 0))
+	r.Update(time.Second)
+	after := l.vertices(l.Index(0, 0))
+	// Frame 5 is one tile across and one down.
+	if after[3]-before[3] != 0.25 || after[4]-before[4] != -0.25 {
+		t.Fatalf("Expected texture to move a tile, got %v %v", after[3]-before[3], after[4]-before[4])
+	}
+	l.Animate(0, 0, nil)
+	if v := l.vertices(l.Index(0, 0)); v != before {
+		t.Fatalf("Expected animation to stop")
+	}
+}
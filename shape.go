@@ -0,0 +1,463 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// A solid area which can be tested against points, rays and, with Collide,
+// other shapes.
+type Shape interface {
+	Bounds() Rectangle
+	ContainsPoint(p Point) bool
+	// Tests the segment from, to against the shape.
+	Raycast(from, to Point) (hit ShapeHit, ok bool)
+}
+
+// Where a ray first meets a shape.
+type ShapeHit struct {
+	Time   float32    // Fraction of the way from the start to the end of the ray.
+	Point  Point      // Where the ray meets the edge of the shape.
+	Normal mgl32.Vec2 // Points out of the shape.  Zero if the ray starts inside.
+}
+
+// How two overlapping shapes touch.  Moving the second shape by
+// Normal * Depth, or the first by the opposite, separates them.
+type Manifold struct {
+	Normal   mgl32.Vec2 // Unit length, pointing from the first shape towards the second.
+	Depth    float32    // Distance the shapes overlap along Normal.
+	Contacts []Point    // One or two points where the shapes meet.
+}
+
+// Returns the manifold for a and b if they overlap.  Shapes which only
+// touch do not overlap, as with Rectangle.Overlaps.  Collisions are found
+// with the separating axis theorem, so only Circles and convex shapes are
+// supported: Rectangle, OrientedRect and Polygon.  Other shapes never
+// collide.
+func Collide(a, b Shape) (m Manifold, ok bool) {
+	var (
+		ca, aCircle = shapeCircle(a)
+		cb, bCircle = shapeCircle(b)
+		pa, aPoly   = shapePolygon(a)
+		pb, bPoly   = shapePolygon(b)
+	)
+	switch {
+	case aCircle && bCircle:
+		return collideCircles(ca, cb)
+	case aPoly && bCircle:
+		return collidePolygonCircle(pa, cb)
+	case aCircle && bPoly:
+		if m, ok = collidePolygonCircle(pb, ca); ok {
+			m.Normal = m.Normal.Mul(-1)
+		}
+		return
+	case aPoly && bPoly:
+		return collidePolygons(pa, pb)
+	}
+	return
+}
+
+func shapeCircle(s Shape) (c Circle, ok bool) {
+	switch v := s.(type) {
+	case Circle:
+		return v, true
+	case *Circle:
+		return *v, true
+	}
+	return
+}
+
+// Returns the shape as a convex polygon, if it is one.
+func shapePolygon(s Shape) (p Polygon, ok bool) {
+	switch v := s.(type) {
+	case Polygon:
+		return v, len(v.Points) >= 3
+	case *Polygon:
+		return *v, len(v.Points) >= 3
+	case Rectangle:
+		return v.Polygon(), true
+	case *Rectangle:
+		return v.Polygon(), true
+	case OrientedRect:
+		return v.Polygon(), true
+	case *OrientedRect:
+		return v.Polygon(), true
+	}
+	return
+}
+
+func (r Rectangle) Bounds() Rectangle {
+	return r
+}
+
+// Returns the corners of r, counter-clockwise from the bottom left.
+func (r Rectangle) Polygon() Polygon {
+	return Polygon{[]Point{
+		r.Min,
+		Pt(r.Max.X(), r.Min.Y()),
+		r.Max,
+		Pt(r.Min.X(), r.Max.Y()),
+	}}
+}
+
+func (r Rectangle) Raycast(from, to Point) (hit ShapeHit, ok bool) {
+	var h LineHit
+	if h, ok = IntersectRayRect(RayTo(from, to), r); !ok || h.T > 1 {
+		return ShapeHit{}, false
+	}
+	return ShapeHit{h.T, h.Point, h.Normal.Vec2}, true
+}
+
+type Circle struct {
+	Center Point
+	Radius float32
+}
+
+func (c Circle) Bounds() Rectangle {
+	return Rect(
+		c.Center.X()-c.Radius,
+		c.Center.Y()-c.Radius,
+		c.Center.X()+c.Radius,
+		c.Center.Y()+c.Radius,
+	)
+}
+
+func (c Circle) ContainsPoint(p Point) bool {
+	var d = p.Sub(c.Center)
+	return d.Dot(d) <= c.Radius*c.Radius
+}
+
+func (c Circle) Raycast(from, to Point) (hit ShapeHit, ok bool) {
+	var h LineHit
+	if h, ok = IntersectRayCircle(RayTo(from, to), c); !ok || h.T > 1 {
+		return ShapeHit{}, false
+	}
+	return ShapeHit{h.T, h.Point, h.Normal.Vec2}, true
+}
+
+// A convex polygon with its points in counter-clockwise order.
+type Polygon struct {
+	Points []Point
+}
+
+// Returns a polygon with the given points, reversing them if they are in
+// clockwise order.  The points must form a convex shape.
+func NewPolygon(points ...Point) Polygon {
+	var area float32
+	points = append([]Point(nil), points...)
+	for i, p := range points {
+		var q = points[(i+1)%len(points)]
+		area += p.X()*q.Y() - q.X()*p.Y()
+	}
+	if area < 0 {
+		for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+			points[i], points[j] = points[j], points[i]
+		}
+	}
+	return Polygon{points}
+}
+
+// Returns the polygon rotated by rotation radians counter-clockwise around
+// the origin and then moved by offset, so that shapes can be defined around
+// the origin and placed where an entity is.
+func (p Polygon) Transform(offset Point, rotation float32) Polygon {
+	var out = make([]Point, len(p.Points))
+	for i, pt := range p.Points {
+		out[i] = pt.Rotate(rotation).Add(offset)
+	}
+	return Polygon{out}
+}
+
+// Returns the outward unit normal of the edge from point i to point i+1.
+func (p Polygon) normal(i int) mgl32.Vec2 {
+	var e = p.Points[(i+1)%len(p.Points)].Sub(p.Points[i])
+	return mgl32.Vec2{e.Y(), -e.X()}.Normalize()
+}
+
+func (p Polygon) Bounds() (r Rectangle) {
+	if len(p.Points) == 0 {
+		return
+	}
+	r = Rectangle{p.Points[0], p.Points[0]}
+	for _, pt := range p.Points[1:] {
+		r.Min = Pt(minFloat32(r.Min.X(), pt.X()), minFloat32(r.Min.Y(), pt.Y()))
+		r.Max = Pt(maxFloat32(r.Max.X(), pt.X()), maxFloat32(r.Max.Y(), pt.Y()))
+	}
+	return
+}
+
+func (p Polygon) ContainsPoint(a Point) bool {
+	if len(p.Points) < 3 {
+		return false
+	}
+	for i, pt := range p.Points {
+		if p.normal(i).Dot(a.Sub(pt).Vec2) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (p Polygon) Raycast(from, to Point) (hit ShapeHit, ok bool) {
+	var (
+		d     = to.Sub(from).Vec2
+		enter = float32(0)
+		exit  = float32(1)
+	)
+	if len(p.Points) < 3 {
+		return
+	}
+	// Clips the ray against the inside of each edge in turn.
+	for i, pt := range p.Points {
+		var (
+			n     = p.normal(i)
+			num   = n.Dot(pt.Sub(from).Vec2)
+			denom = n.Dot(d)
+		)
+		if denom == 0 {
+			if num < 0 {
+				return // Parallel to and outside this edge.
+			}
+			continue
+		}
+		var t = num / denom
+		if denom < 0 {
+			if t > enter {
+				enter = t
+				hit.Normal = n
+			}
+		} else if t < exit {
+			exit = t
+		}
+		if enter > exit {
+			return
+		}
+	}
+	hit.Time = enter
+	hit.Point = Point{from.Add(Point{d.Mul(enter)}).Vec2}
+	return hit, true
+}
+
+// A rectangle rotated around its center, such as the bounds of a rotated
+// entity.
+type OrientedRect struct {
+	Center     Point
+	HalfWidth  float32
+	HalfHeight float32
+	Rotation   float32 // Radians counter-clockwise, as sprites are drawn.
+}
+
+// Returns the bounds of e, rotated by e.Rotation().
+func EntityShape(e Entity) OrientedRect {
+	var b = e.Bounds()
+	return OrientedRect{
+		Center:     e.Pos(),
+		HalfWidth:  (b.Max.X() - b.Min.X()) / 2,
+		HalfHeight: (b.Max.Y() - b.Min.Y()) / 2,
+		Rotation:   e.Rotation(),
+	}
+}
+
+// Returns the corners of the rectangle, counter-clockwise from the one
+// which is bottom left before rotating.
+func (r OrientedRect) Polygon() Polygon {
+	return Polygon{[]Point{
+		Pt(-r.HalfWidth, -r.HalfHeight),
+		Pt(r.HalfWidth, -r.HalfHeight),
+		Pt(r.HalfWidth, r.HalfHeight),
+		Pt(-r.HalfWidth, r.HalfHeight),
+	}}.Transform(r.Center, r.Rotation)
+}
+
+func (r OrientedRect) Bounds() Rectangle {
+	return r.Polygon().Bounds()
+}
+
+func (r OrientedRect) ContainsPoint(p Point) bool {
+	var local = p.Sub(r.Center).Rotate(-r.Rotation)
+	return local.X() >= -r.HalfWidth && local.X() <= r.HalfWidth &&
+		local.Y() >= -r.HalfHeight && local.Y() <= r.HalfHeight
+}
+
+func (r OrientedRect) Raycast(from, to Point) (hit ShapeHit, ok bool) {
+	return r.Polygon().Raycast(from, to)
+}
+
+func collideCircles(a, b Circle) (m Manifold, ok bool) {
+	var (
+		d    = b.Center.Sub(a.Center).Vec2
+		dist = d.Len()
+		r    = a.Radius + b.Radius
+	)
+	if dist >= r {
+		return
+	}
+	if dist == 0 {
+		m.Normal = mgl32.Vec2{1, 0}
+	} else {
+		m.Normal = d.Mul(1 / dist)
+	}
+	m.Depth = r - dist
+	m.Contacts = []Point{{a.Center.Vec2.Add(m.Normal.Mul(a.Radius - m.Depth/2))}}
+	return m, true
+}
+
+// Collides a polygon with a circle, with the normal pointing towards the
+// circle.
+func collidePolygonCircle(p Polygon, c Circle) (m Manifold, ok bool) {
+	var (
+		edge       = 0
+		separation = float32(-math.MaxFloat32)
+		count      = len(p.Points)
+	)
+	for i, pt := range p.Points {
+		if s := p.normal(i).Dot(c.Center.Sub(pt).Vec2); s > separation {
+			separation = s
+			edge = i
+		}
+	}
+	if separation >= c.Radius {
+		return
+	}
+	var (
+		v1 = p.Points[edge]
+		v2 = p.Points[(edge+1)%count]
+		n  = p.normal(edge)
+	)
+	if separation > 0 {
+		// The center is outside, so may be nearest to a corner rather than
+		// the face.
+		var corner *Point
+		if c.Center.Sub(v1).Dot(v2.Sub(v1)) <= 0 {
+			corner = &v1
+		} else if c.Center.Sub(v2).Dot(v1.Sub(v2)) <= 0 {
+			corner = &v2
+		}
+		if corner != nil {
+			var (
+				d    = c.Center.Sub(*corner).Vec2
+				dist = d.Len()
+			)
+			if dist >= c.Radius {
+				return
+			}
+			m.Normal = d.Mul(1 / dist)
+			m.Depth = c.Radius - dist
+			m.Contacts = []Point{*corner}
+			return m, true
+		}
+	}
+	m.Normal = n
+	m.Depth = c.Radius - separation
+	m.Contacts = []Point{{c.Center.Vec2.Sub(n.Mul(separation))}}
+	return m, true
+}
+
+// Returns the edge of a which b is furthest outside, and how far.  The
+// separation is negative if b overlaps every edge.
+func maxSeparation(a, b Polygon) (edge int, separation float32) {
+	separation = -math.MaxFloat32
+	for i, pt := range a.Points {
+		var (
+			n       = a.normal(i)
+			nearest = float32(math.MaxFloat32)
+		)
+		for _, q := range b.Points {
+			nearest = minFloat32(nearest, n.Dot(q.Sub(pt).Vec2))
+		}
+		if nearest > separation {
+			separation = nearest
+			edge = i
+		}
+	}
+	return
+}
+
+func collidePolygons(a, b Polygon) (m Manifold, ok bool) {
+	var (
+		edgeA, sepA = maxSeparation(a, b)
+		edgeB, sepB = maxSeparation(b, a)
+		ref, inc    = a, b
+		edge        = edgeA
+		flip        = false
+	)
+	if sepA >= 0 || sepB >= 0 {
+		return
+	}
+	// Prefers a's edges unless b's separate noticeably better, so that the
+	// contacts do not flicker between the two.
+	if sepB > sepA*0.98+0.001 {
+		ref, inc, edge, flip = b, a, edgeB, true
+	}
+	var (
+		count    = len(inc.Points)
+		n        = ref.normal(edge)
+		v1       = ref.Points[edge]
+		v2       = ref.Points[(edge+1)%len(ref.Points)]
+		incident = 0
+		best     = float32(math.MaxFloat32)
+	)
+	// The incident edge is the one facing most directly against n.
+	for i := range inc.Points {
+		if d := inc.normal(i).Dot(n); d < best {
+			best = d
+			incident = i
+		}
+	}
+	var (
+		tangent = v2.Sub(v1).Normalize().Vec2
+		points  = []mgl32.Vec2{inc.Points[incident].Vec2, inc.Points[(incident+1)%count].Vec2}
+	)
+	points = clipSegment(points, tangent.Mul(-1), -tangent.Dot(v1.Vec2))
+	points = clipSegment(points, tangent, tangent.Dot(v2.Vec2))
+	for _, pt := range points {
+		if depth := -n.Dot(pt.Sub(v1.Vec2)); depth >= 0 {
+			m.Contacts = append(m.Contacts, Point{pt})
+			m.Depth = maxFloat32(m.Depth, depth)
+		}
+	}
+	if len(m.Contacts) == 0 {
+		return
+	}
+	m.Normal = n
+	if flip {
+		m.Normal = n.Mul(-1)
+	}
+	return m, true
+}
+
+// Returns the part of the segment pts where dot(n, p) <= offset.
+func clipSegment(pts []mgl32.Vec2, n mgl32.Vec2, offset float32) (out []mgl32.Vec2) {
+	if len(pts) < 2 {
+		return pts
+	}
+	var (
+		d1 = n.Dot(pts[0]) - offset
+		d2 = n.Dot(pts[1]) - offset
+	)
+	if d1 <= 0 {
+		out = append(out, pts[0])
+	}
+	if d2 <= 0 {
+		out = append(out, pts[1])
+	}
+	if d1*d2 < 0 {
+		var t = d1 / (d1 - d2)
+		out = append(out, pts[0].Add(pts[1].Sub(pts[0]).Mul(t)))
+	}
+	return
+}
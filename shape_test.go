@@ -0,0 +1,192 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"testing"
+)
+
+func closeTo(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-4
+}
+
+func closeVec(a, b mgl32.Vec2) bool {
+	return closeTo(a[0], b[0]) && closeTo(a[1], b[1])
+}
+
+func TestCollideCircles(t *testing.T) {
+	var (
+		a     = Circle{Pt(0, 0), 1}
+		b     = Circle{Pt(1.5, 0), 1}
+		m, ok = Collide(a, b)
+	)
+	if !ok {
+		t.Fatalf("Expected circles to collide")
+	}
+	if m.Normal != (mgl32.Vec2{1, 0}) || !closeTo(m.Depth, 0.5) {
+		t.Fatalf("Unexpected manifold %v", m)
+	}
+	if len(m.Contacts) != 1 || !closeTo(m.Contacts[0].X(), 0.75) {
+		t.Fatalf("Unexpected contacts %v", m.Contacts)
+	}
+	if _, ok = Collide(a, Circle{Pt(2, 0), 1}); ok {
+		t.Fatalf("Touching circles should not collide")
+	}
+}
+
+func TestCollideRectangles(t *testing.T) {
+	var m, ok = Collide(Rect(0, 0, 2, 2), Rect(1.5, 0.5, 3.5, 1.5))
+	if !ok {
+		t.Fatalf("Expected rectangles to collide")
+	}
+	if !closeVec(m.Normal, mgl32.Vec2{1, 0}) || !closeTo(m.Depth, 0.5) {
+		t.Fatalf("Unexpected manifold %v", m)
+	}
+	if len(m.Contacts) != 2 {
+		t.Fatalf("Expected two contacts, got %v", m.Contacts)
+	}
+	for _, c := range m.Contacts {
+		if !closeTo(c.X(), 1.5) {
+			t.Fatalf("Unexpected contact %v", c)
+		}
+	}
+	if m, ok = Collide(Rect(1.5, 0.5, 3.5, 1.5), Rect(0, 0, 2, 2)); !ok || !closeVec(m.Normal, mgl32.Vec2{-1, 0}) {
+		t.Fatalf("Expected normal to point from a to b, got %v", m)
+	}
+	if _, ok = Collide(Rect(0, 0, 1, 1), Rect(1, 0, 2, 1)); ok {
+		t.Fatalf("Touching rectangles should not collide")
+	}
+}
+
+func TestCollideOrientedRect(t *testing.T) {
+	var (
+		diamond = OrientedRect{Pt(0, 0), 1, 1, math.Pi / 4}
+		box     = Rect(1.2, -1, 3, 1)
+		m, ok   = Collide(diamond, box)
+	)
+	// The diamond's right corner reaches to x = sqrt(2).
+	if !ok {
+		t.Fatalf("Expected rotated box to collide")
+	}
+	if !closeVec(m.Normal, mgl32.Vec2{1, 0}) || !closeTo(m.Depth, float32(math.Sqrt2)-1.2) {
+		t.Fatalf("Unexpected manifold %v", m)
+	}
+	if len(m.Contacts) != 1 || !closeTo(m.Contacts[0].X(), float32(math.Sqrt2)) {
+		t.Fatalf("Unexpected contacts %v", m.Contacts)
+	}
+	// Unrotated, the box's corners would reach the rectangle.
+	if _, ok = Collide(diamond, Rect(1.1, 1.1, 2, 2)); ok {
+		t.Fatalf("Rotated box should miss the rectangle")
+	}
+	if _, ok = Collide(OrientedRect{Pt(0, 0), 1, 1, 0}, Rect(0.9, 0.9, 2, 2)); !ok {
+		t.Fatalf("Unrotated box should hit the rectangle")
+	}
+}
+
+func TestCollidePolygonCircle(t *testing.T) {
+	var (
+		tri   = NewPolygon(Pt(0, 0), Pt(0, 2), Pt(2, 0)) // Clockwise.
+		m, ok = Collide(Circle{Pt(-0.5, 1), 1}, tri)
+	)
+	if !ok {
+		t.Fatalf("Expected circle to hit the face")
+	}
+	if !closeVec(m.Normal, mgl32.Vec2{1, 0}) || !closeTo(m.Depth, 0.5) {
+		t.Fatalf("Unexpected manifold %v", m)
+	}
+	if m, ok = Collide(tri, Circle{Pt(-0.5, -0.5), 1}); !ok {
+		t.Fatalf("Expected circle to hit the corner")
+	}
+	var n = float32(-1 / math.Sqrt2)
+	if !closeVec(m.Normal, mgl32.Vec2{n, n}) || m.Contacts[0] != Pt(0, 0) {
+		t.Fatalf("Unexpected manifold %v", m)
+	}
+	if _, ok = Collide(tri, Circle{Pt(-0.8, -0.8), 1}); ok {
+		t.Fatalf("Circle beyond the corner should not collide")
+	}
+}
+
+func TestCollidePointers(t *testing.T) {
+	var (
+		circle = &Circle{Pt(0, 0), 1}
+		rect   = &Rectangle{Pt(0.5, -1), Pt(2.5, 1)}
+	)
+	if m, ok := Collide(circle, rect); !ok || !closeTo(m.Depth, 0.5) {
+		t.Fatalf("Expected pointer shapes to collide, got %v, %v", m, ok)
+	}
+	if _, ok := Collide(rect, &Circle{Pt(4, 0), 1}); ok {
+		t.Fatalf("Separate pointer shapes should not collide")
+	}
+}
+
+func TestNewPolygonCopies(t *testing.T) {
+	var points = []Point{Pt(0, 0), Pt(0, 2), Pt(2, 0)} // Clockwise.
+	NewPolygon(points...)
+	if points[0] != Pt(0, 0) || points[1] != Pt(0, 2) {
+		t.Fatalf("NewPolygon changed the caller's points: %v", points)
+	}
+}
+
+func TestShapeContainsPoint(t *testing.T) {
+	var shapes = []Shape{
+		Rect(-1, -1, 1, 1),
+		Circle{Pt(0, 0), 1},
+		NewPolygon(Pt(-1, -1), Pt(1, -1), Pt(0, 1)),
+		OrientedRect{Pt(0, 0), 2, 0.5, math.Pi / 2},
+	}
+	for _, s := range shapes {
+		if !s.ContainsPoint(Pt(0, 0.4)) {
+			t.Fatalf("%v should contain the point", s)
+		}
+		if s.ContainsPoint(Pt(1.5, 0.9)) {
+			t.Fatalf("%v should not contain the point", s)
+		}
+	}
+}
+
+func TestShapeRaycast(t *testing.T) {
+	var shapes = []Shape{
+		Rect(-1, -1, 1, 1),
+		Circle{Pt(0, 0), 1},
+		OrientedRect{Pt(0, 0), 1, 1, math.Pi / 2},
+	}
+	for _, s := range shapes {
+		var hit, ok = s.Raycast(Pt(-3, 0), Pt(1, 0))
+		if !ok || !closeTo(hit.Time, 0.5) || !closeVec(hit.Normal, mgl32.Vec2{-1, 0}) {
+			t.Fatalf("Unexpected hit %v on %v", hit, s)
+		}
+		if _, ok = s.Raycast(Pt(-3, 0), Pt(-2, 0)); ok {
+			t.Fatalf("Short ray should not reach %v", s)
+		}
+		if _, ok = s.Raycast(Pt(-3, 2), Pt(3, 2)); ok {
+			t.Fatalf("Ray should pass %v", s)
+		}
+		if hit, ok = s.Raycast(Pt(0, 0), Pt(3, 0)); !ok || hit.Time != 0 {
+			t.Fatalf("Ray inside %v should hit at once, got %v", s, hit)
+		}
+	}
+}
+
+func TestEntityShape(t *testing.T) {
+	var (
+		e = NewBaseEntity(2, 3, 4, 2, math.Pi/2, 0)
+		b = EntityShape(e).Bounds()
+	)
+	if !closeTo(b.Min.X(), 1) || !closeTo(b.Max.X(), 3) || !closeTo(b.Min.Y(), 1) || !closeTo(b.Max.Y(), 5) {
+		t.Fatalf("Unexpected bounds %v", b)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"sort"
+)
+
+// Anything with bounds, such as an Entity or a Shape.
+type Bounded interface {
+	Bounds() Rectangle
+}
+
+// Finds items by where they are, so that collisions can be checked against
+// nearby items only, and rendering can skip items outside
+// Camera.WorldBounds.  Items are compared by identity, so should be
+// pointers.
+//
+// An index keeps the bounds each item had when it was inserted or last
+// updated; call Update after moving an item.
+type SpatialIndex interface {
+	Insert(item Bounded)
+	Update(item Bounded)
+	Remove(item Bounded)
+	Len() int
+	// Appends the items overlapping area to out, as Rectangle.Overlaps.
+	QueryRect(area Rectangle, out []Bounded) []Bounded
+	// Appends the items whose bounds contain p to out.
+	QueryPoint(p Point, out []Bounded) []Bounded
+	// Returns up to k items nearest to p, nearest first.  Distance is
+	// measured to the nearest point of each item's bounds.
+	Nearest(p Point, k int) []Bounded
+	// Returns the items whose bounds the segment from, to passes through,
+	// nearest from first.
+	Raycast(from, to Point) []SpatialHit
+}
+
+type SpatialHit struct {
+	Item Bounded
+	LineHit
+}
+
+// An item as stored in an index.  stamp marks the last query to see the
+// item, so that items found more than once are only reported once.
+type spatialEntry struct {
+	item   Bounded
+	bounds Rectangle
+	stamp  uint32
+}
+
+// Returns the distance from p to the nearest point of r.
+func boundsDistance(p Point, r Rectangle) float32 {
+	return r.ClampPoint(p).DistanceTo(p)
+}
+
+// Tests the segment from, to against e's bounds.
+func (e *spatialEntry) raycast(from, to Point) (hit SpatialHit, ok bool) {
+	if hit.LineHit, ok = IntersectRayRect(RayTo(from, to), e.bounds); !ok || hit.T > 1 {
+		return SpatialHit{}, false
+	}
+	hit.Item = e.item
+	return hit, true
+}
+
+func sortSpatialHits(hits []SpatialHit) {
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].T < hits[j].T
+	})
+}
+
+// Returns true if r and s overlap or touch.
+func touches(r, s Rectangle) bool {
+	return s.Min.X() <= r.Max.X() && s.Max.X() >= r.Min.X() &&
+		s.Min.Y() <= r.Max.Y() && s.Max.Y() >= r.Min.Y()
+}
@@ -0,0 +1,338 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Indexes items in a uniform grid of square cells, with no limit on the
+// area covered.  Works best when most items are smaller than a cell and
+// spread evenly; items are stored in every cell they overlap.
+type SpatialHash struct {
+	CellSize float32
+	cells    map[spatialCell][]*spatialEntry
+	items    map[Bounded]*spatialHashEntry
+	stamp    uint32
+	lo, hi   spatialCell // Cells holding items, or more after items leave.
+	loose    bool        // Set when lo and hi may be larger than needed.
+}
+
+type spatialCell struct {
+	X, Y int32
+}
+
+type spatialHashEntry struct {
+	spatialEntry
+	min spatialCell
+	max spatialCell
+}
+
+func NewSpatialHash(cellSize float32) (h *SpatialHash, err error) {
+	if !(cellSize > 0) {
+		err = fmt.Errorf("Cell size must be positive, got %v", cellSize)
+		return
+	}
+	h = &SpatialHash{
+		CellSize: cellSize,
+		cells:    map[spatialCell][]*spatialEntry{},
+		items:    map[Bounded]*spatialHashEntry{},
+	}
+	return
+}
+
+func (h *SpatialHash) cell(p Point) spatialCell {
+	return spatialCell{
+		int32(math.Floor(float64(p.X() / h.CellSize))),
+		int32(math.Floor(float64(p.Y() / h.CellSize))),
+	}
+}
+
+func (h *SpatialHash) Len() int {
+	return len(h.items)
+}
+
+func (h *SpatialHash) Insert(item Bounded) {
+	if _, ok := h.items[item]; ok {
+		h.Update(item)
+		return
+	}
+	var (
+		bounds = item.Bounds()
+		e      = &spatialHashEntry{
+			spatialEntry: spatialEntry{item: item, bounds: bounds},
+			min:          h.cell(bounds.Min),
+			max:          h.cell(bounds.Max),
+		}
+	)
+	h.items[item] = e
+	h.add(e)
+}
+
+// Moves item to the cells for its current bounds.  Items which stay in the
+// same cells are not moved.
+func (h *SpatialHash) Update(item Bounded) {
+	var e, ok = h.items[item]
+	if !ok {
+		h.Insert(item)
+		return
+	}
+	var (
+		bounds = item.Bounds()
+		min    = h.cell(bounds.Min)
+		max    = h.cell(bounds.Max)
+	)
+	e.bounds = bounds
+	if min == e.min && max == e.max {
+		return
+	}
+	h.drop(e)
+	e.min, e.max = min, max
+	h.add(e)
+}
+
+func (h *SpatialHash) Remove(item Bounded) {
+	if e, ok := h.items[item]; ok {
+		h.drop(e)
+		delete(h.items, item)
+	}
+}
+
+func (h *SpatialHash) add(e *spatialHashEntry) {
+	if len(h.cells) == 0 {
+		h.lo, h.hi = e.min, e.max
+		h.loose = false
+	}
+	h.lo = spatialCell{minInt32(h.lo.X, e.min.X), minInt32(h.lo.Y, e.min.Y)}
+	h.hi = spatialCell{maxInt32(h.hi.X, e.max.X), maxInt32(h.hi.Y, e.max.Y)}
+	for y := e.min.Y; y <= e.max.Y; y++ {
+		for x := e.min.X; x <= e.max.X; x++ {
+			var key = spatialCell{x, y}
+			h.cells[key] = append(h.cells[key], &e.spatialEntry)
+		}
+	}
+}
+
+func (h *SpatialHash) drop(e *spatialHashEntry) {
+	if e.min.X == h.lo.X || e.min.Y == h.lo.Y || e.max.X == h.hi.X || e.max.Y == h.hi.Y {
+		h.loose = true
+	}
+	for y := e.min.Y; y <= e.max.Y; y++ {
+		for x := e.min.X; x <= e.max.X; x++ {
+			var (
+				key   = spatialCell{x, y}
+				cell  = h.cells[key]
+				count = len(cell)
+			)
+			for i, other := range cell {
+				if other == &e.spatialEntry {
+					cell[i] = cell[count-1]
+					cell[count-1] = nil
+					cell = cell[:count-1]
+					break
+				}
+			}
+			if len(cell) == 0 {
+				delete(h.cells, key)
+			} else {
+				h.cells[key] = cell
+			}
+		}
+	}
+}
+
+// Shrinks lo and hi to the cells which hold items.
+func (h *SpatialHash) fit() {
+	var first = true
+	for c := range h.cells {
+		if first {
+			h.lo, h.hi = c, c
+			first = false
+		}
+		h.lo = spatialCell{minInt32(h.lo.X, c.X), minInt32(h.lo.Y, c.Y)}
+		h.hi = spatialCell{maxInt32(h.hi.X, c.X), maxInt32(h.hi.Y, c.Y)}
+	}
+	h.loose = false
+}
+
+// Calls visit once for each item stored in the cells from min to max.
+func (h *SpatialHash) each(min, max spatialCell, visit func(e *spatialEntry)) {
+	h.stamp++
+	for y := min.Y; y <= max.Y; y++ {
+		for x := min.X; x <= max.X; x++ {
+			for _, e := range h.cells[spatialCell{x, y}] {
+				if e.stamp != h.stamp {
+					e.stamp = h.stamp
+					visit(e)
+				}
+			}
+		}
+	}
+}
+
+func (h *SpatialHash) QueryRect(area Rectangle, out []Bounded) []Bounded {
+	h.each(h.cell(area.Min), h.cell(area.Max), func(e *spatialEntry) {
+		if e.bounds.Overlaps(area) {
+			out = append(out, e.item)
+		}
+	})
+	return out
+}
+
+func (h *SpatialHash) QueryPoint(p Point, out []Bounded) []Bounded {
+	var c = h.cell(p)
+	for _, e := range h.cells[c] {
+		if e.bounds.ContainsPoint(p) {
+			out = append(out, e.item)
+		}
+	}
+	return out
+}
+
+// Searches rings of cells outward from p until every item which could be
+// nearer than the kth found has been seen.  Only the parts of each ring
+// which overlap cells holding items are visited; once items on the edge of
+// those cells have moved or been removed, the first search finds the cells
+// again.
+func (h *SpatialHash) Nearest(p Point, k int) (out []Bounded) {
+	if h.loose {
+		h.fit()
+	}
+	type candidate struct {
+		item Bounded
+		dist float32
+	}
+	var (
+		center = h.cell(p)
+		found  []candidate
+		seen   = 0
+		// Rings nearer than first or further than last hold no items.
+		first = maxInt32(0, maxInt32(
+			maxInt32(h.lo.X-center.X, center.X-h.hi.X),
+			maxInt32(h.lo.Y-center.Y, center.Y-h.hi.Y),
+		))
+		last = maxInt32(
+			maxInt32(h.hi.X-center.X, center.X-h.lo.X),
+			maxInt32(h.hi.Y-center.Y, center.Y-h.lo.Y),
+		)
+		visit = func(x0, x1, y0, y1 int32) {
+			x0, x1 = maxInt32(x0, h.lo.X), minInt32(x1, h.hi.X)
+			y0, y1 = maxInt32(y0, h.lo.Y), minInt32(y1, h.hi.Y)
+			for y := y0; y <= y1; y++ {
+				for x := x0; x <= x1; x++ {
+					for _, e := range h.cells[spatialCell{x, y}] {
+						if e.stamp == h.stamp {
+							continue
+						}
+						e.stamp = h.stamp
+						seen++
+						found = append(found, candidate{e.item, boundsDistance(p, e.bounds)})
+					}
+				}
+			}
+		}
+	)
+	if k <= 0 {
+		return
+	}
+	h.stamp++
+	for ring := first; ring <= last && seen < len(h.items); ring++ {
+		// Items not yet seen lie wholly in this ring or further out, so
+		// are at least this far from p.
+		var reach = float32(ring-1) * h.CellSize
+		if len(found) >= k {
+			sort.Slice(found, func(i, j int) bool { return found[i].dist < found[j].dist })
+			if found[k-1].dist <= reach {
+				break
+			}
+		}
+		var x0, x1, y0, y1 = center.X - ring, center.X + ring, center.Y - ring, center.Y + ring
+		visit(x0, x1, y0, y0)
+		if ring > 0 {
+			visit(x0, x1, y1, y1)
+			visit(x0, x0, y0+1, y1-1)
+			visit(x1, x1, y0+1, y1-1)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].dist < found[j].dist })
+	if len(found) > k {
+		found = found[:k]
+	}
+	out = make([]Bounded, len(found))
+	for i, c := range found {
+		out[i] = c.item
+	}
+	return
+}
+
+// Walks the cells along the segment, testing the items in each.
+func (h *SpatialHash) Raycast(from, to Point) (hits []SpatialHit) {
+	var (
+		cell  = h.cell(from)
+		end   = h.cell(to)
+		d     = to.Sub(from)
+		step  = [2]int32{1, 1}
+		next  [2]float32 // Position along the segment of the next cell edge.
+		delta [2]float32 // Distance along the segment between cell edges.
+		pos   = [2]*int32{&cell.X, &cell.Y}
+	)
+	for axis := 0; axis < 2; axis++ {
+		var (
+			o = from.Vec2[axis] / h.CellSize
+			v = d.Vec2[axis] / h.CellSize
+			c = float32(*pos[axis])
+		)
+		switch {
+		case v > 0:
+			next[axis] = (c + 1 - o) / v
+			delta[axis] = 1 / v
+		case v < 0:
+			step[axis] = -1
+			next[axis] = (o - c) / -v
+			delta[axis] = 1 / -v
+		default:
+			next[axis] = float32(math.Inf(1))
+			delta[axis] = float32(math.Inf(1))
+		}
+	}
+	h.stamp++
+	for {
+		for _, e := range h.cells[cell] {
+			if e.stamp == h.stamp {
+				continue
+			}
+			e.stamp = h.stamp
+			if hit, ok := e.raycast(from, to); ok {
+				hits = append(hits, hit)
+			}
+		}
+		if cell == end {
+			break
+		}
+		var axis = 0
+		if next[1] < next[0] {
+			axis = 1
+		}
+		if next[axis] > 1 {
+			break
+		}
+		*pos[axis] += step[axis]
+		next[axis] += delta[axis]
+	}
+	sortSpatialHits(hits)
+	return
+}
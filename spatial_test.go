@@ -0,0 +1,266 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+var spatialIndexes = []struct {
+	name  string
+	build func() SpatialIndex
+}{
+	{"SpatialHash", func() SpatialIndex {
+		var h, _ = NewSpatialHash(16)
+		return h
+	}},
+	{"QuadTree", func() SpatialIndex { return NewQuadTree(Rect(0, 0, 1000, 1000)) }},
+}
+
+// Scatters count entities of up to size across a world of the given size.
+func newSpatialEntities(seed int64, count int, world, size float32) (out []*BaseEntity, r *rand.Rand) {
+	r = rand.New(rand.NewSource(seed))
+	out = make([]*BaseEntity, count)
+	for i := range out {
+		out[i] = NewBaseEntity(r.Float32()*world, r.Float32()*world, 1+r.Float32()*size, 1+r.Float32()*size, 0, 0)
+	}
+	return
+}
+
+func sortedEntities(items []Bounded) (out []*BaseEntity) {
+	for _, item := range items {
+		out = append(out, item.(*BaseEntity))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Pos().X() < out[j].Pos().X()
+	})
+	return
+}
+
+func sameEntities(a, b []Bounded) bool {
+	var sa, sb = sortedEntities(a), sortedEntities(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSpatialIndexQueries(t *testing.T) {
+	for _, index := range spatialIndexes {
+		var (
+			s              = index.build()
+			entities, rand = newSpatialEntities(1, 500, 1000, 40)
+		)
+		for _, e := range entities {
+			s.Insert(e)
+		}
+		// Moves some entities, including out of the quad tree's area, and
+		// removes others.
+		for i, e := range entities {
+			switch i % 5 {
+			case 0:
+				e.MoveTo(e.Pos().Add(Pt(rand.Float32()*200-100, rand.Float32()*200-100)))
+				s.Update(e)
+			case 1:
+				e.MoveTo(Pt(-50-rand.Float32()*50, rand.Float32()*1000))
+				s.Update(e)
+			case 2:
+				s.Remove(e)
+				entities[i] = nil
+			}
+		}
+		var live []*BaseEntity
+		for _, e := range entities {
+			if e != nil {
+				live = append(live, e)
+			}
+		}
+		if s.Len() != len(live) {
+			t.Fatalf("%v: expected %v items, got %v", index.name, len(live), s.Len())
+		}
+		for q := 0; q < 50; q++ {
+			var (
+				area  = fuzzRect(rand.Float32()*1200-100, rand.Float32()*1200-100, rand.Float32()*1200-100, rand.Float32()*1200-100)
+				p     = Pt(rand.Float32()*1000, rand.Float32()*1000)
+				inBox []Bounded
+				atPt  []Bounded
+			)
+			for _, e := range live {
+				if e.Bounds().Overlaps(area) {
+					inBox = append(inBox, e)
+				}
+				if e.Bounds().ContainsPoint(p) {
+					atPt = append(atPt, e)
+				}
+			}
+			if got := s.QueryRect(area, nil); !sameEntities(got, inBox) {
+				t.Fatalf("%v: expected %v items in %v, got %v", index.name, len(inBox), area, len(got))
+			}
+			if got := s.QueryPoint(p, nil); !sameEntities(got, atPt) {
+				t.Fatalf("%v: expected %v items at %v, got %v", index.name, len(atPt), p, len(got))
+			}
+		}
+	}
+}
+
+func TestSpatialIndexNearest(t *testing.T) {
+	for _, index := range spatialIndexes {
+		var (
+			s              = index.build()
+			entities, rand = newSpatialEntities(2, 300, 1000, 10)
+		)
+		for _, e := range entities {
+			s.Insert(e)
+		}
+		for q := 0; q < 20; q++ {
+			var (
+				p      = Pt(rand.Float32()*1000, rand.Float32()*1000)
+				got    = s.Nearest(p, 5)
+				sorted = append([]*BaseEntity{}, entities...)
+			)
+			sort.Slice(sorted, func(i, j int) bool {
+				return boundsDistance(p, sorted[i].Bounds()) < boundsDistance(p, sorted[j].Bounds())
+			})
+			if len(got) != 5 {
+				t.Fatalf("%v: expected 5 items, got %v", index.name, len(got))
+			}
+			for i, item := range got {
+				if d := boundsDistance(p, item.Bounds()); d != boundsDistance(p, sorted[i].Bounds()) {
+					t.Fatalf("%v: item %v near %v is %v away, expected %v", index.name, i, p, d, boundsDistance(p, sorted[i].Bounds()))
+				}
+			}
+		}
+		if got := s.Nearest(Pt(0, 0), 1000); len(got) != len(entities) {
+			t.Fatalf("%v: expected every item, got %v", index.name, len(got))
+		}
+	}
+}
+
+func TestSpatialIndexNearestFarAway(t *testing.T) {
+	for _, index := range spatialIndexes {
+		var (
+			s    = index.build()
+			near = NewBaseEntity(990, 990, 5, 5, 0, 0)
+			far  = NewBaseEntity(10, 10, 5, 5, 0, 0)
+		)
+		s.Insert(far)
+		s.Insert(near)
+		var got = s.Nearest(Pt(1e7, 1e7), 1)
+		if len(got) != 1 || got[0] != near {
+			t.Fatalf("%v: expected the nearer item, got %v", index.name, got)
+		}
+		s.Remove(near)
+		if got = s.Nearest(Pt(-1e7, 0), 5); len(got) != 1 || got[0] != far {
+			t.Fatalf("%v: expected the remaining item, got %v", index.name, got)
+		}
+	}
+}
+
+func TestSpatialHashBounds(t *testing.T) {
+	var (
+		h, _  = NewSpatialHash(16)
+		home  = NewBaseEntity(10, 10, 5, 5, 0, 0)
+		stray = NewBaseEntity(1e6, 1e6, 5, 5, 0, 0)
+	)
+	h.Insert(home)
+	h.Insert(stray)
+	stray.MoveTo(Pt(20, 20))
+	h.Update(stray)
+	if got := h.Nearest(Pt(0, 0), 2); len(got) != 2 || h.hi.X > 2 || h.hi.Y > 2 {
+		t.Fatalf("Expected bounds to shrink back, got %v to %v", h.lo, h.hi)
+	}
+	if _, err := NewSpatialHash(0); err == nil {
+		t.Fatalf("Expected error for a cell size of 0")
+	}
+}
+
+func TestSpatialIndexRaycast(t *testing.T) {
+	for _, index := range spatialIndexes {
+		var (
+			s = index.build()
+			a = NewBaseEntity(100, 100, 10, 10, 0, 0)
+			b = NewBaseEntity(300, 300, 10, 10, 0, 0)
+			c = NewBaseEntity(300, 100, 10, 10, 0, 0)
+		)
+		s.Insert(a)
+		s.Insert(b)
+		s.Insert(c)
+		var hits = s.Raycast(Pt(400, 400), Pt(0, 0))
+		if len(hits) != 2 || hits[0].Item != b || hits[1].Item != a {
+			t.Fatalf("%v: unexpected hits %v", index.name, hits)
+		}
+		if hits[0].Point != Pt(305, 305) {
+			t.Fatalf("%v: unexpected hit point %v", index.name, hits[0].Point)
+		}
+		if hits = s.Raycast(Pt(0, 0), Pt(50, 50)); len(hits) != 0 {
+			t.Fatalf("%v: short ray should hit nothing, got %v", index.name, hits)
+		}
+	}
+}
+
+func benchmarkSpatialIndex(b *testing.B, s SpatialIndex) {
+	var (
+		entities, rand = newSpatialEntities(3, 10000, 1000, 8)
+		velocities     = make([]Point, len(entities))
+		found          []Bounded
+	)
+	for i, e := range entities {
+		velocities[i] = Pt(rand.Float32()*2-1, rand.Float32()*2-1)
+		s.Insert(e)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i, e := range entities {
+			e.MoveTo(e.Pos().Add(velocities[i]))
+			s.Update(e)
+		}
+		for _, e := range entities {
+			found = s.QueryRect(e.Bounds(), found[:0])
+		}
+	}
+}
+
+// Moves 10k entities and looks for the neighbours of each, once per frame.
+func BenchmarkSpatialHash(b *testing.B) {
+	var h, _ = NewSpatialHash(16)
+	benchmarkSpatialIndex(b, h)
+}
+
+func BenchmarkQuadTree(b *testing.B) {
+	benchmarkSpatialIndex(b, NewQuadTree(Rect(0, 0, 1000, 1000)))
+}
+
+// The pairwise checks the indexes replace.
+func BenchmarkSpatialBruteForce(b *testing.B) {
+	var entities, _ = newSpatialEntities(3, 10000, 1000, 8)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var count = 0
+		for _, e := range entities {
+			for _, other := range entities {
+				if e.Bounds().Overlaps(other.Bounds()) {
+					count++
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+)
+
+// Maximum number of times a move is allowed to slide along walls.
+const maxSweepIterations = 4
+
+// A face of a grid cell touched by a moving box.  Normal points out of the
+// cell, towards the box.
+type GridContact struct {
+	Cell   GridPoint
+	Normal mgl32.Vec2
+}
+
+type SweepResult struct {
+	Move     mgl32.Vec2    // Movement after resolving collisions.
+	Time     float32       // Fraction of the move made before the first impact; 1 if nothing was hit.
+	Contacts []GridContact // Every cell face hit during the move or touching the final bounds.
+}
+
+// Returns true if any contact has the given normal.
+func (r SweepResult) Touching(normal mgl32.Vec2) bool {
+	for _, c := range r.Contacts {
+		if c.Normal == normal {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the box is standing on a cell.
+func (r SweepResult) OnGround() bool {
+	return r.Touching(mgl32.Vec2{0, 1})
+}
+
+func (r SweepResult) OnCeiling() bool {
+	return r.Touching(mgl32.Vec2{0, -1})
+}
+
+// Returns true if a cell is touching the left side of the box.
+func (r SweepResult) OnWallLeft() bool {
+	return r.Touching(mgl32.Vec2{1, 0})
+}
+
+// Returns true if a cell is touching the right side of the box.
+func (r SweepResult) OnWallRight() bool {
+	return r.Touching(mgl32.Vec2{-1, 0})
+}
+
+func (r *SweepResult) addContact(c GridContact) {
+	for _, existing := range r.Contacts {
+		if existing == c {
+			return
+		}
+	}
+	r.Contacts = append(r.Contacts, c)
+}
+
+func (g *Grid) cellBounds(x, y int32) Rectangle {
+	var size = g.BlockSize
+	return Rect(float32(x)*size, float32(y)*size, float32(x+1)*size, float32(y+1)*size)
+}
+
+// Returns the times at which a box moving along one axis from min, max with
+// velocity v starts and stops overlapping the range lo, hi.
+func sweepAxis(min, max, lo, hi, v, skin float32) (entry, exit float64, ok bool) {
+	switch {
+	case v > 0:
+		return float64((lo - max) / v), float64((hi - min) / v), true
+	case v < 0:
+		return float64((hi - min) / v), float64((lo - max) / v), true
+	case max <= lo+skin || min >= hi-skin:
+		return 0, 0, false
+	}
+	return math.Inf(-1), math.Inf(1), true
+}
+
+// Sweeps box along v against a static cell, returning the fraction of v at
+// which they first touch and the normal of the face hit.
+func sweepBox(box, cell Rectangle, v mgl32.Vec2, skin float32) (t float64, normal mgl32.Vec2, ok bool) {
+	var (
+		entryX, exitX, okX = sweepAxis(box.Min.X(), box.Max.X(), cell.Min.X(), cell.Max.X(), v[0], skin)
+		entryY, exitY, okY = sweepAxis(box.Min.Y(), box.Max.Y(), cell.Min.Y(), cell.Max.Y(), v[1], skin)
+		tolerance          = float64(skin / v.Len())
+	)
+	if !okX || !okY {
+		return
+	}
+	t = math.Max(entryX, entryY)
+	if t > math.Min(exitX, exitY) || t >= 1 || t < -tolerance {
+		// Either never touching, touching after this move, or already
+		// overlapping, which a sweep can't resolve.
+		return
+	}
+	if entryX > entryY {
+		normal = mgl32.Vec2{-sign(v[0]), 0}
+	} else {
+		// Corners resolve vertically so boxes land on ledges.
+		normal = mgl32.Vec2{0, -sign(v[1])}
+	}
+	ok = true
+	t = math.Max(t, 0)
+	return
+}
+
+func sign(v float32) float32 {
+	if v < 0 {
+		return -1
+	}
+	return 1
+}
+
+// Moves bounds along move, stopping at and sliding along cells whose items
+// block movement (see SolidItem).  Because the whole move is swept, fast
+// boxes can't pass through thin walls.
+func (g *Grid) SweepMove(bounds Rectangle, move mgl32.Vec2) (res SweepResult) {
+	var (
+		box       = bounds
+		remaining = move
+		skin      = g.BlockSize * 0.0001
+		i         int
+	)
+	res.Time = 1
+	for i = 0; i < maxSweepIterations && remaining.Len() > 0; i++ {
+		var (
+			toi  = 1.0
+			hits []GridContact
+		)
+		g.eachSolidCell(sweptBounds(box, remaining), func(x, y int32) {
+			var t, normal, ok = sweepBox(box, g.cellBounds(x, y), remaining, skin)
+			if !ok || t > toi {
+				return
+			}
+			if t < toi {
+				toi = t
+				hits = hits[:0]
+			}
+			hits = append(hits, GridContact{GridPoint{x, y}, normal})
+		})
+		step := remaining.Mul(float32(toi))
+		box = box.Translate(Point{step})
+		if len(hits) == 0 {
+			break
+		}
+		if i == 0 {
+			res.Time = float32(toi)
+		}
+		remaining = remaining.Sub(step)
+		for _, hit := range hits {
+			res.addContact(hit)
+			// Slide by removing the part of the move into the face.
+			if d := remaining.Dot(hit.Normal); d < 0 {
+				remaining = remaining.Sub(hit.Normal.Mul(d))
+			}
+		}
+	}
+	res.Move = box.Min.Sub(bounds.Min).Vec2
+	g.addRestingContacts(box, skin, &res)
+	return
+}
+
+// Records solid cells whose faces lie against the sides of box.
+func (g *Grid) addRestingContacts(box Rectangle, skin float32, res *SweepResult) {
+	var (
+		near   = skin / 2
+		far    = skin * 2
+		probes = []struct {
+			area   Rectangle
+			normal mgl32.Vec2
+		}{
+			{Rect(box.Min.X()+skin, box.Min.Y()-far, box.Max.X()-skin, box.Min.Y()-near), mgl32.Vec2{0, 1}},
+			{Rect(box.Min.X()+skin, box.Max.Y()+near, box.Max.X()-skin, box.Max.Y()+far), mgl32.Vec2{0, -1}},
+			{Rect(box.Min.X()-far, box.Min.Y()+skin, box.Min.X()-near, box.Max.Y()-skin), mgl32.Vec2{1, 0}},
+			{Rect(box.Max.X()+near, box.Min.Y()+skin, box.Max.X()+far, box.Max.Y()-skin), mgl32.Vec2{-1, 0}},
+		}
+	)
+	for _, probe := range probes {
+		normal := probe.normal
+		g.eachSolidCell(probe.area, func(x, y int32) {
+			res.addContact(GridContact{GridPoint{x, y}, normal})
+		})
+	}
+}
+
+// Calls visit with each solid cell overlapping area.
+func (g *Grid) eachSolidCell(area Rectangle, visit func(x, y int32)) {
+	var (
+		minX = g.cellAt(area.Min.X())
+		minY = g.cellAt(area.Min.Y())
+		maxX = g.cellAt(area.Max.X())
+		maxY = g.cellAt(area.Max.Y())
+		x, y int32
+	)
+	for x = minX; x <= maxX; x++ {
+		for y = minY; y <= maxY; y++ {
+			if SolidItem(g.Get(x, y)) {
+				visit(x, y)
+			}
+		}
+	}
+}
+
+// Returns the area covered by box as it moves along v.
+func sweptBounds(box Rectangle, v mgl32.Vec2) Rectangle {
+	var moved = box.Translate(Point{v})
+	return Rect(
+		float32(math.Min(float64(box.Min.X()), float64(moved.Min.X()))),
+		float32(math.Min(float64(box.Min.Y()), float64(moved.Min.Y()))),
+		float32(math.Max(float64(box.Max.X()), float64(moved.Max.X()))),
+		float32(math.Max(float64(box.Max.Y()), float64(moved.Max.Y()))),
+	)
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"testing"
+)
+
+func TestSweepMoveNoTunneling(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"....#.....",
+		)
+		res = g.SweepMove(Rect(0, 0, 1, 1), mgl32.Vec2{8, 0})
+	)
+	if !approxVec2(res.Move, mgl32.Vec2{3, 0}) {
+		t.Fatalf("Expected to stop at wall, moved %v", res.Move)
+	}
+	if !approxVec2(mgl32.Vec2{res.Time, 0}, mgl32.Vec2{0.375, 0}) {
+		t.Fatalf("Expected time of impact 0.375, got %v", res.Time)
+	}
+	if !res.OnWallRight() || res.OnWallLeft() || res.OnGround() {
+		t.Fatalf("Unexpected contacts %v", res.Contacts)
+	}
+}
+
+func TestSweepMoveLanding(t *testing.T) {
+	var (
+		g = newTestGrid(
+			".....",
+			".....",
+			".....",
+			"#####",
+		)
+		res = g.SweepMove(Rect(0.5, 2, 1.5, 3), mgl32.Vec2{2, -4})
+	)
+	if !approxVec2(res.Move, mgl32.Vec2{2, -1}) {
+		t.Fatalf("Expected to land and slide, moved %v", res.Move)
+	}
+	if !res.OnGround() {
+		t.Fatalf("Expected to be grounded, contacts %v", res.Contacts)
+	}
+	if res.OnWallLeft() || res.OnWallRight() {
+		t.Fatalf("Floor seams should not count as walls, contacts %v", res.Contacts)
+	}
+}
+
+func TestSweepMoveSlidesAlongWall(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"..#",
+			"..#",
+			"..#",
+		)
+		res = g.SweepMove(Rect(0, 0, 1, 1), mgl32.Vec2{2, 1})
+	)
+	if !approxVec2(res.Move, mgl32.Vec2{1, 1}) {
+		t.Fatalf("Expected to slide up wall, moved %v", res.Move)
+	}
+	if !res.OnWallRight() {
+		t.Fatalf("Expected wall contact, got %v", res.Contacts)
+	}
+}
+
+func TestSweepMoveResting(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"...",
+			"###",
+		)
+		res = g.SweepMove(Rect(1, 1, 2, 2), mgl32.Vec2{})
+	)
+	if !res.OnGround() || res.Time != 1 {
+		t.Fatalf("Expected resting ground contact, got %v", res)
+	}
+}
+
+func TestFixMove(t *testing.T) {
+	var (
+		g = newTestGrid(
+			"...#",
+		)
+		out = g.FixMove(mgl32.Vec4{0, 0, 1, 1}, mgl32.Vec2{5, 0})
+	)
+	if !approxVec2(out, mgl32.Vec2{2, 0}) {
+		t.Fatalf("Expected FixMove to stop at wall, got %v", out)
+	}
+}
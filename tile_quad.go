@@ -0,0 +1,60 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+// A rectangular tile cut from a tileset image, as produced by the map
+// loaders.  Implements TexturedTile for LoadBatch.
+type TileQuad struct {
+	X, Y          float32 // Bottom left in pixels, y pointing up.
+	Width, Height float32
+	TextureX      float32 // Top left in the tileset image in pixels.
+	TextureY      float32
+	FlipX         bool
+	FlipY         bool
+	FlipD         bool // Swaps the x and y axes before the other flips.
+}
+
+func (q TileQuad) ScaledBounds(ratio float32) (x, y, w, h float32) {
+	return q.X / ratio, q.Y / ratio, q.Width / ratio, q.Height / ratio
+}
+
+// Textures are flipped vertically when loaded, so rows are counted from the
+// bottom of the texture here.
+func (q TileQuad) ScaledTextureBounds(rx, ry float32) (x, y, w, h float32) {
+	var (
+		flipX = q.FlipX
+		flipY = q.FlipY
+	)
+	x = q.TextureX / rx
+	y = (ry - q.TextureY - q.Height) / ry
+	w = q.Width / rx
+	h = q.Height / ry
+	if q.FlipD {
+		// Once the axes are swapped each flip applies to the other axis,
+		// reversed.
+		flipX, flipY = !flipY, !flipX
+	}
+	if flipX {
+		x, w = x+w, -w
+	}
+	if flipY {
+		y, h = y+h, -h
+	}
+	return
+}
+
+func (q TileQuad) Transposed() bool {
+	return q.FlipD
+}
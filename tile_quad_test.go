@@ -0,0 +1,36 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"testing"
+)
+
+func TestTileQuadTransposed(t *testing.T) {
+	// Rotated 90 degrees clockwise, as Tiled stores it.
+	var (
+		quad = TileQuad{Width: 16, Height: 16, FlipD: true, FlipX: true}
+		v    = triangles(quad, 16, 16, 16)
+	)
+	// The bottom left corner of the cell shows the bottom right of the
+	// tile.
+	if v[3] != 1 || v[4] != 0 {
+		t.Fatalf("Expected bottom left to show texture %v, got %v %v", Pt(1, 0), v[3], v[4])
+	}
+	// Top left shows the bottom left of the tile.
+	if v[13] != 0 || v[14] != 0 {
+		t.Fatalf("Expected top left to show texture %v, got %v %v", Pt(0, 0), v[13], v[14])
+	}
+}
@@ -0,0 +1,1129 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Loads orthogonal maps made with the Tiled editor (http://www.mapeditor.org)
+// from TMX and JSON files.
+
+package twodee
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Flags stored in the top bits of global tile IDs.
+const (
+	tiledFlipH   = 0x80000000
+	tiledFlipV   = 0x40000000
+	tiledFlipD   = 0x20000000
+	tiledRotate  = 0x10000000 // Hexagonal maps only.
+	tiledGIDMask = ^uint32(tiledFlipH | tiledFlipV | tiledFlipD | tiledRotate)
+)
+
+// Custom properties set in Tiled.  Values are string, int, float64 or bool
+// depending on the property type.  Colors and files are strings and object
+// references are ints.
+type TiledProperties map[string]interface{}
+
+func (p TiledProperties) GetString(name string) (val string, ok bool) {
+	val, ok = p[name].(string)
+	return
+}
+
+func (p TiledProperties) GetInt(name string) (val int, ok bool) {
+	val, ok = p[name].(int)
+	return
+}
+
+// Returns float and int properties as float64.
+func (p TiledProperties) GetFloat(name string) (val float64, ok bool) {
+	switch v := p[name].(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return
+}
+
+func (p TiledProperties) GetBool(name string) (val bool, ok bool) {
+	val, ok = p[name].(bool)
+	return
+}
+
+// Converts a property value written as text into the type named by kind.
+func parseTiledProperty(kind, value string) (out interface{}, err error) {
+	switch kind {
+	case "int", "object":
+		return strconv.Atoi(value)
+	case "float":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		return strconv.ParseBool(value)
+	}
+	return value, nil
+}
+
+// A cell of a tile layer.  GID is 0 for empty cells.
+type TiledTile struct {
+	GID   uint32
+	FlipH bool
+	FlipV bool
+	FlipD bool // Swaps the x and y axes.  Applied before the other flips.
+}
+
+func newTiledTile(raw uint32) TiledTile {
+	return TiledTile{
+		GID:   raw & tiledGIDMask,
+		FlipH: raw&tiledFlipH != 0,
+		FlipV: raw&tiledFlipV != 0,
+		FlipD: raw&tiledFlipD != 0,
+	}
+}
+
+func (t TiledTile) Empty() bool {
+	return t.GID == 0
+}
+
+type TiledTileset struct {
+	FirstGID    uint32
+	Name        string
+	TileWidth   int
+	TileHeight  int
+	Spacing     int
+	Margin      int
+	TileCount   int
+	Columns     int
+	Image       string // Resolved relative to the map.
+	ImageWidth  int
+	ImageHeight int
+	// Types and properties of tiles, by ID within the tileset.
+	TileTypes      map[uint32]string
+	TileProperties map[uint32]TiledProperties
+}
+
+// Returns true if the tileset holds the tile with global ID gid.
+func (ts *TiledTileset) Contains(gid uint32) bool {
+	return gid >= ts.FirstGID && gid < ts.FirstGID+uint32(ts.TileCount)
+}
+
+// Returns the position of the tile with global ID gid in the tileset image,
+// in pixels from the top left.
+func (ts *TiledTileset) TileBounds(gid uint32) (x, y, w, h int) {
+	var (
+		id      = int(gid - ts.FirstGID)
+		columns = ts.Columns
+	)
+	if columns < 1 {
+		columns = 1
+	}
+	x = ts.Margin + (id%columns)*(ts.TileWidth+ts.Spacing)
+	y = ts.Margin + (id/columns)*(ts.TileHeight+ts.Spacing)
+	return x, y, ts.TileWidth, ts.TileHeight
+}
+
+func (ts *TiledTileset) Metadata(pxPerUnit int) TileMetadata {
+	var high = 0
+	if ts.Columns > 0 {
+		high = (ts.TileCount + ts.Columns - 1) / ts.Columns
+	}
+	return TileMetadata{
+		Path:          ts.Image,
+		PxPerUnit:     pxPerUnit,
+		TileWidth:     ts.TileWidth,
+		TileHeight:    ts.TileHeight,
+		FramesWide:    ts.Columns,
+		FramesHigh:    high,
+		Interpolation: NearestInterpolation,
+	}
+}
+
+type TiledTileLayer struct {
+	Name       string
+	Width      int
+	Height     int
+	Visible    bool
+	Opacity    float32
+	OffsetX    float32 // In pixels, positive x right and y down as in Tiled.
+	OffsetY    float32
+	Properties TiledProperties
+	Tiles      []TiledTile // Rows from the top of the map down.
+}
+
+// Returns the tile at x, y, counting rows from the bottom of the map as
+// Grid does.
+func (l *TiledTileLayer) Get(x, y int) TiledTile {
+	if x < 0 || y < 0 || x >= l.Width || y >= l.Height {
+		return TiledTile{}
+	}
+	return l.Tiles[(l.Height-y-1)*l.Width+x]
+}
+
+// An object placed in Tiled, such as a spawn point or trigger.  Positions
+// are in pixels as stored by Tiled, with y pointing down; use Bounds for
+// world coordinates.
+type TiledObject struct {
+	ID         int
+	Name       string
+	Type       string // Also holds the class set in Tiled 1.9 and later.
+	X          float32
+	Y          float32
+	Width      float32
+	Height     float32
+	Rotation   float32 // Degrees clockwise.
+	Visible    bool
+	Tile       TiledTile // Set for tile objects.
+	Point      bool
+	Ellipse    bool
+	Polygon    []Point // Relative to X, Y, also with y pointing down.
+	Polyline   []Point
+	Properties TiledProperties
+}
+
+type TiledObjectLayer struct {
+	Name       string
+	Visible    bool
+	OffsetX    float32
+	OffsetY    float32
+	Properties TiledProperties
+	Objects    []*TiledObject
+}
+
+type TiledMap struct {
+	Width        int // In tiles.
+	Height       int
+	TileWidth    int // In pixels.
+	TileHeight   int
+	Properties   TiledProperties
+	Tilesets     []*TiledTileset // Ordered by FirstGID.
+	TileLayers   []*TiledTileLayer
+	ObjectLayers []*TiledObjectLayer
+}
+
+// Returns the world space bounds of o, with the origin at the bottom left of
+// the map and y pointing up.  Rotation is ignored.
+func (m *TiledMap) Bounds(o *TiledObject, pxPerUnit float32) Rectangle {
+	var (
+		bottom = float32(m.Height*m.TileHeight) - o.Y
+	)
+	if o.Tile.Empty() {
+		// Tile objects are positioned by their bottom left corner, others
+		// by their top left.
+		bottom -= o.Height
+	}
+	return Rect(
+		o.X/pxPerUnit,
+		bottom/pxPerUnit,
+		(o.X+o.Width)/pxPerUnit,
+		(bottom+o.Height)/pxPerUnit,
+	)
+}
+
+// Returns the objects of the given type from every object layer.
+func (m *TiledMap) Objects(kind string) (out []*TiledObject) {
+	for _, layer := range m.ObjectLayers {
+		for _, o := range layer.Objects {
+			if o.Type == kind {
+				out = append(out, o)
+			}
+		}
+	}
+	return
+}
+
+func (m *TiledMap) TileLayer(name string) *TiledTileLayer {
+	for _, layer := range m.TileLayers {
+		if layer.Name == name {
+			return layer
+		}
+	}
+	return nil
+}
+
+func (m *TiledMap) ObjectLayer(name string) *TiledObjectLayer {
+	for _, layer := range m.ObjectLayers {
+		if layer.Name == name {
+			return layer
+		}
+	}
+	return nil
+}
+
+// Returns the tileset holding the tile with global ID gid, or nil.
+func (m *TiledMap) Tileset(gid uint32) *TiledTileset {
+	for i := len(m.Tilesets) - 1; i >= 0; i-- {
+		if m.Tilesets[i].FirstGID <= gid {
+			if m.Tilesets[i].Contains(gid) {
+				return m.Tilesets[i]
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// Returns the properties set on the tile t in its tileset, or nil.
+func (m *TiledMap) TileProperties(t TiledTile) TiledProperties {
+	if ts := m.Tileset(t.GID); ts != nil {
+		return ts.TileProperties[t.GID-ts.FirstGID]
+	}
+	return nil
+}
+
+// Returns the tiles of layer which come from ts, ready for LoadBatch with
+// ts.Metadata.  Tiles larger than the map's cells extend up and right from
+// the bottom left of their cell, as in Tiled.
+func (m *TiledMap) LayerTiles(layer *TiledTileLayer, ts *TiledTileset) (out []TexturedTile) {
+	for i, tile := range layer.Tiles {
+		if !ts.Contains(tile.GID) {
+			continue
+		}
+		var (
+			col          = i % layer.Width
+			row          = layer.Height - i/layer.Width - 1
+			tx, ty, _, _ = ts.TileBounds(tile.GID)
+		)
+		out = append(out, TileQuad{
+			X:        float32(col*m.TileWidth) + layer.OffsetX,
+			Y:        float32(row*m.TileHeight) - layer.OffsetY,
+			Width:    float32(ts.TileWidth),
+			Height:   float32(ts.TileHeight),
+			TextureX: float32(tx),
+			TextureY: float32(ty),
+			FlipX:    tile.FlipH,
+			FlipY:    tile.FlipV,
+			FlipD:    tile.FlipD,
+		})
+	}
+	return
+}
+
+// A Batch holding the tiles of one layer from one tileset.
+type TiledBatch struct {
+	*Batch
+	Layer   *TiledTileLayer
+	Tileset *TiledTileset
+}
+
+// Loads a Batch for each tile layer, in drawing order.  Layers using
+// several tilesets get a Batch for each of them.  Tilesets made of separate
+// images can't be batched and are skipped.
+func (m *TiledMap) LoadBatches(pxPerUnit int) (batches []*TiledBatch, err error) {
+	for _, layer := range m.TileLayers {
+		for _, ts := range m.Tilesets {
+			var (
+				tiles = m.LayerTiles(layer, ts)
+				batch *Batch
+			)
+			if len(tiles) == 0 || ts.Image == "" {
+				continue
+			}
+			if batch, err = LoadBatch(tiles, ts.Metadata(pxPerUnit)); err != nil {
+				for _, b := range batches {
+					b.Delete()
+				}
+				return nil, err
+			}
+			batches = append(batches, &TiledBatch{batch, layer, ts})
+		}
+	}
+	return
+}
+
+// Default item placed in grids built from Tiled maps.  It blocks movement
+// and sight.
+type TiledGridItem struct {
+	Tile       TiledTile
+	Properties TiledProperties
+}
+
+func (i TiledGridItem) Passable() bool {
+	return true
+}
+
+func (i TiledGridItem) Opaque() bool {
+	return true
+}
+
+type TiledGridOptions struct {
+	// Only tiles from this layer are used if set.
+	Layer string
+	// Only tiles with this bool property set to true are used if set.
+	Property  string
+	BlockSize int32
+	// Returns the item for a selected tile.  Defaults to TiledGridItem.
+	Item func(tile TiledTile, properties TiledProperties) GridItem
+}
+
+// Builds a Grid the size of the map from a collision layer, from tiles with
+// a collision property, or both.  When tiles from several layers share a
+// cell, the topmost one wins.
+func (m *TiledMap) Grid(opts TiledGridOptions) (g *Grid, err error) {
+	var layers = m.TileLayers
+	if opts.Layer != "" {
+		var layer = m.TileLayer(opts.Layer)
+		if layer == nil {
+			err = fmt.Errorf("No tile layer named %v", opts.Layer)
+			return
+		}
+		layers = []*TiledTileLayer{layer}
+	}
+	if opts.Item == nil {
+		opts.Item = func(tile TiledTile, properties TiledProperties) GridItem {
+			return TiledGridItem{tile, properties}
+		}
+	}
+	g = NewGrid(int32(m.Width), int32(m.Height), opts.BlockSize)
+	for _, layer := range layers {
+		for y := 0; y < m.Height; y++ {
+			for x := 0; x < m.Width; x++ {
+				var (
+					tile       = layer.Get(x, y)
+					properties = m.TileProperties(tile)
+				)
+				if tile.Empty() {
+					continue
+				}
+				if opts.Property != "" {
+					if val, _ := properties.GetBool(opts.Property); !val {
+						continue
+					}
+				}
+				if item := opts.Item(tile, properties); item != nil {
+					g.Set(int32(x), int32(y), item)
+				}
+			}
+		}
+	}
+	return
+}
+
+// Loads a map from a .tmx file, or a .json or .tmj file.  External tilesets
+// and images are found relative to the map.
+func LoadTiledMap(path string) (m *TiledMap, err error) {
+	var contents []byte
+	if contents, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tmx":
+		return ParseTMX(contents, filepath.Dir(path))
+	case ".json", ".tmj":
+		return ParseTiledJSON(contents, filepath.Dir(path))
+	}
+	return nil, fmt.Errorf("Unknown Tiled map format %v", path)
+}
+
+func checkTiledMap(orientation string, infinite bool) error {
+	if orientation != "orthogonal" {
+		return fmt.Errorf("Unsupported Tiled map orientation %v", orientation)
+	}
+	if infinite {
+		return fmt.Errorf("Infinite Tiled maps are not supported")
+	}
+	return nil
+}
+
+func sortTiledTilesets(tilesets []*TiledTileset) {
+	sort.Slice(tilesets, func(i, j int) bool {
+		return tilesets[i].FirstGID < tilesets[j].FirstGID
+	})
+}
+
+// Decodes layer data stored as base64 little endian IDs, optionally
+// compressed.
+func decodeTiledBase64(text, compression string, count int) (tiles []TiledTile, err error) {
+	var (
+		data []byte
+		raw  []uint32
+	)
+	if data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(text)); err != nil {
+		return
+	}
+	switch compression {
+	case "":
+	case "gzip", "zlib":
+		var reader io.Reader
+		if compression == "gzip" {
+			reader, err = gzip.NewReader(bytes.NewReader(data))
+		} else {
+			reader, err = zlib.NewReader(bytes.NewReader(data))
+		}
+		if err != nil {
+			return
+		}
+		if data, err = ioutil.ReadAll(reader); err != nil {
+			return
+		}
+	default:
+		err = fmt.Errorf("Unsupported Tiled compression %v", compression)
+		return
+	}
+	if len(data) != 4*count {
+		err = fmt.Errorf("Tiled layer has %v bytes, expected %v", len(data), 4*count)
+		return
+	}
+	raw = make([]uint32, count)
+	if err = binary.Read(bytes.NewReader(data), binary.LittleEndian, raw); err != nil {
+		return
+	}
+	tiles = make([]TiledTile, count)
+	for i, gid := range raw {
+		tiles[i] = newTiledTile(gid)
+	}
+	return
+}
+
+func decodeTiledCSV(text string, count int) (tiles []TiledTile, err error) {
+	var fields = strings.Split(strings.TrimSpace(text), ",")
+	if len(fields) != count {
+		err = fmt.Errorf("Tiled layer has %v tiles, expected %v", len(fields), count)
+		return
+	}
+	tiles = make([]TiledTile, count)
+	for i, field := range fields {
+		var gid uint64
+		if gid, err = strconv.ParseUint(strings.TrimSpace(field), 10, 32); err != nil {
+			return
+		}
+		tiles[i] = newTiledTile(uint32(gid))
+	}
+	return
+}
+
+type tmxProperty struct {
+	Name  string `xml:"name,attr"`
+	Type  string `xml:"type,attr"`
+	Value string `xml:"value,attr"`
+	Text  string `xml:",chardata"` // Multiline strings.
+}
+
+func tmxProperties(props []tmxProperty) (out TiledProperties, err error) {
+	out = TiledProperties{}
+	for _, p := range props {
+		var value = p.Value
+		if value == "" {
+			value = p.Text
+		}
+		if out[p.Name], err = parseTiledProperty(p.Type, value); err != nil {
+			return
+		}
+	}
+	return
+}
+
+type tmxImage struct {
+	Source string `xml:"source,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+}
+
+type tmxTile struct {
+	ID         uint32        `xml:"id,attr"`
+	Type       string        `xml:"type,attr"`
+	Class      string        `xml:"class,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+}
+
+type tmxTileset struct {
+	FirstGID   uint32    `xml:"firstgid,attr"`
+	Source     string    `xml:"source,attr"`
+	Name       string    `xml:"name,attr"`
+	TileWidth  int       `xml:"tilewidth,attr"`
+	TileHeight int       `xml:"tileheight,attr"`
+	Spacing    int       `xml:"spacing,attr"`
+	Margin     int       `xml:"margin,attr"`
+	TileCount  int       `xml:"tilecount,attr"`
+	Columns    int       `xml:"columns,attr"`
+	Image      tmxImage  `xml:"image"`
+	Tiles      []tmxTile `xml:"tile"`
+}
+
+type tmxData struct {
+	Encoding    string `xml:"encoding,attr"`
+	Compression string `xml:"compression,attr"`
+	Text        string `xml:",chardata"`
+	Tiles       []struct {
+		GID uint32 `xml:"gid,attr"`
+	} `xml:"tile"`
+}
+
+type tmxPoints struct {
+	Points string `xml:"points,attr"`
+}
+
+type tmxObject struct {
+	ID         int           `xml:"id,attr"`
+	Name       string        `xml:"name,attr"`
+	Type       string        `xml:"type,attr"`
+	Class      string        `xml:"class,attr"`
+	X          float32       `xml:"x,attr"`
+	Y          float32       `xml:"y,attr"`
+	Width      float32       `xml:"width,attr"`
+	Height     float32       `xml:"height,attr"`
+	Rotation   float32       `xml:"rotation,attr"`
+	GID        uint32        `xml:"gid,attr"`
+	Visible    *int          `xml:"visible,attr"`
+	Point      *struct{}     `xml:"point"`
+	Ellipse    *struct{}     `xml:"ellipse"`
+	Polygon    *tmxPoints    `xml:"polygon"`
+	Polyline   *tmxPoints    `xml:"polyline"`
+	Properties []tmxProperty `xml:"properties>property"`
+}
+
+// Any of the layer elements.  Groups hold further layers.
+type tmxLayer struct {
+	XMLName    xml.Name
+	Name       string        `xml:"name,attr"`
+	Width      int           `xml:"width,attr"`
+	Height     int           `xml:"height,attr"`
+	Visible    *int          `xml:"visible,attr"`
+	Opacity    *float32      `xml:"opacity,attr"`
+	OffsetX    float32       `xml:"offsetx,attr"`
+	OffsetY    float32       `xml:"offsety,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+	Data       tmxData       `xml:"data"`
+	Objects    []tmxObject   `xml:"object"`
+	Layers     []tmxLayer    `xml:",any"`
+}
+
+type tmxMap struct {
+	Orientation string        `xml:"orientation,attr"`
+	Width       int           `xml:"width,attr"`
+	Height      int           `xml:"height,attr"`
+	TileWidth   int           `xml:"tilewidth,attr"`
+	TileHeight  int           `xml:"tileheight,attr"`
+	Infinite    int           `xml:"infinite,attr"`
+	Properties  []tmxProperty `xml:"properties>property"`
+	Tilesets    []tmxTileset  `xml:"tileset"`
+	Layers      []tmxLayer    `xml:",any"`
+}
+
+// Parses a map in Tiled's XML format.  External tilesets and images are
+// found relative to dir.
+func ParseTMX(contents []byte, dir string) (m *TiledMap, err error) {
+	var parsed tmxMap
+	if err = xml.Unmarshal(contents, &parsed); err != nil {
+		return
+	}
+	if err = checkTiledMap(parsed.Orientation, parsed.Infinite != 0); err != nil {
+		return
+	}
+	m = &TiledMap{
+		Width:      parsed.Width,
+		Height:     parsed.Height,
+		TileWidth:  parsed.TileWidth,
+		TileHeight: parsed.TileHeight,
+	}
+	if m.Properties, err = tmxProperties(parsed.Properties); err != nil {
+		return nil, err
+	}
+	for _, ts := range parsed.Tilesets {
+		var tileset *TiledTileset
+		if tileset, err = loadTMXTileset(ts, dir); err != nil {
+			return nil, err
+		}
+		m.Tilesets = append(m.Tilesets, tileset)
+	}
+	sortTiledTilesets(m.Tilesets)
+	if err = m.addTMXLayers(parsed.Layers, tiledGroup{visible: true, opacity: 1}); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func loadTMXTileset(ts tmxTileset, dir string) (out *TiledTileset, err error) {
+	if ts.Source != "" {
+		var (
+			path     = filepath.Join(dir, ts.Source)
+			contents []byte
+			firstGID = ts.FirstGID
+		)
+		if strings.ToLower(filepath.Ext(path)) == ".json" || strings.ToLower(filepath.Ext(path)) == ".tsj" {
+			return loadTiledJSONTileset(tiledJSONTileset{FirstGID: firstGID, Source: ts.Source}, dir)
+		}
+		if contents, err = ioutil.ReadFile(path); err != nil {
+			return
+		}
+		ts = tmxTileset{}
+		if err = xml.Unmarshal(contents, &ts); err != nil {
+			return
+		}
+		ts.FirstGID = firstGID
+		dir = filepath.Dir(path)
+	}
+	out = &TiledTileset{
+		FirstGID:       ts.FirstGID,
+		Name:           ts.Name,
+		TileWidth:      ts.TileWidth,
+		TileHeight:     ts.TileHeight,
+		Spacing:        ts.Spacing,
+		Margin:         ts.Margin,
+		TileCount:      ts.TileCount,
+		Columns:        ts.Columns,
+		ImageWidth:     ts.Image.Width,
+		ImageHeight:    ts.Image.Height,
+		TileTypes:      map[uint32]string{},
+		TileProperties: map[uint32]TiledProperties{},
+	}
+	if ts.Image.Source != "" {
+		out.Image = filepath.Join(dir, ts.Image.Source)
+	}
+	for _, tile := range ts.Tiles {
+		if tile.Class != "" {
+			tile.Type = tile.Class
+		}
+		if tile.Type != "" {
+			out.TileTypes[tile.ID] = tile.Type
+		}
+		if len(tile.Properties) > 0 {
+			if out.TileProperties[tile.ID], err = tmxProperties(tile.Properties); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Settings inherited from enclosing group layers.
+type tiledGroup struct {
+	visible bool
+	opacity float32
+	offsetX float32
+	offsetY float32
+}
+
+func (g tiledGroup) child(visible bool, opacity, offsetX, offsetY float32) tiledGroup {
+	return tiledGroup{
+		visible: g.visible && visible,
+		opacity: g.opacity * opacity,
+		offsetX: g.offsetX + offsetX,
+		offsetY: g.offsetY + offsetY,
+	}
+}
+
+func (m *TiledMap) addTMXLayers(layers []tmxLayer, group tiledGroup) (err error) {
+	for _, layer := range layers {
+		var (
+			visible    = layer.Visible == nil || *layer.Visible != 0
+			opacity    = float32(1)
+			properties TiledProperties
+		)
+		if layer.Opacity != nil {
+			opacity = *layer.Opacity
+		}
+		var inherited = group.child(visible, opacity, layer.OffsetX, layer.OffsetY)
+		if properties, err = tmxProperties(layer.Properties); err != nil {
+			return
+		}
+		switch layer.XMLName.Local {
+		case "layer":
+			var out = &TiledTileLayer{
+				Name:       layer.Name,
+				Width:      layer.Width,
+				Height:     layer.Height,
+				Visible:    inherited.visible,
+				Opacity:    inherited.opacity,
+				OffsetX:    inherited.offsetX,
+				OffsetY:    inherited.offsetY,
+				Properties: properties,
+			}
+			var count = layer.Width * layer.Height
+			switch layer.Data.Encoding {
+			case "csv":
+				out.Tiles, err = decodeTiledCSV(layer.Data.Text, count)
+			case "base64":
+				out.Tiles, err = decodeTiledBase64(layer.Data.Text, layer.Data.Compression, count)
+			case "":
+				if len(layer.Data.Tiles) != count {
+					err = fmt.Errorf("Tiled layer has %v tiles, expected %v", len(layer.Data.Tiles), count)
+					break
+				}
+				out.Tiles = make([]TiledTile, count)
+				for i, tile := range layer.Data.Tiles {
+					out.Tiles[i] = newTiledTile(tile.GID)
+				}
+			default:
+				err = fmt.Errorf("Unsupported Tiled encoding %v", layer.Data.Encoding)
+			}
+			if err != nil {
+				return
+			}
+			m.TileLayers = append(m.TileLayers, out)
+		case "objectgroup":
+			var out = &TiledObjectLayer{
+				Name:       layer.Name,
+				Visible:    inherited.visible,
+				OffsetX:    inherited.offsetX,
+				OffsetY:    inherited.offsetY,
+				Properties: properties,
+			}
+			for _, o := range layer.Objects {
+				var object *TiledObject
+				if object, err = newTMXObject(o); err != nil {
+					return
+				}
+				out.Objects = append(out.Objects, object)
+			}
+			m.ObjectLayers = append(m.ObjectLayers, out)
+		case "group":
+			if err = m.addTMXLayers(layer.Layers, inherited); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func parseTMXPoints(points *tmxPoints) (out []Point, err error) {
+	if points == nil {
+		return
+	}
+	for _, pair := range strings.Fields(points.Points) {
+		var (
+			coords = strings.Split(pair, ",")
+			x, y   float64
+		)
+		if len(coords) != 2 {
+			return nil, fmt.Errorf("Invalid Tiled point %v", pair)
+		}
+		if x, err = strconv.ParseFloat(coords[0], 32); err != nil {
+			return
+		}
+		if y, err = strconv.ParseFloat(coords[1], 32); err != nil {
+			return
+		}
+		out = append(out, Pt(float32(x), float32(y)))
+	}
+	return
+}
+
+func newTMXObject(o tmxObject) (out *TiledObject, err error) {
+	out = &TiledObject{
+		ID:       o.ID,
+		Name:     o.Name,
+		Type:     o.Type,
+		X:        o.X,
+		Y:        o.Y,
+		Width:    o.Width,
+		Height:   o.Height,
+		Rotation: o.Rotation,
+		Visible:  o.Visible == nil || *o.Visible != 0,
+		Tile:     newTiledTile(o.GID),
+		Point:    o.Point != nil,
+		Ellipse:  o.Ellipse != nil,
+	}
+	if o.Class != "" {
+		out.Type = o.Class
+	}
+	if out.Properties, err = tmxProperties(o.Properties); err != nil {
+		return
+	}
+	if out.Polygon, err = parseTMXPoints(o.Polygon); err != nil {
+		return
+	}
+	out.Polyline, err = parseTMXPoints(o.Polyline)
+	return
+}
+
+type tiledJSONProperty struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+func tiledJSONProperties(props []tiledJSONProperty) (out TiledProperties) {
+	out = TiledProperties{}
+	for _, p := range props {
+		var value = p.Value
+		if f, ok := value.(float64); ok && (p.Type == "int" || p.Type == "object") {
+			value = int(f)
+		}
+		out[p.Name] = value
+	}
+	return
+}
+
+type tiledJSONTile struct {
+	ID         uint32              `json:"id"`
+	Type       string              `json:"type"`
+	Class      string              `json:"class"`
+	Properties []tiledJSONProperty `json:"properties"`
+}
+
+type tiledJSONTileset struct {
+	FirstGID    uint32          `json:"firstgid"`
+	Source      string          `json:"source"`
+	Name        string          `json:"name"`
+	TileWidth   int             `json:"tilewidth"`
+	TileHeight  int             `json:"tileheight"`
+	Spacing     int             `json:"spacing"`
+	Margin      int             `json:"margin"`
+	TileCount   int             `json:"tilecount"`
+	Columns     int             `json:"columns"`
+	Image       string          `json:"image"`
+	ImageWidth  int             `json:"imagewidth"`
+	ImageHeight int             `json:"imageheight"`
+	Tiles       []tiledJSONTile `json:"tiles"`
+}
+
+type tiledJSONPoint struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+}
+
+type tiledJSONObject struct {
+	ID         int                 `json:"id"`
+	Name       string              `json:"name"`
+	Type       string              `json:"type"`
+	Class      string              `json:"class"`
+	X          float32             `json:"x"`
+	Y          float32             `json:"y"`
+	Width      float32             `json:"width"`
+	Height     float32             `json:"height"`
+	Rotation   float32             `json:"rotation"`
+	GID        uint32              `json:"gid"`
+	Visible    *bool               `json:"visible"`
+	Point      bool                `json:"point"`
+	Ellipse    bool                `json:"ellipse"`
+	Polygon    []tiledJSONPoint    `json:"polygon"`
+	Polyline   []tiledJSONPoint    `json:"polyline"`
+	Properties []tiledJSONProperty `json:"properties"`
+}
+
+type tiledJSONLayer struct {
+	Type        string              `json:"type"`
+	Name        string              `json:"name"`
+	Width       int                 `json:"width"`
+	Height      int                 `json:"height"`
+	Visible     *bool               `json:"visible"`
+	Opacity     *float32            `json:"opacity"`
+	OffsetX     float32             `json:"offsetx"`
+	OffsetY     float32             `json:"offsety"`
+	Encoding    string              `json:"encoding"`
+	Compression string              `json:"compression"`
+	Data        json.RawMessage     `json:"data"`
+	Objects     []tiledJSONObject   `json:"objects"`
+	Layers      []tiledJSONLayer    `json:"layers"`
+	Properties  []tiledJSONProperty `json:"properties"`
+}
+
+type tiledJSONMap struct {
+	Orientation string              `json:"orientation"`
+	Width       int                 `json:"width"`
+	Height      int                 `json:"height"`
+	TileWidth   int                 `json:"tilewidth"`
+	TileHeight  int                 `json:"tileheight"`
+	Infinite    bool                `json:"infinite"`
+	Properties  []tiledJSONProperty `json:"properties"`
+	Tilesets    []tiledJSONTileset  `json:"tilesets"`
+	Layers      []tiledJSONLayer    `json:"layers"`
+}
+
+// Parses a map in Tiled's JSON format.  External tilesets and images are
+// found relative to dir.
+func ParseTiledJSON(contents []byte, dir string) (m *TiledMap, err error) {
+	var parsed tiledJSONMap
+	if err = json.Unmarshal(contents, &parsed); err != nil {
+		return
+	}
+	if err = checkTiledMap(parsed.Orientation, parsed.Infinite); err != nil {
+		return
+	}
+	m = &TiledMap{
+		Width:      parsed.Width,
+		Height:     parsed.Height,
+		TileWidth:  parsed.TileWidth,
+		TileHeight: parsed.TileHeight,
+		Properties: tiledJSONProperties(parsed.Properties),
+	}
+	for _, ts := range parsed.Tilesets {
+		var tileset *TiledTileset
+		if tileset, err = loadTiledJSONTileset(ts, dir); err != nil {
+			return nil, err
+		}
+		m.Tilesets = append(m.Tilesets, tileset)
+	}
+	sortTiledTilesets(m.Tilesets)
+	if err = m.addTiledJSONLayers(parsed.Layers, tiledGroup{visible: true, opacity: 1}); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func loadTiledJSONTileset(ts tiledJSONTileset, dir string) (out *TiledTileset, err error) {
+	if ts.Source != "" {
+		var (
+			path     = filepath.Join(dir, ts.Source)
+			contents []byte
+			firstGID = ts.FirstGID
+		)
+		if strings.ToLower(filepath.Ext(path)) == ".tsx" {
+			return loadTMXTileset(tmxTileset{FirstGID: firstGID, Source: ts.Source}, dir)
+		}
+		if contents, err = ioutil.ReadFile(path); err != nil {
+			return
+		}
+		ts = tiledJSONTileset{}
+		if err = json.Unmarshal(contents, &ts); err != nil {
+			return
+		}
+		ts.FirstGID = firstGID
+		dir = filepath.Dir(path)
+	}
+	out = &TiledTileset{
+		FirstGID:       ts.FirstGID,
+		Name:           ts.Name,
+		TileWidth:      ts.TileWidth,
+		TileHeight:     ts.TileHeight,
+		Spacing:        ts.Spacing,
+		Margin:         ts.Margin,
+		TileCount:      ts.TileCount,
+		Columns:        ts.Columns,
+		ImageWidth:     ts.ImageWidth,
+		ImageHeight:    ts.ImageHeight,
+		TileTypes:      map[uint32]string{},
+		TileProperties: map[uint32]TiledProperties{},
+	}
+	if ts.Image != "" {
+		out.Image = filepath.Join(dir, ts.Image)
+	}
+	for _, tile := range ts.Tiles {
+		if tile.Class != "" {
+			tile.Type = tile.Class
+		}
+		if tile.Type != "" {
+			out.TileTypes[tile.ID] = tile.Type
+		}
+		if len(tile.Properties) > 0 {
+			out.TileProperties[tile.ID] = tiledJSONProperties(tile.Properties)
+		}
+	}
+	return
+}
+
+func (m *TiledMap) addTiledJSONLayers(layers []tiledJSONLayer, group tiledGroup) (err error) {
+	for _, layer := range layers {
+		var (
+			visible    = layer.Visible == nil || *layer.Visible
+			opacity    = float32(1)
+			properties = tiledJSONProperties(layer.Properties)
+		)
+		if layer.Opacity != nil {
+			opacity = *layer.Opacity
+		}
+		var inherited = group.child(visible, opacity, layer.OffsetX, layer.OffsetY)
+		switch layer.Type {
+		case "tilelayer":
+			var out = &TiledTileLayer{
+				Name:       layer.Name,
+				Width:      layer.Width,
+				Height:     layer.Height,
+				Visible:    inherited.visible,
+				Opacity:    inherited.opacity,
+				OffsetX:    inherited.offsetX,
+				OffsetY:    inherited.offsetY,
+				Properties: properties,
+			}
+			if out.Tiles, err = decodeTiledJSONData(layer); err != nil {
+				return
+			}
+			m.TileLayers = append(m.TileLayers, out)
+		case "objectgroup":
+			var out = &TiledObjectLayer{
+				Name:       layer.Name,
+				Visible:    inherited.visible,
+				OffsetX:    inherited.offsetX,
+				OffsetY:    inherited.offsetY,
+				Properties: properties,
+			}
+			for _, o := range layer.Objects {
+				out.Objects = append(out.Objects, newTiledJSONObject(o))
+			}
+			m.ObjectLayers = append(m.ObjectLayers, out)
+		case "group":
+			if err = m.addTiledJSONLayers(layer.Layers, inherited); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func decodeTiledJSONData(layer tiledJSONLayer) (tiles []TiledTile, err error) {
+	var count = layer.Width * layer.Height
+	if layer.Encoding == "base64" {
+		var text string
+		if err = json.Unmarshal(layer.Data, &text); err != nil {
+			return
+		}
+		return decodeTiledBase64(text, layer.Compression, count)
+	}
+	var raw []uint32
+	if err = json.Unmarshal(layer.Data, &raw); err != nil {
+		return
+	}
+	if len(raw) != count {
+		err = fmt.Errorf("Tiled layer has %v tiles, expected %v", len(raw), count)
+		return
+	}
+	tiles = make([]TiledTile, count)
+	for i, gid := range raw {
+		tiles[i] = newTiledTile(gid)
+	}
+	return
+}
+
+func tiledJSONPoints(points []tiledJSONPoint) (out []Point) {
+	for _, p := range points {
+		out = append(out, Pt(p.X, p.Y))
+	}
+	return
+}
+
+func newTiledJSONObject(o tiledJSONObject) (out *TiledObject) {
+	out = &TiledObject{
+		ID:         o.ID,
+		Name:       o.Name,
+		Type:       o.Type,
+		X:          o.X,
+		Y:          o.Y,
+		Width:      o.Width,
+		Height:     o.Height,
+		Rotation:   o.Rotation,
+		Visible:    o.Visible == nil || *o.Visible,
+		Tile:       newTiledTile(o.GID),
+		Point:      o.Point,
+		Ellipse:    o.Ellipse,
+		Polygon:    tiledJSONPoints(o.Polygon),
+		Polyline:   tiledJSONPoints(o.Polyline),
+		Properties: tiledJSONProperties(o.Properties),
+	}
+	if o.Class != "" {
+		out.Type = o.Class
+	}
+	return
+}
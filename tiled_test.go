@@ -0,0 +1,280 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const TEST_TSX_STRING = `<?xml version="1.0" encoding="UTF-8"?>
+<tileset name="props" tilewidth="16" tileheight="32" tilecount="4" columns="2">
+ <image source="images/props.png" width="32" height="64"/>
+</tileset>`
+
+const TEST_TMX_STRING = `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.2" orientation="orthogonal" width="3" height="2" tilewidth="16" tileheight="16" infinite="0">
+ <properties>
+  <property name="music" value="cave.ogg"/>
+ </properties>
+ <tileset firstgid="1" name="terrain" tilewidth="16" tileheight="16" spacing="1" margin="1" tilecount="8" columns="4">
+  <image source="terrain.png" width="69" height="35"/>
+  <tile id="1" type="wall">
+   <properties>
+    <property name="solid" type="bool" value="true"/>
+   </properties>
+  </tile>
+ </tileset>
+ <tileset firstgid="9" source="props.tsx"/>
+ <layer name="ground" width="3" height="2">
+  <data encoding="csv">
+1,2147483650,1,
+1,1,10
+</data>
+ </layer>
+ <group name="upper" offsetx="4" visible="0">
+  <layer name="walls" width="3" height="2">
+   <data encoding="base64" compression="zlib">%v</data>
+  </layer>
+ </group>
+ <objectgroup name="spawns">
+  <object id="1" name="hero" type="player" x="8" y="24" width="16" height="8">
+   <properties>
+    <property name="health" type="int" value="3"/>
+    <property name="speed" type="float" value="1.5"/>
+   </properties>
+  </object>
+  <object id="2" class="crate" gid="9" x="32" y="32" width="16" height="32"/>
+  <object id="3" name="route" x="0" y="0">
+   <polyline points="0,0 16,8"/>
+  </object>
+ </objectgroup>
+</map>`
+
+const TEST_TILED_JSON_STRING = `{
+  "orientation": "orthogonal", "width": 2, "height": 1,
+  "tilewidth": 16, "tileheight": 16, "infinite": false,
+  "tilesets": [
+    {"firstgid": 5, "name": "b", "tilewidth": 16, "tileheight": 16,
+     "tilecount": 4, "columns": 2, "image": "b.png",
+     "imagewidth": 32, "imageheight": 32},
+    {"firstgid": 1, "name": "a", "tilewidth": 16, "tileheight": 16,
+     "tilecount": 4, "columns": 4, "image": "a.png",
+     "imagewidth": 64, "imageheight": 16,
+     "tiles": [{"id": 0, "properties": [{"name": "solid", "type": "bool", "value": true}]}]}
+  ],
+  "layers": [
+    {"type": "tilelayer", "name": "ground", "width": 2, "height": 1,
+     "visible": true, "opacity": 0.5, "data": [1, 1073741830]},
+    {"type": "group", "name": "objects", "layers": [
+      {"type": "objectgroup", "name": "spawns", "visible": true, "objects": [
+        {"id": 1, "name": "hero", "type": "player", "x": 0, "y": 16,
+         "width": 0, "height": 0, "point": true,
+         "properties": [{"name": "health", "type": "int", "value": 5}]}
+      ]}
+    ]}
+  ]
+}`
+
+// Encodes gids as Tiled does for base64 zlib layers.
+func encodeTiledZlib(gids []uint32) string {
+	var (
+		raw        bytes.Buffer
+		compressed bytes.Buffer
+		writer     = zlib.NewWriter(&compressed)
+	)
+	binary.Write(&raw, binary.LittleEndian, gids)
+	writer.Write(raw.Bytes())
+	writer.Close()
+	return base64.StdEncoding.EncodeToString(compressed.Bytes())
+}
+
+func loadTestTMX(t *testing.T) *TiledMap {
+	var (
+		dir      string
+		contents = fmt.Sprintf(TEST_TMX_STRING, encodeTiledZlib([]uint32{0, 2, 0, 0, 0, 2}))
+		m        *TiledMap
+		err      error
+	)
+	if dir, err = ioutil.TempDir("", "tiled"); err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "props.tsx"), []byte(TEST_TSX_STRING), 0644); err != nil {
+		t.Fatalf("Could not write tileset: %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "map.tmx"), []byte(contents), 0644); err != nil {
+		t.Fatalf("Could not write map: %v", err)
+	}
+	if m, err = LoadTiledMap(filepath.Join(dir, "map.tmx")); err != nil {
+		t.Fatalf("Problem loading TMX: %v", err)
+	}
+	return m
+}
+
+func TestParseTMX(t *testing.T) {
+	var (
+		m      = loadTestTMX(t)
+		ground = m.TileLayer("ground")
+		walls  = m.TileLayer("walls")
+	)
+	if music, _ := m.Properties.GetString("music"); music != "cave.ogg" {
+		t.Fatalf("Expected map property, got %v", m.Properties)
+	}
+	if len(m.Tilesets) != 2 || m.Tilesets[1].Name != "props" || m.Tilesets[1].FirstGID != 9 {
+		t.Fatalf("Expected external tileset, got %v", m.Tilesets[1])
+	}
+	if filepath.Base(m.Tilesets[1].Image) != "props.png" || filepath.Base(filepath.Dir(m.Tilesets[1].Image)) != "images" {
+		t.Fatalf("Expected image relative to tileset, got %v", m.Tilesets[1].Image)
+	}
+	if ground == nil || walls == nil {
+		t.Fatalf("Expected ground and walls layers")
+	}
+	if tile := ground.Tiles[1]; tile.GID != 2 || !tile.FlipH || tile.FlipV {
+		t.Fatalf("Expected horizontally flipped tile 2, got %+v", tile)
+	}
+	if tile := ground.Get(2, 0); tile.GID != 10 || m.Tileset(tile.GID).Name != "props" {
+		t.Fatalf("Expected props tile at bottom right, got %+v", tile)
+	}
+	if walls.Visible || walls.OffsetX != 4 || walls.Get(1, 1).GID != 2 {
+		t.Fatalf("Expected hidden, offset walls layer from group, got %+v", walls)
+	}
+	if kind := m.Tilesets[0].TileTypes[1]; kind != "wall" {
+		t.Fatalf("Expected tile type, got %v", kind)
+	}
+	players := m.Objects("player")
+	if len(players) != 1 {
+		t.Fatalf("Expected one player spawn, got %v", players)
+	}
+	if health, _ := players[0].Properties.GetInt("health"); health != 3 {
+		t.Fatalf("Expected int property, got %v", players[0].Properties)
+	}
+	if speed, _ := players[0].Properties.GetFloat("speed"); speed != 1.5 {
+		t.Fatalf("Expected float property, got %v", players[0].Properties)
+	}
+	if bounds := m.Bounds(players[0], 16); bounds != Rect(0.5, 0, 1.5, 0.5) {
+		t.Fatalf("Unexpected spawn bounds %v", bounds)
+	}
+	crates := m.Objects("crate")
+	if len(crates) != 1 || crates[0].Tile.GID != 9 {
+		t.Fatalf("Expected tile object with class, got %v", crates)
+	}
+	if bounds := m.Bounds(crates[0], 16); bounds != Rect(2, 0, 3, 2) {
+		t.Fatalf("Unexpected tile object bounds %v", bounds)
+	}
+	if route := m.ObjectLayer("spawns").Objects[2]; len(route.Polyline) != 2 || route.Polyline[1] != Pt(16, 8) {
+		t.Fatalf("Expected polyline, got %v", route.Polyline)
+	}
+}
+
+func TestTiledLayerTiles(t *testing.T) {
+	var (
+		m       = loadTestTMX(t)
+		ground  = m.TileLayer("ground")
+		terrain = m.LayerTiles(ground, m.Tilesets[0])
+		props   = m.LayerTiles(ground, m.Tilesets[1])
+	)
+	if len(terrain) != 5 || len(props) != 1 {
+		t.Fatalf("Expected tiles split by tileset, got %v and %v", len(terrain), len(props))
+	}
+	// First tile: gid 1 at the top left of the map and the tileset.
+	if x, y, w, h := terrain[0].ScaledBounds(16); x != 0 || y != 1 || w != 1 || h != 1 {
+		t.Fatalf("Unexpected bounds %v %v %v %v", x, y, w, h)
+	}
+	if x, y, w, h := terrain[0].ScaledTextureBounds(128, 64); x != 1.0/128 || y != 47.0/64 || w != 16.0/128 || h != 16.0/64 {
+		t.Fatalf("Unexpected texture bounds %v %v %v %v", x, y, w, h)
+	}
+	// Second tile is gid 2 flipped horizontally.
+	if x, _, w, _ := terrain[1].ScaledTextureBounds(128, 64); x != 34.0/128 || w != -16.0/128 {
+		t.Fatalf("Unexpected flipped texture bounds %v %v", x, w)
+	}
+	// Tall props extend up from the bottom of their cell.
+	if x, y, w, h := props[0].ScaledBounds(16); x != 2 || y != 0 || w != 1 || h != 2 {
+		t.Fatalf("Unexpected prop bounds %v %v %v %v", x, y, w, h)
+	}
+	if meta := m.Tilesets[1].Metadata(16); meta.FramesWide != 2 || meta.FramesHigh != 2 || meta.TileHeight != 32 {
+		t.Fatalf("Unexpected metadata %+v", meta)
+	}
+}
+
+func TestTiledGrid(t *testing.T) {
+	var (
+		m    = loadTestTMX(t)
+		g    *Grid
+		err  error
+		item TiledGridItem
+		ok   bool
+	)
+	if g, err = m.Grid(TiledGridOptions{Layer: "walls", BlockSize: 1}); err != nil {
+		t.Fatalf("Problem building grid: %v", err)
+	}
+	if g.Width != 3 || g.Height != 2 || g.Get(1, 1) == nil || g.Get(0, 0) != nil || g.Get(2, 0) == nil {
+		t.Fatalf("Expected walls from layer, got %v", g.points)
+	}
+	if g, err = m.Grid(TiledGridOptions{Property: "solid", BlockSize: 1}); err != nil {
+		t.Fatalf("Problem building grid: %v", err)
+	}
+	// Both layers have a solid tile here, and the unflipped one in walls
+	// is on top.
+	if item, ok = g.Get(1, 1).(TiledGridItem); !ok || item.Tile.GID != 2 || item.Tile.FlipH {
+		t.Fatalf("Expected solid tile from walls layer, got %v", g.Get(1, 1))
+	}
+	if g.Get(0, 1) != nil {
+		t.Fatalf("Expected tile without property to be skipped")
+	}
+	if _, err = m.Grid(TiledGridOptions{Layer: "missing"}); err == nil {
+		t.Fatalf("Expected error for missing layer")
+	}
+}
+
+func TestParseTiledJSON(t *testing.T) {
+	var (
+		m   *TiledMap
+		err error
+	)
+	if m, err = ParseTiledJSON([]byte(TEST_TILED_JSON_STRING), "maps"); err != nil {
+		t.Fatalf("Problem parsing JSON: %v", err)
+	}
+	if m.Tilesets[0].Name != "a" || m.Tilesets[1].Image != filepath.Join("maps", "b.png") {
+		t.Fatalf("Expected tilesets ordered by first gid, got %v %v", m.Tilesets[0], m.Tilesets[1])
+	}
+	ground := m.TileLayer("ground")
+	if ground.Opacity != 0.5 || ground.Tiles[1].GID != 6 || !ground.Tiles[1].FlipV {
+		t.Fatalf("Unexpected ground layer %+v", ground)
+	}
+	if m.Tileset(6).Name != "b" || m.Tileset(9) != nil {
+		t.Fatalf("Tileset lookup failed")
+	}
+	if solid, _ := m.TileProperties(ground.Tiles[0]).GetBool("solid"); !solid {
+		t.Fatalf("Expected tile property")
+	}
+	players := m.Objects("player")
+	if len(players) != 1 || !players[0].Point {
+		t.Fatalf("Expected point spawn from group, got %v", players)
+	}
+	if health, ok := players[0].Properties.GetInt("health"); !ok || health != 5 {
+		t.Fatalf("Expected int property, got %v", players[0].Properties)
+	}
+	if _, err = ParseTiledJSON([]byte(`{"orientation": "isometric"}`), ""); err == nil {
+		t.Fatalf("Expected error for isometric map")
+	}
+}
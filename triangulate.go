@@ -0,0 +1,310 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Ear clipping, with holes joined to the outline as described in
+//   https://www.geometrictools.com/Documentation/TriangulationByEarClipping.pdf
+
+package twodee
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"sort"
+)
+
+// Vertices and indices for drawing a filled polygon with a ShapeRenderer,
+// laid out as LineGeometry is.  Texture coordinates run from 0 to 1 across
+// the bounds of the outline.
+type ShapeGeometry struct {
+	Vertices []TexturedPoint
+	Indices  []uint32
+}
+
+// Triangulates a simple polygon, which may be concave, with any holes
+// cut out of it.  Points may be given in either winding.  Holes must lie
+// inside the outline without touching it or each other.
+func NewShapeGeometry(outline []mgl32.Vec2, holes ...[]mgl32.Vec2) (out *ShapeGeometry, err error) {
+	var (
+		points  []mgl32.Vec2
+		indices []uint32
+		min     mgl32.Vec2
+		max     mgl32.Vec2
+	)
+	if points, indices, err = Triangulate(outline, holes...); err != nil {
+		return
+	}
+	min, max = points[0], points[0]
+	for _, p := range points {
+		min = mgl32.Vec2{minFloat32(min[0], p[0]), minFloat32(min[1], p[1])}
+		max = mgl32.Vec2{maxFloat32(max[0], p[0]), maxFloat32(max[1], p[1])}
+	}
+	out = &ShapeGeometry{
+		Vertices: make([]TexturedPoint, len(points)),
+		Indices:  indices,
+	}
+	for i, p := range points {
+		out.Vertices[i] = TexturedPoint{
+			X:        p[0],
+			Y:        p[1],
+			TextureX: (p[0] - min[0]) / maxFloat32(max[0]-min[0], 1e-6),
+			TextureY: (p[1] - min[1]) / maxFloat32(max[1]-min[1], 1e-6),
+		}
+	}
+	return
+}
+
+// Returns the points of the outline followed by those of each hole, and
+// the indices of those points for each triangle, counter-clockwise.
+func Triangulate(outline []mgl32.Vec2, holes ...[]mgl32.Vec2) (points []mgl32.Vec2, indices []uint32, err error) {
+	var ring []int
+	if len(outline) < 3 {
+		err = fmt.Errorf("Polygon needs at least 3 points")
+		return
+	}
+	points = append(points, outline...)
+	ring = windingOrder(points, 0, len(outline), true)
+	var starts = make([]int, len(holes))
+	for i, hole := range holes {
+		if len(hole) < 3 {
+			err = fmt.Errorf("Hole needs at least 3 points")
+			return
+		}
+		starts[i] = len(points)
+		points = append(points, hole...)
+	}
+	// Joins holes from right to left, so that each bridge can only cross
+	// holes which are already part of the ring.
+	var order = make([]int, len(holes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return rightmost(points, starts[order[a]], len(holes[order[a]])) >
+			rightmost(points, starts[order[b]], len(holes[order[b]]))
+	})
+	for _, h := range order {
+		var hole = windingOrder(points, starts[h], len(holes[h]), false)
+		if ring, err = bridgeHole(points, ring, hole); err != nil {
+			return
+		}
+	}
+	indices = clipEars(points, ring)
+	return
+}
+
+// Returns the indices of count points from start, reversed if needed so
+// that they run counter-clockwise when ccw is set and clockwise otherwise.
+func windingOrder(points []mgl32.Vec2, start, count int, ccw bool) (ring []int) {
+	var area float32
+	ring = make([]int, count)
+	for i := range ring {
+		var (
+			p = points[start+i]
+			q = points[start+(i+1)%count]
+		)
+		area += p[0]*q[1] - q[0]*p[1]
+		ring[i] = start + i
+	}
+	if (area > 0) != ccw {
+		for i, j := 0, count-1; i < j; i, j = i+1, j-1 {
+			ring[i], ring[j] = ring[j], ring[i]
+		}
+	}
+	return
+}
+
+func rightmost(points []mgl32.Vec2, start, count int) (x float32) {
+	x = float32(-math.MaxFloat32)
+	for _, p := range points[start : start+count] {
+		x = maxFloat32(x, p[0])
+	}
+	return
+}
+
+// Returns twice the signed area of the triangle a, b, c, which is positive
+// if the points run counter-clockwise.
+func triangleArea(a, b, c mgl32.Vec2) float32 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (c[0]-a[0])*(b[1]-a[1])
+}
+
+// Returns true if p is inside or on the edge of the counter-clockwise
+// triangle a, b, c.
+func inTriangle(p, a, b, c mgl32.Vec2) bool {
+	return triangleArea(a, b, p) >= 0 && triangleArea(b, c, p) >= 0 && triangleArea(c, a, p) >= 0
+}
+
+// Splices hole into ring by a pair of edges from the hole's rightmost
+// point to a point of the ring it can see.
+func bridgeHole(points []mgl32.Vec2, ring, hole []int) (out []int, err error) {
+	var (
+		m       = 0
+		mp      mgl32.Vec2
+		nearest = float32(math.MaxFloat32)
+		visible = -1
+		hit     mgl32.Vec2
+	)
+	for i, index := range hole {
+		if points[index][0] > points[hole[m]][0] {
+			m = i
+		}
+	}
+	mp = points[hole[m]]
+	// Casts a ray to the right of m to find the nearest edge of the ring.
+	for i, index := range ring {
+		var (
+			a = points[index]
+			b = points[ring[(i+1)%len(ring)]]
+		)
+		if (a[1] > mp[1]) == (b[1] > mp[1]) {
+			continue
+		}
+		var x = a[0] + (mp[1]-a[1])*(b[0]-a[0])/(b[1]-a[1])
+		if x < mp[0] || x >= nearest {
+			continue
+		}
+		nearest = x
+		hit = mgl32.Vec2{x, mp[1]}
+		// Of the edge's ends, the one further right is a candidate.
+		visible = i
+		if b[0] > a[0] {
+			visible = (i + 1) % len(ring)
+		}
+	}
+	if visible == -1 {
+		err = fmt.Errorf("Hole is outside the polygon")
+		return
+	}
+	// Another point of the ring may block the candidate, in which case the
+	// one making the smallest angle with the ray is visible instead.
+	var (
+		candidate = points[ring[visible]]
+		best      = float32(math.MaxFloat32)
+	)
+	if hit != candidate {
+		var a, b, c = mp, hit, candidate
+		if triangleArea(a, b, c) < 0 {
+			b, c = c, b
+		}
+		for i, index := range ring {
+			var p = points[index]
+			if i == visible || p == candidate || !inTriangle(p, a, b, c) {
+				continue
+			}
+			var (
+				prev = points[ring[(i+len(ring)-1)%len(ring)]]
+				next = points[ring[(i+1)%len(ring)]]
+			)
+			if triangleArea(prev, p, next) > 0 {
+				continue // Convex points of the ring cannot block the view.
+			}
+			var d = p.Sub(mp)
+			if angle := float32(math.Atan2(math.Abs(float64(d[1])), float64(d[0]))); angle < best {
+				best = angle
+				visible = i
+			}
+		}
+	}
+	// Earlier bridges visit some points twice.  Only one of the copies has
+	// the hole inside its corner, and splicing at the other would cross.
+	var seen = 0
+	for i, index := range ring {
+		if index != ring[visible] {
+			continue
+		}
+		if seen++; seen == 1 || inCorner(points, ring, i, mp) {
+			visible = i
+		}
+	}
+	out = make([]int, 0, len(ring)+len(hole)+2)
+	out = append(out, ring[:visible+1]...)
+	for i := 0; i <= len(hole); i++ {
+		out = append(out, hole[(m+i)%len(hole)])
+	}
+	out = append(out, ring[visible:]...)
+	return
+}
+
+// Returns true if the direction from ring[i] to p lies within the corner
+// which the counter-clockwise ring makes at i.
+func inCorner(points []mgl32.Vec2, ring []int, i int, p mgl32.Vec2) bool {
+	var (
+		at   = points[ring[i]]
+		prev = points[ring[(i+len(ring)-1)%len(ring)]]
+		next = points[ring[(i+1)%len(ring)]]
+	)
+	if triangleArea(prev, at, next) > 0 {
+		return triangleArea(at, next, p) > 0 && triangleArea(at, p, prev) > 0
+	}
+	return triangleArea(at, prev, p) <= 0 || triangleArea(at, p, next) <= 0
+}
+
+// Cuts triangles from the corners of a counter-clockwise ring until none
+// are left.
+func clipEars(points []mgl32.Vec2, ring []int) (indices []uint32) {
+	var (
+		prev = func(i int) int { return (i + len(ring) - 1) % len(ring) }
+		next = func(i int) int { return (i + 1) % len(ring) }
+	)
+	for len(ring) > 3 {
+		var ear = -1
+		for i := range ring {
+			if isEar(points, ring, prev(i), i, next(i)) {
+				ear = i
+				break
+			}
+		}
+		if ear == -1 {
+			// Rounding or a badly formed polygon left no clean ear, so the
+			// first convex corner is cut to make progress.
+			ear = 0
+			for i := range ring {
+				if triangleArea(points[ring[prev(i)]], points[ring[i]], points[ring[next(i)]]) > 0 {
+					ear = i
+					break
+				}
+			}
+		}
+		var a, b, c = ring[prev(ear)], ring[ear], ring[next(ear)]
+		if triangleArea(points[a], points[b], points[c]) != 0 {
+			indices = append(indices, uint32(a), uint32(b), uint32(c))
+		}
+		ring = append(ring[:ear], ring[ear+1:]...)
+	}
+	if triangleArea(points[ring[0]], points[ring[1]], points[ring[2]]) != 0 {
+		indices = append(indices, uint32(ring[0]), uint32(ring[1]), uint32(ring[2]))
+	}
+	return
+}
+
+// Returns true if the corner at b is convex and no other point of the ring
+// lies in the triangle a, b, c.
+func isEar(points []mgl32.Vec2, ring []int, a, b, c int) bool {
+	var pa, pb, pc = points[ring[a]], points[ring[b]], points[ring[c]]
+	if area := triangleArea(pa, pb, pc); area < 0 {
+		return false
+	} else if area == 0 {
+		return true // Dropping a point on a straight edge adds no triangle.
+	}
+	for i, index := range ring {
+		var p = points[index]
+		if i == a || i == b || i == c || p == pa || p == pb || p == pc {
+			continue
+		}
+		if inTriangle(p, pa, pb, pc) {
+			return false
+		}
+	}
+	return true
+}
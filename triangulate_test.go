@@ -0,0 +1,149 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package twodee
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"testing"
+)
+
+func polygonArea(points []mgl32.Vec2) (area float32) {
+	for i, p := range points {
+		var q = points[(i+1)%len(points)]
+		area += p[0]*q[1] - q[0]*p[1]
+	}
+	return float32(math.Abs(float64(area))) / 2
+}
+
+// Checks that the triangles all wind counter-clockwise and cover area.
+func checkTriangulation(t *testing.T, points []mgl32.Vec2, indices []uint32, triangles int, area float32) {
+	if len(indices) != triangles*3 {
+		t.Fatalf("Expected %v triangles, got %v", triangles, len(indices)/3)
+	}
+	var total float32
+	for i := 0; i < len(indices); i += 3 {
+		var a = triangleArea(points[indices[i]], points[indices[i+1]], points[indices[i+2]])
+		if a <= 0 {
+			t.Fatalf("Triangle %v is not counter-clockwise", indices[i:i+3])
+		}
+		total += a / 2
+	}
+	if !closeTo(total, area) {
+		t.Fatalf("Expected triangles to cover %v, got %v", area, total)
+	}
+}
+
+func TestTriangulateConcave(t *testing.T) {
+	// An L shape, given clockwise.
+	var outline = []mgl32.Vec2{{0, 0}, {0, 2}, {1, 2}, {1, 1}, {2, 1}, {2, 0}}
+	var points, indices, err = Triangulate(outline)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	checkTriangulation(t, points, indices, 4, 3)
+}
+
+func TestTriangulateStar(t *testing.T) {
+	var outline []mgl32.Vec2
+	for i := 0; i < 10; i++ {
+		var (
+			angle  = float64(i) * math.Pi / 5
+			radius = 1.0
+		)
+		if i%2 == 1 {
+			radius = 0.4
+		}
+		outline = append(outline, mgl32.Vec2{float32(radius * math.Cos(angle)), float32(radius * math.Sin(angle))})
+	}
+	var points, indices, err = Triangulate(outline)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	checkTriangulation(t, points, indices, 8, polygonArea(outline))
+}
+
+func TestTriangulateHoles(t *testing.T) {
+	var (
+		outline = []mgl32.Vec2{{0, 0}, {10, 0}, {10, 10}, {0, 10}}
+		left    = []mgl32.Vec2{{1, 1}, {1, 4}, {4, 4}, {4, 1}}
+		right   = []mgl32.Vec2{{6, 6}, {9, 6}, {9, 9}, {6, 9}}
+	)
+	var points, indices, err = Triangulate(outline, left, right)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(points) != 12 {
+		t.Fatalf("Expected points of the outline and holes, got %v", len(points))
+	}
+	// n points and h holes make n + 2h - 2 triangles.
+	checkTriangulation(t, points, indices, 14, 100-9-9)
+	if _, _, err = Triangulate(outline, []mgl32.Vec2{{11, 1}, {12, 1}, {12, 2}}); err == nil {
+		t.Fatalf("Expected error for a hole outside the outline")
+	}
+}
+
+func TestTriangulateHoleBehindNotch(t *testing.T) {
+	// The ray from the hole meets the tip of the notch, which is the only
+	// point the hole can see.
+	var (
+		outline = []mgl32.Vec2{{0, 0}, {10, 0}, {10, 4}, {5, 5}, {10, 6}, {10, 10}, {0, 10}}
+		hole    = []mgl32.Vec2{{1, 4}, {3, 5}, {1, 6}}
+	)
+	var points, indices, err = Triangulate(outline, hole)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	checkTriangulation(t, points, indices, 10, 100-5-2)
+}
+
+func TestTriangulateHoleBridgesCross(t *testing.T) {
+	// The ray from the left hole meets the right hole's bridge, whose top
+	// end appears twice in the ring.  Only the second copy faces the hole.
+	var (
+		outline = []mgl32.Vec2{{0, 0}, {10, 0}, {11, 10}, {0, 10}}
+		right   = []mgl32.Vec2{{6, 4}, {8, 4}, {8, 6}, {6, 6}}
+		left    = []mgl32.Vec2{{1, 7}, {3, 8}, {1, 9}}
+	)
+	var points, indices, err = Triangulate(outline, right, left)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	checkTriangulation(t, points, indices, 13, 105-4-2)
+	outline = []mgl32.Vec2{{7.18, 0}, {9.08, 11.38}, {-2.14, 9.38}, {-10.55, 5.08}, {-6.32, -3.04}, {-3.14, -13.75}, {3.14, -3.94}}
+	left = []mgl32.Vec2{{-3.3, -0.89}, {-1.7, -0.89}, {-1.7, 0.71}, {-3.3, 0.71}}
+	right = []mgl32.Vec2{{-0.8, -1.05}, {0.8, -1.05}, {0.8, 0.55}, {-0.8, 0.55}}
+	if points, indices, err = Triangulate(outline, left, right); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	checkTriangulation(t, points, indices, 17, polygonArea(outline)-polygonArea(left)-polygonArea(right))
+}
+
+func TestShapeGeometry(t *testing.T) {
+	var geometry, err = NewShapeGeometry([]mgl32.Vec2{{2, 2}, {6, 2}, {6, 4}, {2, 4}})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(geometry.Vertices) != 4 || len(geometry.Indices) != 6 {
+		t.Fatalf("Unexpected geometry %v", geometry)
+	}
+	var v = geometry.Vertices[2]
+	if v.X != 6 || v.Y != 4 || v.TextureX != 1 || v.TextureY != 1 {
+		t.Fatalf("Unexpected vertex %v", v)
+	}
+	if _, err = NewShapeGeometry([]mgl32.Vec2{{0, 0}, {1, 1}}); err == nil {
+		t.Fatalf("Expected error for too few points")
+	}
+}
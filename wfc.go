@@ -0,0 +1,264 @@
+// Copyright 2015 Arne Roomann-Kurrik
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The simple tiled model of Wave Function Collapse
+// (https://github.com/mxgmn/WaveFunctionCollapse).
+
+package twodee
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Directions between neighbouring tiles, in the order of cardinalXs.
+const (
+	WFCNorth = iota
+	WFCEast
+	WFCSouth
+	WFCWest
+)
+
+// Which tiles may sit next to each other, and how often each is picked.
+type WFCRules struct {
+	Weights []float32
+	allowed [4][][]bool // allowed[dir][a][b] if b may be in dir from a.
+}
+
+// Returns rules for len(weights) tiles which do not yet allow any tile
+// next to another.
+func NewWFCRules(weights []float32) (r *WFCRules) {
+	r = &WFCRules{Weights: weights}
+	for dir := range r.allowed {
+		r.allowed[dir] = make([][]bool, len(weights))
+		for a := range weights {
+			r.allowed[dir][a] = make([]bool, len(weights))
+		}
+	}
+	return
+}
+
+// Allows tile b to sit in direction dir from tile a, and so a to sit in
+// the opposite direction from b.
+func (r *WFCRules) Allow(a, b, dir int) {
+	r.allowed[dir][a][b] = true
+	r.allowed[(dir+2)%4][b][a] = true
+}
+
+// Allows a and b next to each other in every direction.
+func (r *WFCRules) AllowAll(a, b int) {
+	for dir := range r.allowed {
+		r.Allow(a, b, dir)
+	}
+}
+
+type wfcState struct {
+	rules   *WFCRules
+	width   int32
+	height  int32
+	options [][]bool // options[cell][tile]
+	counts  []int
+	rand    *rand.Rand
+	stack   []int32
+	noise   []float32
+}
+
+// Fills a width by height map with tiles which all sit next to allowed
+// neighbours, and returns them in Grid index order.  Each attempt starts
+// over when a cell is left with no possible tile; an error is returned if
+// every attempt fails.
+func SolveWFC(width, height int32, seed int64, rules *WFCRules, attempts int) (tiles []int, err error) {
+	var s = &wfcState{
+		rules:  rules,
+		width:  width,
+		height: height,
+		rand:   rand.New(rand.NewSource(seed)),
+	}
+	for attempt := 0; attempt < attempts; attempt++ {
+		if tiles = s.solve(); tiles != nil {
+			return
+		}
+	}
+	err = fmt.Errorf("No tiling found")
+	return
+}
+
+func (s *wfcState) reset() {
+	var (
+		cells = int(s.width * s.height)
+		tiles = len(s.rules.Weights)
+	)
+	s.options = make([][]bool, cells)
+	s.counts = make([]int, cells)
+	s.noise = make([]float32, cells)
+	for i := range s.options {
+		s.options[i] = make([]bool, tiles)
+		for t := range s.options[i] {
+			s.options[i][t] = s.rules.Weights[t] > 0
+			if s.options[i][t] {
+				s.counts[i]++
+			}
+		}
+		// Breaks ties between cells with as many options.
+		s.noise[i] = s.rand.Float32()
+	}
+}
+
+func (s *wfcState) solve() (tiles []int) {
+	s.reset()
+	// Rules out tiles which can never fit before anything is picked.
+	s.stack = s.stack[:0]
+	for i := range s.options {
+		s.stack = append(s.stack, int32(i))
+	}
+	if !s.propagate() {
+		return nil
+	}
+	for {
+		var (
+			cell = int32(-1)
+			best float32
+		)
+		for i, count := range s.counts {
+			if count == 0 {
+				return nil
+			}
+			if count == 1 {
+				continue
+			}
+			if score := float32(count) + s.noise[i]; cell == -1 || score < best {
+				cell = int32(i)
+				best = score
+			}
+		}
+		if cell == -1 {
+			break
+		}
+		s.collapse(cell)
+		if !s.propagate() {
+			return nil
+		}
+	}
+	tiles = make([]int, len(s.options))
+	for i, options := range s.options {
+		for t, ok := range options {
+			if ok {
+				tiles[i] = t
+			}
+		}
+	}
+	return
+}
+
+// Picks a tile for cell at random, weighted by the rules.
+func (s *wfcState) collapse(cell int32) {
+	var (
+		options = s.options[cell]
+		total   float32
+		pick    = -1
+	)
+	for t, ok := range options {
+		if ok {
+			total += s.rules.Weights[t]
+		}
+	}
+	var target = s.rand.Float32() * total
+	for t, ok := range options {
+		if !ok {
+			continue
+		}
+		pick = t
+		if target -= s.rules.Weights[t]; target < 0 {
+			break
+		}
+	}
+	for t := range options {
+		options[t] = t == pick
+	}
+	s.counts[cell] = 1
+	s.stack = append(s.stack[:0], cell)
+}
+
+// Removes tiles which no longer fit next to their neighbours, spreading out
+// from the cells on the stack.  Returns false if a cell runs out of tiles.
+func (s *wfcState) propagate() bool {
+	for len(s.stack) > 0 {
+		var (
+			cell = s.stack[len(s.stack)-1]
+			x    = cell % s.width
+			y    = s.height - cell/s.width - 1
+		)
+		s.stack = s.stack[:len(s.stack)-1]
+		for dir := range cardinalXs {
+			var (
+				nx, ny = x + cardinalXs[dir], y + cardinalYs[dir]
+				n      int32
+				change bool
+			)
+			if nx < 0 || ny < 0 || nx >= s.width || ny >= s.height {
+				continue
+			}
+			n = s.width*(s.height-ny-1) + nx
+			for b, ok := range s.options[n] {
+				if !ok || s.supported(cell, b, dir) {
+					continue
+				}
+				s.options[n][b] = false
+				s.counts[n]--
+				change = true
+			}
+			if s.counts[n] == 0 {
+				return false
+			}
+			if change {
+				s.stack = append(s.stack, n)
+			}
+		}
+	}
+	return true
+}
+
+// Returns true if some tile still possible at cell allows b in dir from it.
+func (s *wfcState) supported(cell int32, b, dir int) bool {
+	for a, ok := range s.options[cell] {
+		if ok && s.rules.allowed[dir][a][b] {
+			return true
+		}
+	}
+	return false
+}
+
+// Solves rules for the size of g and writes the result through item, which
+// is given each cell's tile.  As with the other generators, every open cell
+// is then joined to the others, with tunnels of the open tile cut through
+// the rules and any small cut off areas filled with the wall tile.  Tiles
+// are returned as written, tunnels included.
+func GenerateWFC(g *Grid, seed int64, rules *WFCRules, attempts int, open, wall int, item func(x, y int32, tile int) GridItem) (tiles []int, err error) {
+	if tiles, err = SolveWFC(g.Width, g.Height, seed, rules, attempts); err != nil {
+		return
+	}
+	for i, tile := range tiles {
+		var x, y = g.Coords(int32(i))
+		g.SetIndex(int32(i), item(x, y, tile))
+	}
+	ConnectRegions(g, 0, func(x, y int32, isWall bool) GridItem {
+		var tile = open
+		if isWall {
+			tile = wall
+		}
+		tiles[g.Index(x, y)] = tile
+		return item(x, y, tile)
+	})
+	return
+}